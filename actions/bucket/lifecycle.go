@@ -0,0 +1,229 @@
+package bucket
+
+import (
+	"cleansync/actions/sync"
+	"cleansync/config"
+	"cleansync/output"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/urfave/cli/v2"
+)
+
+// RulePrefix starts the id of every lifecycle rule cleansync installs.
+const RulePrefix = "cleansync-tiering"
+
+// Transition moves objects to StorageClass once they are Days old.
+type Transition struct {
+	Days         int32
+	StorageClass types.TransitionStorageClass
+}
+
+// ParseTransition parses DAYS:CLASS, e.g. "180:DEEP_ARCHIVE".
+func ParseTransition(s string) (Transition, error) {
+	days, class, ok := strings.Cut(s, ":")
+	if !ok {
+		return Transition{}, fmt.Errorf("invalid transition %q, expected DAYS:STORAGE_CLASS", s)
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(days), 10, 32)
+	if err != nil || n < 0 {
+		return Transition{}, fmt.Errorf("invalid number of days in the transition %q", s)
+	}
+	t := Transition{Days: int32(n), StorageClass: types.TransitionStorageClass(strings.ToUpper(strings.TrimSpace(class)))}
+	for _, v := range t.StorageClass.Values() {
+		if v == t.StorageClass {
+			return t, nil
+		}
+	}
+	return Transition{}, fmt.Errorf("objects can not transition to the storage class %q", class)
+}
+
+// RuleID is the id of the rule for prefix, so rules for different prefixes of a bucket do not replace each other.
+func RuleID(prefix string) string {
+	if prefix == "" {
+		return RulePrefix
+	}
+	return RulePrefix + "-" + strings.Trim(prefix, "/")
+}
+
+// destinations returns the buckets the command works on, from --bucket or the destinations of --profile.
+func destinations(c *cli.Context) ([]sync.Destination, error) {
+	if c.IsSet("bucket") {
+		return []sync.Destination{{Bucket: c.String("bucket"), Region: c.String("region"), Prefix: c.String("prefix")}}, nil
+	}
+	name := c.String("profile")
+	if name == "" {
+		return nil, fmt.Errorf("no bucket, use --bucket or --profile")
+	}
+	cfg, err := config.Load(c.String("config"), c.IsSet("config"))
+	if err != nil {
+		return nil, err
+	}
+	profile, err := cfg.Profile(name)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := sync.OptionsFromProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Destinations) == 0 {
+		return nil, fmt.Errorf("profile %s has no bucket", name)
+	}
+	for i := range opts.Destinations {
+		if c.IsSet("prefix") {
+			opts.Destinations[i].Prefix = c.String("prefix")
+		}
+		if c.IsSet("region") {
+			opts.Destinations[i].Region = c.String("region")
+		}
+	}
+	return opts.Destinations, nil
+}
+
+// Apply installs a lifecycle rule that moves the objects under the prefix through the
+// transitions. The other rules of the bucket are kept, a rule installed earlier for the same prefix is replaced.
+func Apply(c *cli.Context) error {
+	mode, err := output.ParseMode(c.String("output"))
+	if err != nil {
+		return err
+	}
+	var transitions []Transition
+	for _, s := range c.StringSlice("transition") {
+		t, err := ParseTransition(s)
+		if err != nil {
+			return err
+		}
+		transitions = append(transitions, t)
+	}
+	if len(transitions) == 0 {
+		return fmt.Errorf("no transition, use e.g. --transition 180:DEEP_ARCHIVE")
+	}
+	sort.Slice(transitions, func(i, j int) bool { return transitions[i].Days < transitions[j].Days })
+
+	dests, err := destinations(c)
+	if err != nil {
+		return err
+	}
+	for _, d := range dests {
+		client, err := sync.GetAwsClient(c.Context, d.Region)
+		if err != nil {
+			return err
+		}
+		id := RuleID(d.Prefix)
+		if c.IsSet("id") {
+			id = c.String("id")
+		}
+		err = apply(c.Context, client, d, id, transitions)
+		if err != nil {
+			return fmt.Errorf("%s: %w", d.Bucket, err)
+		}
+		if mode == output.JSON {
+			json.NewEncoder(os.Stdout).Encode(map[string]interface{}{"bucket": d.Bucket, "prefix": d.Prefix, "id": id, "transitions": describe(transitions)})
+			continue
+		}
+		fmt.Printf("Installed %s on s3://%s/%s: %s\n", id, d.Bucket, d.Prefix, strings.Join(describe(transitions), ", "))
+	}
+	return nil
+}
+
+func apply(ctx context.Context, client *s3.Client, d sync.Destination, id string, transitions []Transition) error {
+	existing, err := rules(ctx, client, d.Bucket)
+	if err != nil {
+		return err
+	}
+	rule := types.LifecycleRule{
+		ID:     aws.String(id),
+		Status: types.ExpirationStatusEnabled,
+		Filter: &types.LifecycleRuleFilterMemberPrefix{Value: d.Prefix},
+	}
+	for _, t := range transitions {
+		rule.Transitions = append(rule.Transitions, types.Transition{Days: aws.Int32(t.Days), StorageClass: t.StorageClass})
+	}
+	// a put replaces the whole configuration, so send the other rules along
+	keep := []types.LifecycleRule{rule}
+	for _, r := range existing {
+		if aws.ToString(r.ID) != id {
+			keep = append(keep, r)
+		}
+	}
+	_, err = client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(d.Bucket),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: keep},
+	})
+	return err
+}
+
+// rules returns the lifecycle rules of bucket, none if it has no configuration.
+func rules(ctx context.Context, client *s3.Client, bucket string) ([]types.LifecycleRule, error) {
+	res, err := client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchLifecycleConfiguration" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res.Rules, nil
+}
+
+// Show prints the lifecycle rules of the bucket.
+func Show(c *cli.Context) error {
+	mode, err := output.ParseMode(c.String("output"))
+	if err != nil {
+		return err
+	}
+	dests, err := destinations(c)
+	if err != nil {
+		return err
+	}
+	for _, d := range dests {
+		client, err := sync.GetAwsClient(c.Context, d.Region)
+		if err != nil {
+			return err
+		}
+		list, err := rules(c.Context, client, d.Bucket)
+		if err != nil {
+			return fmt.Errorf("%s: %w", d.Bucket, err)
+		}
+		for _, r := range list {
+			var transitions []Transition
+			for _, t := range r.Transitions {
+				transitions = append(transitions, Transition{Days: aws.ToInt32(t.Days), StorageClass: t.StorageClass})
+			}
+			prefix := aws.ToString(r.Prefix)
+			if f, ok := r.Filter.(*types.LifecycleRuleFilterMemberPrefix); ok {
+				prefix = f.Value
+			}
+			if mode == output.JSON {
+				json.NewEncoder(os.Stdout).Encode(map[string]interface{}{"bucket": d.Bucket, "id": aws.ToString(r.ID), "status": r.Status, "prefix": prefix, "transitions": describe(transitions)})
+				continue
+			}
+			fmt.Printf("s3://%s  %s (%s) prefix %q: %s\n", d.Bucket, aws.ToString(r.ID), r.Status, prefix, strings.Join(describe(transitions), ", "))
+		}
+		if len(list) == 0 && mode != output.JSON {
+			fmt.Printf("s3://%s has no lifecycle rules\n", d.Bucket)
+		}
+	}
+	return nil
+}
+
+func describe(transitions []Transition) []string {
+	res := []string{}
+	for _, t := range transitions {
+		res = append(res, fmt.Sprintf("%s after %d days", t.StorageClass, t.Days))
+	}
+	return res
+}
@@ -0,0 +1,25 @@
+package bucket
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestParseTransition(t *testing.T) {
+	tr, err := ParseTransition("180:deep_archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.Days != 180 || tr.StorageClass != types.TransitionStorageClassDeepArchive {
+		t.Fatalf("Unexpected transition %+v", tr)
+	}
+	for _, bad := range []string{"DEEP_ARCHIVE", "soon:GLACIER", "30:STANDARD"} {
+		if _, err := ParseTransition(bad); err == nil {
+			t.Fatalf("Expected an error for the transition %q", bad)
+		}
+	}
+	if RuleID("tv/") != "cleansync-tiering-tv" || RuleID("") != "cleansync-tiering" {
+		t.Fatalf("Unexpected rule ids %s %s", RuleID("tv/"), RuleID(""))
+	}
+}
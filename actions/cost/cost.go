@@ -0,0 +1,142 @@
+package cost
+
+import (
+	"cleansync/actions/sync"
+	"cleansync/config"
+	"cleansync/filesystem"
+	"cleansync/localsql"
+	"cleansync/output"
+	"cleansync/pricing"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Cost estimates what the uploads in the manifest cost: storage per month, the PUT requests,
+// early deletion of files that are gone locally and a full restore at every retrieval tier.
+func Cost(c *cli.Context) error {
+	mode, err := output.ParseMode(c.String("output"))
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load(c.String("config"), c.IsSet("config"))
+	if err != nil {
+		return err
+	}
+	name := c.String("profile")
+	profile := config.Profile{}
+	if name != "" {
+		profile, err = cfg.Profile(name)
+		if err != nil {
+			return err
+		}
+	}
+	table := pricing.Defaults()
+	err = table.Override(cfg.Pricing)
+	if err != nil {
+		return err
+	}
+	unknown := strings.ToUpper(c.String("unknown-class"))
+	if _, ok := table[unknown]; !ok {
+		return fmt.Errorf("no prices for the storage class %q", unknown)
+	}
+
+	dbpath := sync.ManifestPath(c, name, profile, mode)
+	db, err := localsql.OpenReadOnly(dbpath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	entries, err := db.Entries()
+	if err != nil {
+		return err
+	}
+
+	report := table.Estimate(Objects(entries, unknown), time.Now())
+	if mode == output.JSON {
+		return json.NewEncoder(os.Stdout).Encode(struct {
+			Manifest string `json:"manifest"`
+			pricing.Report
+		}{dbpath, report})
+	}
+	return printReport(os.Stdout, dbpath, report)
+}
+
+// Objects converts the uploaded entries of a manifest. Uploads that were recorded without
+// a storage class are counted as unknownClass.
+func Objects(entries []localsql.Entry, unknownClass string) []pricing.Object {
+	var res []pricing.Object
+	for _, e := range entries {
+		if !e.Uploaded {
+			continue
+		}
+		o := pricing.Object{
+			StorageClass: e.StorageClass,
+			Size:         e.Size,
+			Objects:      1,
+		}
+		if o.StorageClass == "" {
+			o.StorageClass = unknownClass
+		}
+		if e.Multipart && e.Parts > 0 {
+			o.Objects = e.Parts
+		}
+		if e.UploadedAt > 0 {
+			o.UploadedAt = time.Unix(e.UploadedAt, 0)
+		}
+		if _, err := os.Stat(e.Path); errors.Is(err, os.ErrNotExist) {
+			o.Deleted = true
+		}
+		res = append(res, o)
+	}
+	return res
+}
+
+// money renders dollars, amounts too small for cents still show up as such.
+func money(v float64) string {
+	if v > 0 && v < 0.01 {
+		return "<$0.01"
+	}
+	return fmt.Sprintf("$%.2f", v)
+}
+
+func printReport(out io.Writer, dbpath string, r pricing.Report) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Manifest\t%s\n", dbpath)
+	if len(r.Unpriced) > 0 {
+		fmt.Fprintf(w, "No prices for\t%s, counted as free\n", strings.Join(r.Unpriced, ", "))
+	}
+
+	fmt.Fprintf(w, "\nSTORAGE CLASS\tFILES\tOBJECTS\tSIZE\tPER MONTH\n")
+	for _, cc := range r.Classes {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", cc.StorageClass, cc.Files, cc.Objects, filesystem.FormatSize(cc.Bytes), money(cc.Monthly))
+	}
+	fmt.Fprintf(w, "total\t\t\t\t%s\n", money(r.Monthly))
+
+	fmt.Fprintf(w, "\nUPLOADED\tOBJECTS\tSIZE\tPUT REQUESTS\n")
+	for _, mc := range r.Uploads {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", mc.Month, mc.Objects, filesystem.FormatSize(mc.Bytes), money(mc.Put))
+	}
+	fmt.Fprintf(w, "total\t\t\t%s\n", money(r.Put))
+
+	fmt.Fprintf(w, "\nGone locally\t%d files (%s), deleting them from the bucket now costs %s in early deletion fees\n",
+		r.Deletes.Files, filesystem.FormatSize(r.Deletes.Bytes), money(r.Deletes.Penalty))
+
+	fmt.Fprintf(w, "\nFULL RESTORE\tRETRIEVAL\tREQUESTS\tTRANSFER OUT\tTOTAL\n")
+	for _, tc := range r.Restore {
+		if !tc.Available {
+			// e.g. deep archive has no expedited retrieval
+			fmt.Fprintf(w, "%s\tn/a\tn/a\tn/a\tn/a\n", tc.Tier)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", tc.Tier, money(tc.Retrieval), money(tc.Requests), money(tc.Transfer), money(tc.Total))
+	}
+	return w.Flush()
+}
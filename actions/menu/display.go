@@ -3,12 +3,21 @@ package menu
 import (
 	"cleansync/filesystem"
 	"cleansync/messages"
+	"cleansync/output"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/urfave/cli/v2"
 )
 
 func Display(c *cli.Context) error {
+	mode, err := output.ParseMode(c.String("output"))
+	if err != nil {
+		return err
+	}
+	if mode != output.TUI {
+		// The menu is interactive, without a terminal all we can do is show the usage.
+		return cli.ShowAppHelp(c)
+	}
 	menu := NewMenu()
 
 	progressor := &filesystem.ProgressReadWriter{}
@@ -27,7 +36,7 @@ func Display(c *cli.Context) error {
 		}
 	}()
 
-	_, err := prog.Run()
+	_, err = prog.Run()
 	if err != nil {
 		return err
 	}
@@ -2,111 +2,279 @@ package processVideo
 
 import (
 	"cleansync/ffmpeg"
+	"cleansync/filesystem"
+	"cleansync/messages"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-type errMsg struct{ err error }
-
-func (e errMsg) Error() string { return e.err.Error() }
-
-func (m *VideoModel) SendError(err error) tea.Cmd {
+func (m *VideoModel) SendError(file string, err error) tea.Cmd {
 	return func() tea.Msg {
-		return errMsg{err}
+		return messages.ErrMsg{File: file, Err: err}
 	}
 }
 
-func (m *VideoModel) ProcessVideoCmd(s Status, ndx int) tea.Cmd {
+// statusCmd announces the stage the video at ndx is entering, so headless runs can report it.
+func (m *VideoModel) statusCmd(s Status, ndx int) tea.Cmd {
+	if ndx >= len(m.sources) {
+		return nil
+	}
+	source := m.sources[ndx]
 	return func() tea.Msg {
-		msg := ProcessVideoMessage{
-			ndx:    ndx,
-			status: s,
-		}
-
 		switch s {
-		case Starting:
-			return ProcessVideoMessage{
-				ndx:        ndx,
-				lastAction: fmt.Sprintf("%s Started processing.", checkMark),
-				nextAction: fmt.Sprintf("Removing Ads file: %s", m.sources[m.ndx]),
-				status:     RemovingAds,
+		case RemovingAds:
+			var size int64
+			if info, err := os.Stat(source); err == nil {
+				size = info.Size()
+			}
+			return messages.FileStartedMsg{File: source, Size: size}
+		case Transcoding:
+			return messages.StageMsg{File: source, Stage: "transcoding"}
+		case Verifying:
+			return messages.StageMsg{File: source, Stage: "verifying"}
+		case Uploading:
+			return messages.StageMsg{File: source, Stage: "copying"}
+		case Idle:
+			var size int64
+			if info, err := os.Stat(filepath.Join(m.dest, filepath.Base(source))); err == nil {
+				size = info.Size()
 			}
+			return messages.FileDoneMsg{File: source, Size: size}
+		}
+		return nil
+	}
+}
+
+// dispatch starts what the limits allow: copies of the videos waiting for one, then the next videos.
+func (m *VideoModel) dispatch() tea.Cmd {
+	var cmds []tea.Cmd
+	for ndx := range m.jobs {
+		if m.copying >= m.opts.copyJobs {
+			break
+		}
+		if m.jobs[ndx].status == Waiting {
+			m.copying++
+			cmds = append(cmds, m.start(Uploading, ndx))
+		}
+	}
+	for m.next < len(m.sources) && m.active < m.opts.jobs && m.cutting < m.opts.cutJobs {
+		m.active++
+		m.cutting++
+		cmds = append(cmds, m.start(RemovingAds, m.next))
+		m.next++
+	}
+	return tea.Batch(cmds...)
+}
 
+// release frees the slots the video held in status, after it failed.
+func (m *VideoModel) release(s Status) {
+	if s.cutting() {
+		m.cutting--
+	}
+	if s == Uploading {
+		m.copying--
+	}
+	m.active--
+}
+
+// start moves the video at ndx to the stage and runs it.
+func (m *VideoModel) start(s Status, ndx int) tea.Cmd {
+	j := &m.jobs[ndx]
+	j.status = s
+	j.progress, j.speed, j.remaining = 0, 0, 0
+	return tea.Sequence(m.statusCmd(s, ndx), m.ProcessVideoCmd(s, ndx, *j))
+}
+
+// ProcessVideoCmd runs the stage s for the video at ndx. It gets the job by value as several
+// videos are processed at the same time.
+func (m *VideoModel) ProcessVideoCmd(s Status, ndx int, j job) tea.Cmd {
+	source := m.sources[ndx]
+	opts := m.opts
+	dest := m.dest
+	// each video has its own temp folder for the chapters and concat lists
+	tmpFolder := filepath.Join(m.tempFolder, strconv.Itoa(ndx))
+	onProgress := m.onProgress(source)
+	updates := m.updates
+	ledger := m.ledger
+	return func() tea.Msg {
+		switch s {
 		case RemovingAds:
 			// Start Removing the ads
-
-			vid, err := ffmpeg.NewVideo(m.sources[ndx], m.tempFolder)
+			err := os.MkdirAll(tmpFolder, os.ModePerm)
 			if err != nil {
-				return VideoModel{err: err}
-
+				return failure(ndx, source, err)
+			}
+			vid, err := ffmpeg.NewVideo(source, tmpFolder)
+			if err != nil {
+				return failure(ndx, source, err)
+			}
+			vid.CutMode = opts.cutMode
+			vid.MarkBreaks = opts.markBreaks
+			vid.Keep = opts.keep
+			vid.OnProgress = onProgress
+			_, err = opts.chapters(&vid, source)
+			if err != nil {
+				return failure(ndx, source, err)
+			}
+			nonAdIndexes := vid.KeptIndexes(opts.rules)
+			if nonAdIndexes != nil && len(nonAdIndexes) == 0 {
+				return failure(ndx, source, fmt.Errorf("the rules remove every chapter of %s, check them with adclear --explain", source))
 			}
-			vid.TmpFolder = m.tempFolder
-			nonAdIndexes := vid.GetNonAdIndexes(m.skipFirst)
 
 			tmpVideo, err := vid.Recut(nonAdIndexes)
 			if err != nil {
-				msg.err = err
-				return err
+				return failure(ndx, source, err)
 			}
-			msg = ProcessVideoMessage{
+			msg := ProcessVideoMessage{
 				ndx:         ndx,
-				lastAction:  fmt.Sprintf("%s Removed Ads file: %s", checkMark, m.sources[ndx]),
-				nextAction:  fmt.Sprintf("Uploading file: %s", m.sources[m.ndx]),
-				status:      Uploading,
+				lastAction:  fmt.Sprintf("%s Removed Ads file: %s", checkMark, source),
+				status:      Verifying,
 				tmpLocation: tmpVideo,
+				sidecars:    vid.Sidecars,
+				expected:    vid.Expect(nonAdIndexes),
+			}
+			if ledger != nil {
+				c, err := cleaned(&vid, opts)
+				if err != nil {
+					os.Remove(tmpVideo)
+					return failure(ndx, source, err)
+				}
+				msg.cleaned = &c
+			}
+			if opts.transcode != nil {
+				msg.status = Transcoding
 			}
 			return msg
+		case Transcoding:
+			vid, err := ffmpeg.Probe(j.edited)
+			if err != nil {
+				return failure(ndx, source, err)
+			}
+			vid.OnProgress = onProgress
+			res, err := vid.Transcode(*opts.transcode)
+			if err != nil {
+				return failure(ndx, source, err)
+			}
+			lastAction := fmt.Sprintf("%s Transcoded file: %s, %s to %s", checkMark, source, filesystem.FormatSize(res.Before), filesystem.FormatSize(res.After))
+			if !res.Kept {
+				lastAction += ", not smaller, kept the original"
+			}
+			return ProcessVideoMessage{
+				ndx:         ndx,
+				lastAction:  lastAction,
+				status:      Verifying,
+				tmpLocation: j.edited,
+				sidecars:    j.sidecars,
+				expected:    j.expected,
+				transcoded:  &messages.TranscodedMsg{File: source, Before: res.Before, After: res.After, Kept: res.Kept},
+			}
+		case Verifying:
+			// nothing reaches the destination unless it checks out, the source is left alone either way
+			err := ffmpeg.Verify(j.edited, j.expected, opts.tolerance, opts.decode, onProgress)
+			if err != nil {
+				os.Remove(j.edited)
+				msg := failure(ndx, source, err)
+				msg.lastAction = fmt.Sprintf("%s Verification failed, not copied: %s", crossMark, err)
+				return msg
+			}
+			return ProcessVideoMessage{
+				ndx:         ndx,
+				lastAction:  fmt.Sprintf("%s Verified file: %s", checkMark, source),
+				status:      Waiting,
+				tmpLocation: j.edited,
+				sidecars:    j.sidecars,
+			}
 		case Uploading:
 			// Start uploading
-			err := os.MkdirAll(m.dest, os.ModePerm)
+			err := os.MkdirAll(dest, os.ModePerm)
 			if err != nil {
-				msg.err = err
-				return msg
+				return failure(ndx, source, err)
 			}
-			vidName := filepath.Base(m.editedVideo)
-			dest := filepath.Join(m.dest, vidName)
-			err = m.progressor.Copy(m.editedVideo, dest)
+			err = copyFiles(source, append([]string{j.edited}, j.sidecars...), dest, updates)
 			if err != nil {
-				msg.err = err
-				return msg
+				return failure(ndx, source, err)
+			}
+			if ledger != nil {
+				err = record(ledger, j.cleaned, j.edited, dest)
+				if err != nil {
+					return failure(ndx, source, fmt.Errorf("copied, but it could not be recorded in the manifest: %s", err))
+				}
 			}
 			// Remove the processed file
-			err = os.Remove(m.editedVideo)
+			err = os.Remove(j.edited)
 			if err != nil {
-				msg.err = err
-				return msg
-			}
-			nextAction := "completed"
-			if ndx <= len(m.sources)-1 {
-				nextAction = fmt.Sprintf("Removing Ads file: %s", m.sources[ndx])
+				return failure(ndx, source, err)
 			}
-
 			return ProcessVideoMessage{
 				ndx:        ndx,
 				status:     Idle,
-				lastAction: fmt.Sprintf("%s Uploaded file: %s", checkMark, m.sources[ndx]),
-				nextAction: nextAction,
+				lastAction: fmt.Sprintf("%s Uploaded file: %s", checkMark, source),
 			}
-		case Idle:
-			// Video is both processed and uploaded
-			if ndx >= len(m.sources)-1 {
-				return ProcessVideoMessage{
-					status: Completed,
+		}
+		return nil
+	}
+}
+
+// failure is the message of a video that could not be processed, the other videos carry on.
+func failure(ndx int, source string, err error) ProcessVideoMessage {
+	return ProcessVideoMessage{
+		ndx:        ndx,
+		status:     Failed,
+		lastAction: fmt.Sprintf("%s Failed, not copied: %s", crossMark, err),
+		failed:     &messages.FileFailedMsg{File: source, Err: err},
+	}
+}
+
+// copyFiles copies the files into dest and reports their progress as the one of source.
+func copyFiles(source string, files []string, dest string, updates chan<- messages.ProgressMsg) error {
+	var total int64
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+	}
+	progressor := &filesystem.ProgressReadWriter{}
+	if updates != nil && total > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(250 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					completed := atomic.LoadInt64(&progressor.Completed)
+					updates <- messages.ProgressMsg{File: source, Progress: float64(completed) / float64(total)}
 				}
 			}
-			msg = ProcessVideoMessage{
-				lastAction: fmt.Sprintf("%s Removing Ads file: %s", checkMark, m.sources[ndx+1]),
-				ndx:        ndx + 1,
-				status:     Idle,
-			}
-			return msg
-		default:
-			return ProcessVideoMessage{
-				status: Completed,
-			}
+		}()
+	}
+	for _, f := range files {
+		err := progressor.Copy(f, filepath.Join(dest, filepath.Base(f)))
+		if err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// onProgress forwards the progress of ffmpeg for the video at source to its progress bar.
+func (m *VideoModel) onProgress(source string) func(ffmpeg.RecutProgress) {
+	if m.updates == nil {
+		return nil
+	}
+	updates := m.updates
+	return func(p ffmpeg.RecutProgress) {
+		updates <- messages.ProgressMsg{File: source, Progress: p.Fraction, Speed: p.Speed, Remaining: p.Remaining}
+	}
 }
@@ -0,0 +1,82 @@
+package processVideo
+
+import (
+	"cleansync/actions/sync"
+	"cleansync/config"
+	"cleansync/localsql"
+	"cleansync/output"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// History lists the videos adclear processed with the manifest and what was cut from each of them.
+// An argument only lists the videos whose path contains it.
+func History(c *cli.Context) error {
+	mode, err := output.ParseMode(c.String("output"))
+	if err != nil {
+		return err
+	}
+	name := c.String("profile")
+	profile := config.Profile{}
+	if name != "" {
+		cfg, err := config.Load(c.String("config"), c.IsSet("config"))
+		if err != nil {
+			return err
+		}
+		profile, err = cfg.Profile(name)
+		if err != nil {
+			return err
+		}
+	}
+	db, err := localsql.OpenReadOnly(sync.ManifestPath(c, name, profile, mode))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	videos, err := db.CleanedVideos()
+	if err != nil {
+		return err
+	}
+	pattern := strings.ToLower(c.Args().First())
+	var matched []localsql.Cleaned
+	for _, v := range videos {
+		if strings.Contains(strings.ToLower(v.Source), pattern) {
+			matched = append(matched, v)
+		}
+	}
+	if mode == output.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, v := range matched {
+			if err := enc.Encode(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	printHistory(os.Stdout, matched)
+	return nil
+}
+
+func printHistory(out io.Writer, videos []localsql.Cleaned) {
+	if len(videos) == 0 {
+		fmt.Fprintln(out, "No videos have been processed with this manifest")
+		return
+	}
+	for _, v := range videos {
+		fmt.Fprintln(out, v.Source)
+		removed := time.Duration(v.Removed * float64(time.Second)).Round(time.Second)
+		fmt.Fprintf(out, "  %s to %s, %s removed\n", time.Unix(v.CleanedAt, 0).Format("2006-01-02 15:04"), v.Output, removed)
+		if len(v.Cuts) == 0 {
+			fmt.Fprintln(out, "  nothing was cut, it was copied as is")
+		}
+		for _, cut := range v.Cuts {
+			fmt.Fprintf(out, "  %s-%s  %-30q %s\n", timestamp(cut.Start), timestamp(cut.End), cut.Title, cut.Reason)
+		}
+	}
+}
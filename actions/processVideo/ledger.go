@@ -0,0 +1,174 @@
+package processVideo
+
+import (
+	"cleansync/ffmpeg"
+	"cleansync/filesystem"
+	"cleansync/localsql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ruleSummary describes everything that decides what the video at source turns into: the rules, the
+// cut list with its hash, detection, how it is cut, the streams that are kept and the transcode. A
+// video is processed again once any of it changes.
+func (o options) ruleSummary(source string) (string, error) {
+	var res []string
+	for _, r := range o.rules {
+		action := "remove"
+		if r.Keep {
+			action = "keep"
+		}
+		res = append(res, fmt.Sprintf("%s %s", action, r))
+	}
+	cutlist := o.cutlist
+	if cutlist == "" {
+		var err error
+		cutlist, err = ffmpeg.FindCutlist(source)
+		if err != nil {
+			return "", err
+		}
+	}
+	if cutlist != "" {
+		hash, err := filesystem.HashFile(cutlist)
+		if err != nil {
+			return "", err
+		}
+		if o.mergeCuts {
+			res = append(res, "merge the cut list "+hash+" with the chapters")
+		} else {
+			res = append(res, "replace the chapters with the cut list "+hash)
+		}
+	}
+	if o.detect != nil {
+		res = append(res, fmt.Sprintf("detect breaks %+v", *o.detect))
+	}
+	if o.cutMode != ffmpeg.KeyframeCut {
+		res = append(res, fmt.Sprintf("%s cuts", o.cutMode))
+	}
+	if o.markBreaks {
+		res = append(res, "mark breaks")
+	}
+	if len(o.keep.AudioLanguages) > 0 {
+		res = append(res, "audio "+strings.Join(o.keep.AudioLanguages, ","))
+	}
+	if len(o.keep.SubtitleLanguages) > 0 {
+		res = append(res, "subtitles "+strings.Join(o.keep.SubtitleLanguages, ","))
+	}
+	if o.transcode != nil {
+		res = append(res, fmt.Sprintf("transcode %+v", *o.transcode))
+	}
+	return strings.Join(res, "; "), nil
+}
+
+// outputPath is where the video ends up in dest.
+func outputPath(video string, dest string) (string, error) {
+	return filepath.Abs(filepath.Join(dest, filepath.Base(video)))
+}
+
+// unchanged reports whether the video at source was processed into dest with the same rules before
+// and has not changed since. A video that was touched but has the same content is recorded again,
+// so it does not have to be hashed the next time.
+func unchanged(ledger *localsql.Sqldb, source string, dest string, rules string) (bool, error) {
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return false, err
+	}
+	c, ok, err := ledger.Cleaned(abs)
+	if err != nil || !ok || c.Rules != rules {
+		return false, err
+	}
+	out, err := outputPath(source, dest)
+	if err != nil || c.Output != out {
+		return false, err
+	}
+	if _, err := os.Stat(out); err != nil {
+		// removed from the destination since
+		return false, nil
+	}
+	info, err := os.Stat(source)
+	if err != nil || info.Size() != c.Size {
+		return false, err
+	}
+	if info.ModTime().Unix() == c.Modified {
+		return true, nil
+	}
+	hash, err := filesystem.HashFile(source)
+	if err != nil || hash != c.Hash {
+		return false, err
+	}
+	c.Modified = info.ModTime().Unix()
+	return true, ledger.RecordCleaned(c)
+}
+
+// skipUnchanged splits the sources into the ones to process and the unchanged ones, see unchanged.
+func skipUnchanged(ledger *localsql.Sqldb, sources []string, dest string, opts options) (todo []string, skipped []string, err error) {
+	for _, s := range sources {
+		rules, err := opts.ruleSummary(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		same, err := unchanged(ledger, s, dest, rules)
+		if err != nil {
+			return nil, nil, err
+		}
+		if same {
+			skipped = append(skipped, s)
+		} else {
+			todo = append(todo, s)
+		}
+	}
+	return todo, skipped, nil
+}
+
+// cleaned describes what the rules cut from the video, for the ledger. The output is filled in
+// once the video has been copied.
+func cleaned(vid *ffmpeg.Video, opts options) (localsql.Cleaned, error) {
+	// NewVideo renames videos with quotes in their name
+	source := vid.FilePath()
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return localsql.Cleaned{}, err
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return localsql.Cleaned{}, err
+	}
+	hash, err := filesystem.HashFile(source)
+	if err != nil {
+		return localsql.Cleaned{}, err
+	}
+	rules, err := opts.ruleSummary(source)
+	if err != nil {
+		return localsql.Cleaned{}, err
+	}
+	res := localsql.Cleaned{
+		Source:   abs,
+		Size:     info.Size(),
+		Modified: info.ModTime().Unix(),
+		Hash:     hash,
+		Rules:    rules,
+		Cuts:     []localsql.Cut{},
+	}
+	for _, d := range vid.Classify(opts.rules) {
+		if !d.Removed {
+			continue
+		}
+		res.Cuts = append(res.Cuts, localsql.Cut{Start: d.Chapter.Start, End: d.Chapter.End, Title: d.Chapter.Title, Reason: d.Reason})
+		res.Removed += d.Chapter.End - d.Chapter.Start
+	}
+	return res, nil
+}
+
+// record adds the edited video, copied to dest, to the ledger.
+func record(ledger *localsql.Sqldb, c localsql.Cleaned, edited string, dest string) error {
+	out, err := outputPath(edited, dest)
+	if err != nil {
+		return err
+	}
+	c.Output = out
+	c.CleanedAt = time.Now().Unix()
+	return ledger.RecordCleaned(c)
+}
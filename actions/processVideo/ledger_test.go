@@ -0,0 +1,126 @@
+package processVideo
+
+import (
+	"cleansync/config"
+	"cleansync/localsql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a.mkv")
+	dest := filepath.Join(dir, "out")
+	err := os.WriteFile(source, []byte("video"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(dest, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dest, "a.mkv"), []byte("vid"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger, err := localsql.InitDb(filepath.Join(dir, "manifest.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ledger.Close()
+
+	same, err := unchanged(ledger, source, dest, "rules")
+	if err != nil || same {
+		t.Fatalf("Expected a video that was never processed to be processed, got %v %v", same, err)
+	}
+
+	info, _ := os.Stat(source)
+	c := localsql.Cleaned{Source: source, Size: info.Size(), Modified: info.ModTime().Unix(), Hash: "not the hash of a.mkv", Rules: "rules"}
+	err = record(ledger, c, source, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, err = unchanged(ledger, source, dest, "rules")
+	if err != nil || !same {
+		t.Fatalf("Expected the recorded video to be unchanged, got %v %v", same, err)
+	}
+	same, _ = unchanged(ledger, source, dest, "other rules")
+	if same {
+		t.Fatal("Expected the video to be processed again with other rules")
+	}
+
+	// touched, the hash decides and it does not match
+	err = os.Chtimes(source, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, _ = unchanged(ledger, source, dest, "rules")
+	if same {
+		t.Fatal("Expected a touched video with another hash to be processed again")
+	}
+
+	info, _ = os.Stat(source)
+	c.Modified = info.ModTime().Unix()
+	record(ledger, c, source, dest)
+	same, _ = unchanged(ledger, source, dest, "rules")
+	if !same {
+		t.Fatal("Expected the video to be unchanged once recorded again")
+	}
+	os.Remove(filepath.Join(dest, "a.mkv"))
+	same, _ = unchanged(ledger, source, dest, "rules")
+	if same {
+		t.Fatal("Expected a video whose output is gone to be processed again")
+	}
+}
+
+func TestRuleSummary(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a.mkv")
+	opts, err := newOptions(config.Adclear{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := opts.ruleSummary(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a cut list found next to the video, then edited
+	err = os.WriteFile(filepath.Join(dir, "a.edl"), []byte("0 5 0\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withCuts, err := opts.ruleSummary(source)
+	if err != nil || withCuts == plain {
+		t.Fatalf("Expected the cut list next to the video to change the summary, got %q %v", withCuts, err)
+	}
+	os.WriteFile(filepath.Join(dir, "a.edl"), []byte("0 6 0\n"), 0644)
+	if edited, _ := opts.ruleSummary(source); edited == withCuts {
+		t.Fatal("Expected an edited cut list to change the summary")
+	}
+
+	seen := map[string]bool{withCuts: true}
+	for _, settings := range []config.Adclear{
+		{CutlistMode: "merge"},
+		{CutMode: "accurate"},
+		{MarkBreaks: true},
+		{AudioLanguages: []string{"eng"}},
+		{SubtitleLanguages: []string{"eng"}},
+		{Transcode: "hevc-720p"},
+	} {
+		o, err := newOptions(settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		summary, err := o.ruleSummary(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[summary] {
+			t.Fatalf("Expected %+v to change the summary, got %q", settings, summary)
+		}
+		seen[summary] = true
+	}
+}
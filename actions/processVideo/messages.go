@@ -1,37 +1,64 @@
 package processVideo
 
+import (
+	"cleansync/ffmpeg"
+	"cleansync/localsql"
+	"cleansync/messages"
+)
+
 type Status int
 
 const (
-	Starting    Status = iota // 0
+	Starting    Status = iota // 0, waiting for its turn
 	RemovingAds               // 1
-	Uploading                 // 2
-	Idle                      // 3
-	Completed                 // 4
+	Transcoding               // 2
+	Verifying                 // 3
+	Waiting                   // 4, cut and waiting to be copied
+	Uploading                 // 5
+	Idle                      // 6, done
+	Failed                    // 7
 )
 
+// String is how the stage is shown in the row of a video.
+func (s Status) String() string {
+	switch s {
+	case Starting:
+		return "queued"
+	case RemovingAds:
+		return "removing ads"
+	case Transcoding:
+		return "transcoding"
+	case Verifying:
+		return "verifying"
+	case Waiting:
+		return "waiting to copy"
+	case Uploading:
+		return "copying"
+	case Idle:
+		return "done"
+	case Failed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// cutting reports whether the video holds one of the --cut-jobs slots in this stage.
+func (s Status) cutting() bool {
+	return s == RemovingAds || s == Transcoding || s == Verifying
+}
+
+// ProcessVideoMessage is sent when the video at ndx finished a stage and enters status.
 type ProcessVideoMessage struct {
 	ndx         int
 	status      Status
 	tmpLocation string
+	sidecars    []string // subtitles that go next to the video at tmpLocation
 	lastAction  string
-	nextAction  string
-	err         error
+	transcoded  *messages.TranscodedMsg
+	cleaned     *localsql.Cleaned       // what was cut, once the ads are removed
+	expected    ffmpeg.Expectation      // what the video at tmpLocation should look like
+	failed      *messages.FileFailedMsg // the video could not be processed and was not copied
 }
 
-// type RemoveAdsMsg struct {
-// 	started     bool
-// 	tmpLocation string
-// 	done        bool
-// 	err         error
-// }
-
-// type CopyFileMsg struct {
-// 	started     bool
-// 	done        bool
-// 	tmpLocation string
-// 	err         error
-// }
-
-type CleanTmpMsg struct {
-}
+// dispatchMsg starts the first videos.
+type dispatchMsg struct{}
@@ -1,11 +1,17 @@
 package processVideo
 
 import (
-	"cleansync/filesystem"
+	"cleansync/actions/sync"
+	"cleansync/config"
+	"cleansync/localsql"
+	"cleansync/lock"
 	"cleansync/messages"
+	"cleansync/output"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 
-	tea "github.com/charmbracelet/bubbletea"
 	"github.com/urfave/cli/v2"
 )
 
@@ -19,33 +25,165 @@ import (
 //   - source: The file path to the source video file.
 //   - skip_first: A boolean flag indicating whether to skip the first frame or section of the video.
 //   - dest: The file path to the destination where the processed video will be saved.
+//   - output: tui, plain or json. The last two do not need a terminal.
+//   - profile: Name of a config profile to take the adclear settings from, flags override it.
+//   - cutlist: A Comskip, EDL or "start end" cut list for the source, instead of the one next to it.
+//   - cutlist-mode: replace to use the cut list instead of the chapters, merge to cut it out of them.
+//   - cut-mode: keyframe to copy everything, accurate to re-encode the frames around each cut.
+//   - mark-breaks: Tag the chapters of the output that follow a removed break.
+//   - audio-lang, sub-lang: Keep only the audio and subtitles in these languages.
+//   - transcode: Re-encode the output with this transcode profile, if that makes it smaller.
+//   - verify-decode: Decode every frame of the output before it is copied.
+//   - jobs, cut-jobs, copy-jobs: How many videos are processed, cut and copied at the same time.
+//   - force: Process videos again even if the manifest says they did not change since they were.
+//   - detect: Find the commercial breaks of videos without chapters from black frames and silence.
+//   - explain: List the chapters of the source and the rule that keeps or removes each, without processing anything.
 //
 // Returns:
 //   - An error if the clearing process fails, otherwise nil.
 func Clear(c *cli.Context) error {
-	source := c.Path("source")
-	skip := c.Bool("skip_first")
-	dest := c.Path("dest")
+	mode, err := output.ParseMode(c.String("output"))
+	if err != nil {
+		return err
+	}
+
+	settings := config.Adclear{}
+	name := c.String("profile")
+	profile := config.Profile{}
+	if name != "" {
+		cfg, err := config.Load(c.String("config"), c.IsSet("config"))
+		if err != nil {
+			return err
+		}
+		profile, err = cfg.Profile(name)
+		if err != nil {
+			return err
+		}
+		if profile.Adclear == nil {
+			return fmt.Errorf("profile %q has no adclear settings", name)
+		}
+		settings = *profile.Adclear
+	}
+	if c.IsSet("source") {
+		settings.Source = c.Path("source")
+	}
+	if c.IsSet("dest") {
+		settings.Dest = c.Path("dest")
+	}
+	if c.IsSet("skip_first") {
+		settings.SkipFirst = c.Bool("skip_first")
+	}
+	if c.IsSet("cutlist") {
+		settings.Cutlist = c.Path("cutlist")
+	}
+	if c.IsSet("cutlist-mode") {
+		settings.CutlistMode = c.String("cutlist-mode")
+	}
+	if c.IsSet("cut-mode") {
+		settings.CutMode = c.String("cut-mode")
+	}
+	if c.IsSet("mark-breaks") {
+		settings.MarkBreaks = c.Bool("mark-breaks")
+	}
+	if c.IsSet("audio-lang") {
+		settings.AudioLanguages = c.StringSlice("audio-lang")
+	}
+	if c.IsSet("sub-lang") {
+		settings.SubtitleLanguages = c.StringSlice("sub-lang")
+	}
+	if c.IsSet("verify-decode") {
+		settings.VerifyDecode = c.Bool("verify-decode")
+	}
+	if c.IsSet("jobs") {
+		settings.Jobs = c.Int("jobs")
+	}
+	if c.IsSet("cut-jobs") {
+		settings.CutJobs = c.Int("cut-jobs")
+	}
+	if c.IsSet("copy-jobs") {
+		settings.CopyJobs = c.Int("copy-jobs")
+	}
+	if c.IsSet("force") {
+		settings.Force = c.Bool("force")
+	}
+	if c.IsSet("transcode") {
+		settings.Transcode = c.String("transcode")
+	}
+	if settings.Transcode != "" && settings.Transcodes == nil {
+		cfg, err := config.Load(c.String("config"), c.IsSet("config"))
+		if err != nil {
+			return err
+		}
+		settings.Transcodes = cfg.Transcode
+	}
+	if c.IsSet("detect") {
+		if !c.Bool("detect") {
+			settings.Detect = nil
+		} else if settings.Detect == nil {
+			settings.Detect = &config.Detect{}
+		}
+	}
 
-	return clear(source, dest, skip)
+	if c.Bool("explain") {
+		if settings.Source == "" {
+			return fmt.Errorf("--explain needs a source, use --source or a profile")
+		}
+		opts, err := newOptions(settings)
+		if err != nil {
+			return err
+		}
+		return explain(settings.Source, opts, mode)
+	}
+	settings.Manifest = sync.ManifestPath(c, name, profile, mode)
+	return Run(settings, mode)
+}
+
+// Run removes the ads from the videos described by the adclear settings of a profile.
+func Run(settings config.Adclear, mode output.Mode) error {
+	if settings.Source == "" || settings.Dest == "" {
+		return fmt.Errorf("adclear needs a source and a destination, use --source and --dest or a profile")
+	}
+	opts, err := newOptions(settings)
+	if err != nil {
+		return err
+	}
+	return clear(settings.Source, settings.Dest, opts, mode)
 }
 
 // To ease testing
-func clear(source string, dest string, skip bool) error {
+func clear(source string, dest string, opts options, mode output.Mode) error {
 
-	// So we can monitor the progress of the file file writing
-	progressor := &filesystem.ProgressReadWriter{}
+	// So we can monitor the progress of ffmpeg and of the copies
 	ch := make(chan messages.ProgressMsg)
-	go progressor.GetProgress(ch)
-	//
 
-	vid, err := NewVideo(source, dest, skip, progressor)
+	// The manifest remembers which videos were processed already
+	var ledger *localsql.Sqldb
+	if opts.manifest != "" {
+		err := os.MkdirAll(filepath.Dir(opts.manifest), 0755)
+		if err != nil {
+			return err
+		}
+		// A sync or another clear on the same manifest has to wait for this one
+		l, err := lock.Acquire(opts.manifest)
+		if err != nil {
+			return err
+		}
+		defer l.Release()
+		ledger, err = localsql.InitDb(opts.manifest)
+		if err != nil {
+			return err
+		}
+		defer ledger.Close()
+	}
+
+	vid, err := NewVideo(source, dest, opts, ledger)
 	if err != nil {
 		return err
 	}
 	defer os.RemoveAll(vid.tempFolder)
+	vid.updates = ch
 
-	prog := tea.NewProgram(vid)
+	prog := output.NewProgram(vid, mode)
 	if vid.err != nil {
 		return vid.err
 	}
@@ -58,10 +196,20 @@ func clear(source string, dest string, skip bool) error {
 		}
 	}()
 
-	_, err = prog.Run()
+	final, err := prog.Run()
 	if err != nil {
 		return err
 	}
+	if m, ok := final.(VideoModel); ok && m.err != nil {
+		return m.err
+	}
+	if m, ok := final.(VideoModel); ok && len(m.failed) > 0 {
+		var errs []error
+		for _, f := range m.failed {
+			errs = append(errs, fmt.Errorf("%s: %w", f.File, f.Err))
+		}
+		return fmt.Errorf("%d of %d videos failed and were not copied, their sources are untouched: %w", len(m.failed), len(m.sources), errors.Join(errs...))
+	}
 
 	return nil
 }
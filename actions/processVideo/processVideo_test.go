@@ -1,11 +1,13 @@
 package processVideo
 
 import (
+	"cleansync/ffmpeg"
+	"cleansync/output"
 	"testing"
 )
 
 func TestClear(t *testing.T) {
-	err := clear("C:\\Users\\Steve\\Videos\\PlayOn\\The Big Bang Theory\\Season 11", "c:\\artifacts3", true)
+	err := clear("C:\\Users\\Steve\\Videos\\PlayOn\\The Big Bang Theory\\Season 11", "c:\\artifacts3", options{rules: []ffmpeg.ChapterRule{ffmpeg.SkipFirstRule(), ffmpeg.AdvertisementRule()}}, output.TUI)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,325 @@
+package processVideo
+
+import (
+	"cleansync/config"
+	"cleansync/ffmpeg"
+	"cleansync/messages"
+	"cleansync/output"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// options are the adclear settings the model works with.
+type options struct {
+	rules      []ffmpeg.ChapterRule  // decide which chapters are ads
+	detect     *ffmpeg.DetectOptions // nil unless breaks are detected in videos without chapters
+	cutlist    string                // used instead of the cut lists next to the videos
+	mergeCuts  bool                  // cut lists split the chapters instead of replacing them
+	cutMode    ffmpeg.CutMode
+	markBreaks bool // tag the chapters that follow a removed break
+	keep       ffmpeg.StreamSelection
+	transcode  *ffmpeg.TranscodeProfile // nil unless the output is re-encoded
+	tolerance  time.Duration            // how far the duration of the output may be off per kept stretch
+	decode     bool                     // decode the output before it is copied
+	jobs       int                      // videos processed at the same time
+	cutJobs    int                      // of those, videos cut, transcoded or verified at the same time
+	copyJobs   int                      // of those, videos copied at the same time
+	manifest   string                   // where processed videos are recorded, none when empty
+	force      bool                     // process videos that did not change since they were processed
+}
+
+func newOptions(settings config.Adclear) (options, error) {
+	opts := options{
+		cutlist:    settings.Cutlist,
+		markBreaks: settings.MarkBreaks,
+		keep:       ffmpeg.StreamSelection{AudioLanguages: settings.AudioLanguages, SubtitleLanguages: settings.SubtitleLanguages},
+		tolerance:  2 * time.Second,
+		decode:     settings.VerifyDecode,
+		manifest:   settings.Manifest,
+		force:      settings.Force,
+	}
+	switch strings.ToLower(settings.CutlistMode) {
+	case "", "replace":
+	case "merge":
+		opts.mergeCuts = true
+	default:
+		return opts, fmt.Errorf("unknown cut list mode %q, expected replace or merge", settings.CutlistMode)
+	}
+	err := setJobs(&opts, settings)
+	if err != nil {
+		return opts, err
+	}
+	err = setLength(&opts.tolerance, settings.VerifyTolerance)
+	if err != nil {
+		return opts, fmt.Errorf("verify_tolerance: %s", err)
+	}
+	opts.cutMode, err = ffmpeg.ParseCutMode(settings.CutMode)
+	if err != nil {
+		return opts, err
+	}
+	opts.rules, err = chapterRules(settings)
+	if err != nil {
+		return opts, err
+	}
+	if settings.Transcode != "" {
+		opts.transcode, err = transcodeProfile(settings.Transcode, settings.Transcodes)
+		if err != nil {
+			return opts, err
+		}
+	}
+	if settings.Detect != nil {
+		opts.detect, err = detectOptions(*settings.Detect)
+	}
+	return opts, err
+}
+
+// setJobs sets how many videos are processed at the same time, one unless the settings say
+// otherwise. The cut and copy stages are only limited further when their own limits are set.
+func setJobs(opts *options, settings config.Adclear) error {
+	if settings.Jobs < 0 || settings.CutJobs < 0 || settings.CopyJobs < 0 {
+		return fmt.Errorf("jobs, cut_jobs and copy_jobs cannot be negative")
+	}
+	opts.jobs = max(1, settings.Jobs)
+	opts.cutJobs, opts.copyJobs = opts.jobs, opts.jobs
+	if settings.CutJobs > 0 {
+		opts.cutJobs = min(settings.CutJobs, opts.jobs)
+	}
+	if settings.CopyJobs > 0 {
+		opts.copyJobs = min(settings.CopyJobs, opts.jobs)
+	}
+	return nil
+}
+
+// checkCutlist makes sure a cut list given for all videos is only used with one.
+func (o options) checkCutlist(sources []string) error {
+	if o.cutlist != "" && len(sources) > 1 {
+		return fmt.Errorf("--cutlist only works for a single video, %d were found, put a cut list next to each of them instead", len(sources))
+	}
+	return nil
+}
+
+// chapters readies the chapters of the video at source for the rules. A cut list, given or next to the
+// video, replaces or splits the chapters, and breaks are detected in videos that have no chapters. It
+// returns where the chapters came from, empty when they are the ones of the video.
+func (o options) chapters(vid *ffmpeg.Video, source string) (string, error) {
+	cutlist := o.cutlist
+	if cutlist == "" {
+		var err error
+		cutlist, err = ffmpeg.FindCutlist(source)
+		if err != nil {
+			return "", err
+		}
+	}
+	if cutlist != "" {
+		cuts, err := ffmpeg.ReadCutlist(cutlist)
+		if err != nil {
+			return "", err
+		}
+		err = vid.ApplyCuts(cuts, o.mergeCuts, filepath.Base(cutlist))
+		if err != nil {
+			return "", err
+		}
+		if o.mergeCuts {
+			return "the cut list " + cutlist + " merged with the chapters of the video", nil
+		}
+		return "the cut list " + cutlist, nil
+	}
+	if len(vid.Chapters) == 0 && o.detect != nil {
+		_, err := vid.DetectChapters(*o.detect)
+		if err != nil {
+			return "", err
+		}
+		return "black frames and silence", nil
+	}
+	return "", nil
+}
+
+// chapterRules builds the rules that decide which chapters are ads: skip_first, then the rules of
+// the settings in order, then the default rule for PlayOn's Advertisement chapters.
+func chapterRules(settings config.Adclear) ([]ffmpeg.ChapterRule, error) {
+	var res []ffmpeg.ChapterRule
+	if settings.SkipFirst {
+		res = append(res, ffmpeg.SkipFirstRule())
+	}
+	for i, c := range settings.Rules {
+		rule, err := chapterRuleFromConfig(c, fmt.Sprintf("rule %d", i+1))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, rule)
+	}
+	return append(res, ffmpeg.AdvertisementRule()), nil
+}
+
+// chapterRuleFromConfig converts a chapter rule of a profile.
+func chapterRuleFromConfig(c config.ChapterRule, source string) (ffmpeg.ChapterRule, error) {
+	r := ffmpeg.ChapterRule{Keep: c.Keep, Source: source}
+	var err error
+	if c.Title != "" {
+		r.Title, err = ffmpeg.CompileTitle(c.Title)
+		if err != nil {
+			return r, fmt.Errorf("%s: %s", source, err)
+		}
+	}
+	for _, err := range []error{setLength(&r.MinLength, c.MinLength), setLength(&r.MaxLength, c.MaxLength)} {
+		if err != nil {
+			return r, fmt.Errorf("%s: %s", source, err)
+		}
+	}
+	r.Position, err = ffmpeg.ParsePosition(c.Position)
+	if err != nil {
+		return r, fmt.Errorf("%s: %s", source, err)
+	}
+	if r.Title == nil && r.MinLength == 0 && r.MaxLength == 0 && r.Position == ffmpeg.AnyChapter {
+		return r, fmt.Errorf("%s has no condition, set title, min_length, max_length or position", source)
+	}
+	return r, nil
+}
+
+// detectOptions converts the detection settings of a profile.
+func detectOptions(c config.Detect) (*ffmpeg.DetectOptions, error) {
+	opts := ffmpeg.DefaultDetectOptions()
+	for _, err := range []error{
+		setLength(&opts.BlackMin, c.BlackMin),
+		setLength(&opts.SilenceMin, c.SilenceMin),
+		setLength(&opts.MaxSpot, c.MaxSpot),
+		setLength(&opts.MinBreak, c.MinBreak),
+		setLength(&opts.MaxBreak, c.MaxBreak),
+	} {
+		if err != nil {
+			return nil, fmt.Errorf("detect: %s", err)
+		}
+	}
+	if c.BlackThreshold != 0 {
+		opts.BlackThreshold = c.BlackThreshold
+	}
+	if opts.BlackThreshold < 0 || opts.BlackThreshold > 1 {
+		return nil, fmt.Errorf("detect: black_threshold has to be between 0 and 1, not %g", opts.BlackThreshold)
+	}
+	if c.SilenceNoise != "" {
+		opts.SilenceNoise = c.SilenceNoise
+	}
+	if opts.MinBreak > opts.MaxBreak {
+		return nil, fmt.Errorf("detect: min_break %s is longer than max_break %s", opts.MinBreak, opts.MaxBreak)
+	}
+	return &opts, nil
+}
+
+// transcodeProfile looks up the transcode profile called name, those of the config file win over the
+// built in ones.
+func transcodeProfile(name string, profiles map[string]config.Transcode) (*ffmpeg.TranscodeProfile, error) {
+	var p ffmpeg.TranscodeProfile
+	if c, ok := profiles[name]; ok {
+		p = ffmpeg.TranscodeProfile{
+			Name:         name,
+			Codec:        strings.ToLower(c.Codec),
+			CRF:          c.CRF,
+			Bitrate:      c.Bitrate,
+			Preset:       c.Preset,
+			AudioCodec:   c.AudioCodec,
+			AudioBitrate: c.AudioBitrate,
+			MaxHeight:    c.MaxHeight,
+		}
+	} else if builtin, ok := ffmpeg.TranscodeProfiles[name]; ok {
+		p = builtin
+	} else {
+		var names []string
+		for n := range ffmpeg.TranscodeProfiles {
+			names = append(names, n)
+		}
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("no transcode profile named %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	err := p.Check()
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// setLength parses a chapter length like 90s or 2m, a plain number is seconds. Empty leaves d alone.
+func setLength(d *time.Duration, s string) error {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		*d = time.Duration(secs * float64(time.Second))
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid chapter length %q, expected e.g. 90s or 2m", s)
+	}
+	*d = v
+	return nil
+}
+
+// explain lists the chapters of every video under source and which rule kept or removed each of them.
+// In plain and json mode every chapter is an event of the reporter.
+func explain(source string, opts options, mode output.Mode) error {
+	sources, err := getSources(source, "")
+	if err != nil {
+		return err
+	}
+	err = opts.checkCutlist(sources)
+	if err != nil {
+		return err
+	}
+	r := output.NewReporter(mode, os.Stdout)
+	for _, s := range sources {
+		vid, err := ffmpeg.Probe(s)
+		if err != nil {
+			return err
+		}
+		from, err := opts.chapters(&vid, s)
+		if err != nil {
+			return err
+		}
+		decisions := vid.Classify(opts.rules)
+		var about string
+		switch {
+		case len(decisions) == 0 && from != "":
+			about = fmt.Sprintf("nothing to cut according to %s, it is copied as is", from)
+		case len(decisions) == 0:
+			about = "has no chapters, it is copied as is"
+		case from != "":
+			about = fmt.Sprintf("chapters from %s", from)
+		}
+		if mode != output.TUI {
+			if about != "" {
+				r.Emit(output.Event{Type: output.EventChapter, File: s, Message: about})
+			}
+			for _, d := range decisions {
+				r.Report(messages.ChapterMsg{File: s, Index: d.Index, Start: d.Chapter.Start, End: d.Chapter.End, Title: d.Chapter.Title, Removed: d.Removed, From: from, Reason: d.Reason})
+			}
+			continue
+		}
+		fmt.Println(s)
+		if about != "" {
+			fmt.Println("  " + about)
+		}
+		for _, d := range decisions {
+			verdict := "kept"
+			if d.Removed {
+				verdict = "removed"
+			}
+			fmt.Printf("  %3d  %s-%s  %-30q %-8s %s\n", d.Index, timestamp(d.Chapter.Start), timestamp(d.Chapter.End), d.Chapter.Title, verdict, d.Reason)
+		}
+	}
+	return nil
+}
+
+// timestamp formats seconds as h:mm:ss.
+func timestamp(secs float64) string {
+	d := time.Duration(secs * float64(time.Second)).Round(time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
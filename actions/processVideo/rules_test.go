@@ -0,0 +1,177 @@
+package processVideo
+
+import (
+	"cleansync/config"
+	"cleansync/ffmpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChapterRules(t *testing.T) {
+	rules, err := chapterRules(config.Adclear{
+		SkipFirst: true,
+		Rules: []config.ChapterRule{
+			{Title: "^commercial$", MaxLength: "3m"},
+			{MinLength: "90", Position: "Last", Keep: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 4 {
+		t.Fatalf("expected skip_first, 2 rules and the default rule, got %d", len(rules))
+	}
+	if rules[0].Source != "skip_first" || rules[3].Source != ffmpeg.AdvertisementRule().Source {
+		t.Fatalf("expected skip_first first and the default rule last, got %s and %s", rules[0].Source, rules[3].Source)
+	}
+	if rules[1].Title == nil || !rules[1].Title.MatchString("Commercial") || rules[1].MaxLength != 3*time.Minute {
+		t.Fatalf("unexpected rule 1 %+v", rules[1])
+	}
+	if rules[2].MinLength != 90*time.Second || rules[2].Position != ffmpeg.LastChapter || !rules[2].Keep {
+		t.Fatalf("unexpected rule 2 %+v", rules[2])
+	}
+
+	for _, bad := range []config.ChapterRule{
+		{},
+		{Title: "(commercial"},
+		{MinLength: "soon"},
+		{Position: "middle"},
+	} {
+		if _, err := chapterRules(config.Adclear{Rules: []config.ChapterRule{bad}}); err == nil {
+			t.Fatalf("expected an error for %+v", bad)
+		}
+	}
+}
+
+func TestNewOptionsDetect(t *testing.T) {
+	opts, err := newOptions(config.Adclear{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.detect != nil {
+		t.Fatal("expected no detection without detect settings")
+	}
+
+	opts, err = newOptions(config.Adclear{Detect: &config.Detect{MaxSpot: "90s", SilenceNoise: "-60dB"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := ffmpeg.DefaultDetectOptions()
+	if opts.detect == nil || opts.detect.MaxSpot != 90*time.Second || opts.detect.SilenceNoise != "-60dB" || opts.detect.MinBreak != def.MinBreak {
+		t.Fatalf("unexpected detect options %+v", opts.detect)
+	}
+
+	for _, bad := range []config.Detect{
+		{BlackThreshold: 2},
+		{MinBreak: "10m"},
+		{BlackMin: "dark"},
+	} {
+		if _, err := newOptions(config.Adclear{Detect: &bad}); err == nil {
+			t.Fatalf("expected an error for %+v", bad)
+		}
+	}
+}
+
+func TestOptionsChapters(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "show.mkv")
+	err := os.WriteFile(filepath.Join(dir, "show.edl"), []byte("300 420 3\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := newOptions(config.Adclear{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vid := ffmpeg.Video{Duration: 1320, Chapters: []ffmpeg.Chapter{{Start: 0, End: 1320, Title: "Episode"}}}
+	from, err := opts.chapters(&vid, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(from, "show.edl") || len(vid.Chapters) != 3 || vid.Chapters[1].Title != "Advertisement" {
+		t.Fatalf("expected the cut list next to the video to replace the chapters, got %q %+v", from, vid.Chapters)
+	}
+
+	if _, err := newOptions(config.Adclear{CutlistMode: "append"}); err == nil {
+		t.Fatal("expected an error for an unknown cut list mode")
+	}
+	opts, err = newOptions(config.Adclear{Cutlist: filepath.Join(dir, "show.edl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.checkCutlist([]string{source, filepath.Join(dir, "other.mkv")}) == nil {
+		t.Fatal("expected an error for a cut list given for several videos")
+	}
+}
+
+func TestNewOptionsTranscode(t *testing.T) {
+	opts, err := newOptions(config.Adclear{Transcode: "hevc-1080p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.transcode == nil || opts.transcode.Codec != "hevc" || opts.transcode.MaxHeight != 1080 {
+		t.Fatalf("expected the built in hevc-1080p profile, got %+v", opts.transcode)
+	}
+
+	profiles := map[string]config.Transcode{"hevc-1080p": {Codec: "HEVC", CRF: 28}}
+	opts, err = newOptions(config.Adclear{Transcode: "hevc-1080p", Transcodes: profiles})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.transcode.CRF != 28 || opts.transcode.MaxHeight != 0 {
+		t.Fatalf("expected the profile of the config file to replace the built in one, got %+v", opts.transcode)
+	}
+
+	_, err = newOptions(config.Adclear{Transcode: "tiny", Transcodes: profiles})
+	if err == nil || !strings.Contains(err.Error(), "av1-720p") {
+		t.Fatalf("expected an error listing the profiles, got %v", err)
+	}
+	_, err = newOptions(config.Adclear{Transcode: "bad", Transcodes: map[string]config.Transcode{"bad": {Codec: "hevc"}}})
+	if err == nil {
+		t.Fatal("expected an error for a profile without crf or bitrate")
+	}
+}
+
+func TestNewOptionsVerify(t *testing.T) {
+	opts, err := newOptions(config.Adclear{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.tolerance != 2*time.Second || opts.decode {
+		t.Fatalf("expected a 2s tolerance without decoding, got %s %v", opts.tolerance, opts.decode)
+	}
+	opts, err = newOptions(config.Adclear{VerifyTolerance: "5", VerifyDecode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.tolerance != 5*time.Second || !opts.decode {
+		t.Fatalf("unexpected verify options %s %v", opts.tolerance, opts.decode)
+	}
+	if _, err := newOptions(config.Adclear{VerifyTolerance: "a bit"}); err == nil {
+		t.Fatal("expected an error for a tolerance that is not a duration")
+	}
+}
+
+func TestNewOptionsJobs(t *testing.T) {
+	opts, err := newOptions(config.Adclear{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.jobs != 1 || opts.cutJobs != 1 || opts.copyJobs != 1 {
+		t.Fatalf("expected one video at a time, got %d %d %d", opts.jobs, opts.cutJobs, opts.copyJobs)
+	}
+	opts, err = newOptions(config.Adclear{Jobs: 4, CopyJobs: 1, CutJobs: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.jobs != 4 || opts.cutJobs != 4 || opts.copyJobs != 1 {
+		t.Fatalf("expected 4 videos, 4 cuts and 1 copy at a time, got %d %d %d", opts.jobs, opts.cutJobs, opts.copyJobs)
+	}
+	_, err = newOptions(config.Adclear{CutJobs: -1})
+	if err == nil {
+		t.Fatal("expected an error for negative cut jobs")
+	}
+}
@@ -1,11 +1,14 @@
 package processVideo
 
 import (
-	"cleansync/filesystem"
+	"cleansync/ffmpeg"
+	"cleansync/localsql"
+	"cleansync/messages"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
@@ -14,20 +17,39 @@ import (
 )
 
 type VideoModel struct {
-	width          int
-	height         int
-	spinner        spinner.Model
-	progress       progress.Model
-	done           bool
-	currentProcess string
-	progressor     *filesystem.ProgressReadWriter
-	err            error
-	skipFirst      bool
-	dest           string
-	sources        []string
-	ndx            int
-	tempFolder     string
-	editedVideo    string
+	width      int
+	height     int
+	spinner    spinner.Model
+	progress   progress.Model
+	done       bool
+	err        error
+	opts       options
+	dest       string
+	sources    []string
+	index      map[string]int // of the sources
+	jobs       []job          // one for each source
+	next       int            // the next source to start
+	active     int            // videos started and not done yet
+	cutting    int            // videos removing ads, transcoding or verifying
+	copying    int            // videos being copied to the destination
+	finished   int            // videos copied to the destination
+	tempFolder string
+	failed     []messages.FileFailedMsg
+	skipped    []string                    // unchanged since they were processed
+	ledger     *localsql.Sqldb             // records the processed videos, nil without a manifest
+	updates    chan<- messages.ProgressMsg // progress of the ffmpeg commands and copies
+}
+
+// job is where a video is in the pipeline.
+type job struct {
+	status    Status
+	edited    string             // the video without the ads, in the temp folder
+	sidecars  []string           // subtitles that go next to it
+	expected  ffmpeg.Expectation // what the edited video should look like
+	cleaned   localsql.Cleaned   // what was cut, for the ledger
+	progress  float64
+	speed     float64
+	remaining time.Duration
 }
 
 const defaultWidth = 40
@@ -36,10 +58,12 @@ var supportedExtensions = []string{".mp4", ".mkv"}
 var (
 	doneStyle = lipgloss.NewStyle().Margin(1, 2)
 	checkMark = lipgloss.NewStyle().Foreground(lipgloss.Color("42")).SetString("✓")
+	crossMark = lipgloss.NewStyle().Foreground(lipgloss.Color("196")).SetString("✗")
 )
 
-// NewModel initializes and returns a new model
-func NewVideo(source string, dest string, skipFirst bool, progressor *filesystem.ProgressReadWriter) (*VideoModel, error) {
+// NewModel initializes and returns a new model. Videos the ledger has seen before are skipped
+// unless opts say otherwise.
+func NewVideo(source string, dest string, opts options, ledger *localsql.Sqldb) (*VideoModel, error) {
 	p := progress.New(
 		progress.WithDefaultGradient(),
 		progress.WithWidth(defaultWidth),
@@ -51,21 +75,38 @@ func NewVideo(source string, dest string, skipFirst bool, progressor *filesystem
 	if err != nil {
 		return nil, err
 	}
+	err = opts.checkCutlist(sources)
+	if err != nil {
+		return nil, err
+	}
+	var skipped []string
+	if ledger != nil && !opts.force {
+		sources, skipped, err = skipUnchanged(ledger, sources, dest, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	tmpFolder, err := os.MkdirTemp("", "cleansync")
 	if err != nil {
 		return nil, err
 	}
 
+	index := map[string]int{}
+	for ndx, source := range sources {
+		index[source] = ndx
+	}
 	vm := VideoModel{
 		spinner:    s,
 		progress:   p,
-		progressor: progressor,
-		skipFirst:  skipFirst,
+		opts:       opts,
 		dest:       dest,
 		sources:    sources,
+		index:      index,
+		jobs:       make([]job, len(sources)),
 		tempFolder: tmpFolder,
-		ndx:        0,
+		skipped:    skipped,
+		ledger:     ledger,
 	}
 
 	return &vm, nil
@@ -122,26 +163,46 @@ func getSources(source string, dest string) ([]string, error) {
 
 // Init is the entry point of the ui/program
 func (m VideoModel) Init() tea.Cmd {
-	return tea.Batch(m.ProcessVideoCmd(Starting, 0), m.spinner.Tick)
+	return tea.Batch(func() tea.Msg { return dispatchMsg{} }, m.spinner.Tick)
 }
 
 // View is the initial state of the ui
 func (m VideoModel) View() string {
 
-	// w := lipgloss.Width(fmt.Sprintf("%d", 1))
-
 	if m.done {
 		return doneStyle.Render("Done!")
 	}
 
-	spin := m.spinner.View() + " "
-	prog := m.progress.View()
-	cellsAvail := max(0, m.width-lipgloss.Width(spin+prog))
-	info := lipgloss.NewStyle().MaxWidth(cellsAvail).Render(m.currentProcess)
-	cellsRemaining := max(0, m.width-lipgloss.Width(spin+info+prog))
+	status := fmt.Sprintf("Processing %d of %d videos, %d done", m.active, len(m.sources), m.finished)
+	if len(m.failed) > 0 {
+		status += fmt.Sprintf(", %d failed", len(m.failed))
+	}
+	lines := []string{m.spinner.View() + " " + status}
+	for ndx, j := range m.jobs {
+		if j.status == Starting || j.status == Idle || j.status == Failed {
+			continue
+		}
+		lines = append(lines, m.row(filepath.Base(m.sources[ndx]), j))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// row shows a video in flight, its name, stage and progress.
+func (m VideoModel) row(name string, j job) string {
+	prog := m.progress.ViewAs(j.progress)
+	info := j.status.String()
+	if j.speed > 0 {
+		info += fmt.Sprintf(" %.1fx", j.speed)
+	}
+	if j.remaining > 0 {
+		info += fmt.Sprintf(" %s left", j.remaining)
+	}
+	cellsAvail := max(0, m.width-lipgloss.Width(prog+info)-4)
+	name = lipgloss.NewStyle().MaxWidth(cellsAvail).Render(name)
+	cellsRemaining := max(0, m.width-lipgloss.Width(name+info+prog)-4)
 	gap := strings.Repeat(" ", cellsRemaining)
 
-	return spin + info + gap + prog
+	return "  " + name + gap + " " + info + " " + prog
 }
 
 // max returns the larger of two integers.
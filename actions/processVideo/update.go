@@ -3,7 +3,6 @@ package processVideo
 import (
 	"cleansync/messages"
 
-	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -27,41 +26,78 @@ func (m VideoModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "ctrl+c", "esc", "q":
 			return m, tea.Quit
 		}
+	case dispatchMsg:
+		var cmds []tea.Cmd
+		for _, s := range m.skipped {
+			skipped := messages.FileSkippedMsg{File: s, Reason: "unchanged since it was processed, use --force to process it again"}
+			cmds = append(cmds, tea.Printf("%s Skipped unchanged file: %s", checkMark, s), func() tea.Msg { return skipped })
+		}
+		if len(m.sources) == 0 {
+			m.done = true
+			if len(m.skipped) == 0 {
+				cmds = append(cmds, tea.Printf("No videos found"))
+			}
+			return m, tea.Sequence(append(cmds, tea.Quit)...)
+		}
+		cmd := m.dispatch()
+		return m, tea.Batch(tea.Sequence(cmds...), cmd)
 	case ProcessVideoMessage:
-		// Process the video
-		if msg.err != nil {
-			m.SendError(msg.err)
-			return m, tea.Quit
+		j := &m.jobs[msg.ndx]
+		cmds := []tea.Cmd{tea.Printf("%s", msg.lastAction)}
+		if msg.transcoded != nil {
+			transcoded := *msg.transcoded
+			cmds = append(cmds, func() tea.Msg { return transcoded })
 		}
-		if msg.status == Completed {
+		var next tea.Cmd
+		if msg.failed != nil {
+			m.release(j.status)
+			j.status = Failed
+			failed := *msg.failed
+			m.failed = append(m.failed, failed)
+			cmds = append(cmds, func() tea.Msg { return failed })
+		} else {
+			j.edited = msg.tmpLocation
+			if msg.cleaned != nil {
+				j.cleaned = *msg.cleaned
+			}
+			j.sidecars = msg.sidecars
+			j.expected = msg.expected
+			switch msg.status {
+			case Transcoding, Verifying:
+				next = m.start(msg.status, msg.ndx)
+			case Waiting:
+				// the cut is done, the copy starts when there is room for it
+				j.status = Waiting
+				m.cutting--
+			case Idle:
+				j.status = Idle
+				m.copying--
+				m.active--
+				m.finished++
+				cmds = append(cmds, m.statusCmd(Idle, msg.ndx))
+			}
+		}
+		if m.finished+len(m.failed) == len(m.sources) {
 			m.done = true
-			return m, tea.Batch(tea.Printf("Done processing file: %s", m.sources[m.ndx]), tea.Quit)
+			cmds = append(cmds, tea.Printf("Done processing %d videos", len(m.sources)), tea.Quit)
+			return m, tea.Sequence(cmds...)
 		}
-		// Main Loop
-		m.ndx = msg.ndx
-		m.editedVideo = msg.tmpLocation
-
-		m.currentProcess = msg.nextAction
-		return m, tea.Sequence(tea.Printf(msg.lastAction), m.ProcessVideoCmd(msg.status, m.ndx))
-	case CleanTmpMsg:
-		// All Donewinter
-		return m, tea.Batch(tea.Printf("Done processing file: %s", m.sources[m.ndx]), tea.Quit)
+		// dispatch changes m, it has to run before m is returned
+		cmd := m.dispatch()
+		return m, tea.Batch(tea.Sequence(cmds...), next, cmd)
 	case messages.ErrMsg:
-		// handle errorI guess
-		return m, tea.Quit
+		m.err = msg
+		return m, tea.Sequence(tea.Printf("Error: %s", msg.Error()), tea.Quit)
 	case messages.ProgressMsg:
-		progressCmd := m.progress.SetPercent(msg.Progress)
-		return m, tea.Batch(progressCmd)
+		if ndx, ok := m.index[msg.File]; ok {
+			j := &m.jobs[ndx]
+			j.progress, j.speed, j.remaining = msg.Progress, msg.Speed, msg.Remaining
+		}
+		return m, nil
 	case spinner.TickMsg:
 		var cmd tea.Cmd
 		m.spinner, cmd = m.spinner.Update(msg)
 		return m, tea.Batch(cmd)
-	case progress.FrameMsg:
-		newModel, cmd := m.progress.Update(msg)
-		if newModel, ok := newModel.(progress.Model); ok {
-			m.progress = newModel
-		}
-		return m, cmd
 	}
 	return m, nil
 }
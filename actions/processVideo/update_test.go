@@ -0,0 +1,42 @@
+package processVideo
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDispatch(t *testing.T) {
+	m := VideoModel{
+		opts:    options{jobs: 3, cutJobs: 2, copyJobs: 1},
+		sources: []string{"a.mkv", "b.mkv", "c.mkv", "d.mkv"},
+		jobs:    make([]job, 4),
+	}
+	update := func(msg ProcessVideoMessage) {
+		model, _ := m.Update(msg)
+		m = model.(VideoModel)
+	}
+	m.dispatch()
+	if m.next != 2 || m.cutting != 2 || m.jobs[0].status != RemovingAds || m.jobs[2].status != Starting {
+		t.Fatalf("expected the first 2 videos to be cut, got %+v", m.jobs)
+	}
+
+	// both are cut, only one of them can be copied and a third video starts
+	update(ProcessVideoMessage{ndx: 0, status: Waiting, tmpLocation: "a.mkv"})
+	update(ProcessVideoMessage{ndx: 1, status: Waiting, tmpLocation: "b.mkv"})
+	if m.jobs[0].status != Uploading || m.jobs[1].status != Waiting || m.copying != 1 {
+		t.Fatalf("expected a single copy, got %+v", m.jobs)
+	}
+	if m.active != 3 || m.jobs[2].status != RemovingAds || m.jobs[3].status != Starting {
+		t.Fatalf("expected 3 videos in flight, got %+v", m.jobs)
+	}
+
+	update(failure(2, "c.mkv", errors.New("broken")))
+	if m.jobs[2].status != Failed || m.jobs[3].status != RemovingAds || m.cutting != 1 || len(m.failed) != 1 {
+		t.Fatalf("expected the last video to take the place of the failed one, got %+v", m.jobs)
+	}
+
+	update(ProcessVideoMessage{ndx: 0, status: Idle})
+	if m.jobs[1].status != Uploading || m.finished != 1 || m.active != 2 {
+		t.Fatalf("expected the second video to be copied, got %+v", m.jobs)
+	}
+}
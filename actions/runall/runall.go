@@ -0,0 +1,64 @@
+package runall
+
+import (
+	"cleansync/actions/processVideo"
+	"cleansync/actions/sync"
+	"cleansync/config"
+	"cleansync/output"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+// RunAll runs every profile in the config file. Profiles with adclear settings get their ads
+// removed first, profiles with a bucket are synced afterwards.
+// A failing profile does not stop the others, all errors are returned at the end.
+func RunAll(c *cli.Context) error {
+	mode, err := output.ParseMode(c.String("output"))
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Load(c.String("config"), true)
+	if err != nil {
+		return err
+	}
+	names := cfg.Names()
+	if len(names) == 0 {
+		return fmt.Errorf("no profiles in %s", c.String("config"))
+	}
+
+	var errs []error
+	for _, name := range names {
+		err := runProfile(c, name, cfg.Profiles[name], mode)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "profile %s failed: %s\n", name, err)
+			errs = append(errs, fmt.Errorf("profile %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func runProfile(c *cli.Context, name string, profile config.Profile, mode output.Mode) error {
+	if mode == output.TUI {
+		fmt.Printf("Running profile %s\n", name)
+	}
+	if profile.Adclear != nil {
+		settings := *profile.Adclear
+		settings.Manifest = sync.ManifestPath(c, name, profile, mode)
+		err := processVideo.Run(settings, mode)
+		if err != nil {
+			return err
+		}
+	}
+	if profile.Bucket == "" && len(profile.Destinations) == 0 {
+		return nil
+	}
+	opts, err := sync.OptionsFromProfile(profile)
+	if err != nil {
+		return err
+	}
+	opts.Manifest = sync.ManifestPath(c, name, profile, mode)
+	return sync.Run(c.Context, opts, mode)
+}
@@ -0,0 +1,262 @@
+package split
+
+import (
+	"cleansync/filesystem"
+	"cleansync/messages"
+	"cleansync/output"
+	"cleansync/splitter"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/urfave/cli/v2"
+)
+
+// Split cuts a file into parts named like the ones sync uploads, e.g. to carry it on a FAT32
+// drive, and writes a sidecar with the hashes join checks them against.
+func Split(c *cli.Context) error {
+	mode, err := output.ParseMode(c.String("output"))
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	positional, err := args(c)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	if len(positional) != 1 {
+		return cli.Exit("expected the file to split, e.g. cleansync split movie.mkv --size 2G", 1)
+	}
+	file := positional[0]
+	size, err := filesystem.ParseSize(c.String("size"))
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	if size <= 0 {
+		return cli.Exit("the part size has to be more than 0", 1)
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	if fi.IsDir() {
+		return cli.Exit(fmt.Sprintf("%s is a directory", file), 1)
+	}
+	out := filepath.Dir(file)
+	if c.IsSet("out") {
+		out = c.String("out")
+	}
+	err = os.MkdirAll(out, 0755)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+
+	prefix := filepath.Join(out, filepath.Base(file))
+	info := &splitter.SplitInfo{
+		OrgFilePath: file,
+		OrgFileSize: fi.Size(),
+		PartSize:    size,
+	}
+	for i := 0; i < splitter.PartCount(fi.Size(), size); i++ {
+		info.Parts = append(info.Parts, splitter.PartName(prefix, i))
+	}
+
+	r := newReporter(mode, file, fi.Size())
+	pw := &filesystem.ProgressReadWriter{}
+	var done int64
+	stop := r.watch(func() int64 { return atomic.LoadInt64(&done) + atomic.LoadInt64(&pw.Completed) })
+	for !info.Eof && len(info.Parts) > 0 {
+		_, err = splitter.SplitFile(info, pw)
+		if err != nil {
+			stop()
+			return r.fail(err)
+		}
+		atomic.StoreInt64(&done, info.Offset)
+		r.line("wrote", info.Parts[info.Index-1])
+	}
+	stop()
+
+	sc, err := info.Sidecar()
+	if err != nil {
+		return r.fail(err)
+	}
+	err = splitter.WriteSidecar(prefix, sc)
+	if err != nil {
+		return r.fail(err)
+	}
+	r.line("wrote", splitter.SidecarName(prefix))
+	r.done()
+	return nil
+}
+
+// Join puts parts back together, checking them against the sidecar split or sync wrote.
+func Join(c *cli.Context) error {
+	mode, err := output.ParseMode(c.String("output"))
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	positional, err := args(c)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	if len(positional) != 1 {
+		return cli.Exit("expected the prefix of the parts, e.g. cleansync join movie.mkv for movie.mkv.part0, movie.mkv.part1 ...", 1)
+	}
+	prefix := positional[0]
+	out := prefix
+	if c.IsSet("out") {
+		out = c.String("out")
+	}
+	if _, err := os.Stat(out); err == nil {
+		return cli.Exit(fmt.Sprintf("%s already exists, use --out to join the parts somewhere else", out), 1)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return cli.Exit(err, 1)
+	}
+
+	r := newReporter(mode, out, 0)
+	pw := &filesystem.ProgressReadWriter{}
+	stop := r.watch(func() int64 {
+		r.total = atomic.LoadInt64(&pw.Size)
+		return atomic.LoadInt64(&pw.Completed)
+	})
+	verified, err := splitter.JoinFile(prefix, out, pw)
+	stop()
+	if err != nil {
+		return r.fail(err)
+	}
+	if verified {
+		r.line("checked", splitter.SidecarName(prefix))
+	} else {
+		output.Warn(mode, fmt.Sprintf("there is no %s, the parts could not be checked", splitter.SidecarName(prefix)))
+	}
+	r.done()
+	return nil
+}
+
+// args returns the positional arguments. urfave/cli stops parsing flags at the first of them,
+// so flags that follow it, as in "split movie.mkv --size 4000MB", are applied here.
+func args(c *cli.Context) ([]string, error) {
+	var res []string
+	list := c.Args().Slice()
+	for i := 0; i < len(list); i++ {
+		a := list[i]
+		if len(a) < 2 || !strings.HasPrefix(a, "-") {
+			res = append(res, a)
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if !ok {
+			if i+1 >= len(list) {
+				return nil, fmt.Errorf("flag needs an argument: %s", a)
+			}
+			i++
+			value = list[i]
+		}
+		err := c.Set(name, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flag %s: %w", a, err)
+		}
+	}
+	return res, nil
+}
+
+// reporter shows the progress of split and join, as a bar on a terminal or as events.
+type reporter struct {
+	mu    sync.Mutex // progress comes from its own goroutine
+	mode  output.Mode
+	r     *output.Reporter
+	bar   progress.Model
+	file  string
+	total int64
+}
+
+func newReporter(mode output.Mode, file string, total int64) *reporter {
+	r := &reporter{
+		mode:  mode,
+		r:     output.NewReporter(mode, os.Stdout),
+		bar:   progress.New(progress.WithDefaultGradient(), progress.WithWidth(40)),
+		file:  file,
+		total: total,
+	}
+	if mode != output.TUI {
+		r.r.Report(messages.FileStartedMsg{File: file, Size: total})
+	}
+	return r
+}
+
+// watch reports the progress read from completed until the returned func is called.
+func (r *reporter) watch(completed func() int64) func() {
+	quit := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				n := completed()
+				if r.total > 0 {
+					r.progress(float64(n) / float64(r.total))
+				}
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-finished
+	}
+}
+
+func (r *reporter) progress(p float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mode == output.TUI {
+		fmt.Printf("\r%s", r.bar.ViewAs(p))
+		return
+	}
+	r.r.Report(messages.ProgressMsg{Progress: p})
+}
+
+// line reports a step, e.g. a part that was written.
+func (r *reporter) line(stage string, file string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mode == output.TUI {
+		fmt.Printf("\r\033[K%s %s\n", stage, file)
+		return
+	}
+	r.r.Report(messages.StageMsg{File: file, Stage: stage})
+}
+
+func (r *reporter) done() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mode == output.TUI {
+		fmt.Printf("\r\033[K✓ %s\n", r.file)
+		return
+	}
+	r.r.Report(messages.FileDoneMsg{File: r.file, Size: r.total})
+	r.r.Summary(nil)
+}
+
+// fail ends the report with err and returns an error that makes the command exit with 1
+// after printing err once, instead of a panic with a stack trace.
+func (r *reporter) fail(err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mode == output.TUI {
+		fmt.Print("\r\033[K")
+		return cli.Exit(err, 1)
+	}
+	// the summary already carries the error
+	r.r.Summary(err)
+	return cli.Exit("", 1)
+}
@@ -0,0 +1,302 @@
+package status
+
+import (
+	"cleansync/actions/sync"
+	"cleansync/config"
+	"cleansync/filesystem"
+	"cleansync/localsql"
+	"cleansync/output"
+	"cleansync/rules"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Summary is what status reports about a manifest.
+type Summary struct {
+	Manifest       string               `json:"manifest"`
+	Files          int                  `json:"files"`
+	Bytes          int64                `json:"bytes"`
+	Multipart      int                  `json:"multipart"`
+	Destinations   []DestinationSummary `json:"destinations"`
+	StorageClasses []ClassSummary       `json:"storage_classes"`
+}
+
+// DestinationSummary counts what has and has not been uploaded to one destination.
+type DestinationSummary struct {
+	Destination   string `json:"destination"`
+	Uploaded      int    `json:"uploaded"`
+	UploadedBytes int64  `json:"uploaded_bytes"`
+	Pending       int    `json:"pending"`
+	PendingBytes  int64  `json:"pending_bytes"`
+}
+
+// ClassSummary counts the uploads in one storage class, over every destination.
+type ClassSummary struct {
+	StorageClass string `json:"storage_class"`
+	Files        int    `json:"files"`
+	Bytes        int64  `json:"bytes"`
+}
+
+// Status prints the totals of the manifest.
+func Status(c *cli.Context) error {
+	mode, err := output.ParseMode(c.String("output"))
+	if err != nil {
+		return err
+	}
+	dbpath, err := manifestPath(c, mode)
+	if err != nil {
+		return err
+	}
+	entries, err := readEntries(dbpath)
+	if err != nil {
+		return err
+	}
+	summary := Summarize(entries)
+	summary.Manifest = dbpath
+	if mode == output.JSON {
+		return json.NewEncoder(os.Stdout).Encode(summary)
+	}
+	return printSummary(os.Stdout, summary)
+}
+
+// Ls lists the files in the manifest that match the pattern and the filters.
+func Ls(c *cli.Context) error {
+	mode, err := output.ParseMode(c.String("output"))
+	if err != nil {
+		return err
+	}
+	filter := Filter{
+		Pattern:   c.Args().First(),
+		Pending:   c.Bool("pending"),
+		Multipart: c.Bool("multipart"),
+	}
+	if c.IsSet("since") {
+		filter.Since, err = ParseSince(c.String("since"), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	dbpath, err := manifestPath(c, mode)
+	if err != nil {
+		return err
+	}
+	entries, err := readEntries(dbpath)
+	if err != nil {
+		return err
+	}
+	var matched []localsql.Entry
+	for _, e := range entries {
+		if filter.Match(e) {
+			matched = append(matched, e)
+		}
+	}
+	if mode == output.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range matched {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return printEntries(os.Stdout, matched)
+}
+
+// manifestPath returns the manifest of the --profile, or the one given with --db.
+func manifestPath(c *cli.Context, mode output.Mode) (string, error) {
+	name := c.String("profile")
+	profile := config.Profile{}
+	if name != "" {
+		cfg, err := config.Load(c.String("config"), c.IsSet("config"))
+		if err != nil {
+			return "", err
+		}
+		profile, err = cfg.Profile(name)
+		if err != nil {
+			return "", err
+		}
+	}
+	return sync.ManifestPath(c, name, profile, mode), nil
+}
+
+func readEntries(dbpath string) ([]localsql.Entry, error) {
+	db, err := localsql.OpenReadOnly(dbpath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return db.Entries()
+}
+
+// Summarize adds up the entries of a manifest.
+func Summarize(entries []localsql.Entry) Summary {
+	var s Summary
+	dests := make(map[string]*DestinationSummary)
+	classes := make(map[string]*ClassSummary)
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if !seen[e.Path] {
+			seen[e.Path] = true
+			s.Files++
+			s.Bytes += e.Size
+			if e.Multipart {
+				s.Multipart++
+			}
+		}
+		if e.Destination == "" && !e.Uploaded {
+			// nothing has been uploaded anywhere yet
+			continue
+		}
+		d, ok := dests[e.Destination]
+		if !ok {
+			d = &DestinationSummary{Destination: e.Destination}
+			dests[e.Destination] = d
+		}
+		if !e.Uploaded {
+			d.Pending++
+			d.PendingBytes += e.Size
+			continue
+		}
+		d.Uploaded++
+		d.UploadedBytes += e.Size
+		class := e.StorageClass
+		if class == "" {
+			class = "unknown"
+		}
+		cs, ok := classes[class]
+		if !ok {
+			cs = &ClassSummary{StorageClass: class}
+			classes[class] = cs
+		}
+		cs.Files++
+		cs.Bytes += e.Size
+	}
+	s.Destinations = []DestinationSummary{}
+	for _, d := range dests {
+		s.Destinations = append(s.Destinations, *d)
+	}
+	sort.Slice(s.Destinations, func(i, j int) bool { return s.Destinations[i].Destination < s.Destinations[j].Destination })
+	s.StorageClasses = []ClassSummary{}
+	for _, cs := range classes {
+		s.StorageClasses = append(s.StorageClasses, *cs)
+	}
+	sort.Slice(s.StorageClasses, func(i, j int) bool { return s.StorageClasses[i].StorageClass < s.StorageClasses[j].StorageClass })
+	return s
+}
+
+// Filter selects the entries ls lists.
+type Filter struct {
+	Pattern   string // a glob matched against the name or the whole path, or a plain substring of the path
+	Pending   bool
+	Multipart bool
+	Since     time.Time // only uploads at or after this time
+}
+
+// Match reports whether e passes the filter.
+func (f Filter) Match(e localsql.Entry) bool {
+	if f.Pending && e.Uploaded {
+		return false
+	}
+	if f.Multipart && !e.Multipart {
+		return false
+	}
+	if !f.Since.IsZero() && (!e.Uploaded || time.Unix(e.UploadedAt, 0).Before(f.Since)) {
+		return false
+	}
+	if f.Pattern == "" {
+		return true
+	}
+	pattern := strings.ToLower(f.Pattern)
+	p := strings.ToLower(e.Path)
+	if !strings.ContainsAny(pattern, "*?[") {
+		return strings.Contains(p, pattern)
+	}
+	if ok, _ := filepath.Match(pattern, filepath.Base(p)); ok {
+		return true
+	}
+	ok, _ := filepath.Match(pattern, p)
+	return ok
+}
+
+// ParseSince parses either an age like "7d" or "12h", counted back from now, or a date like 2024-01-31.
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	age, err := rules.ParseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q, use an age like 7d or a date like 2024-01-31", s)
+	}
+	return now.Add(-age), nil
+}
+
+func destinationName(d string) string {
+	if d == "" {
+		// uploads from before destinations were recorded
+		return "(unclaimed)"
+	}
+	return d
+}
+
+func printSummary(out io.Writer, s Summary) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Manifest\t%s\n", s.Manifest)
+	fmt.Fprintf(w, "Files\t%d (%s)\n", s.Files, filesystem.FormatSize(s.Bytes))
+	fmt.Fprintf(w, "Multipart\t%d\n", s.Multipart)
+	if len(s.Destinations) > 0 {
+		fmt.Fprintf(w, "\nDESTINATION\tUPLOADED\tPENDING\n")
+		for _, d := range s.Destinations {
+			fmt.Fprintf(w, "%s\t%d (%s)\t%d (%s)\n", destinationName(d.Destination),
+				d.Uploaded, filesystem.FormatSize(d.UploadedBytes), d.Pending, filesystem.FormatSize(d.PendingBytes))
+		}
+	}
+	if len(s.StorageClasses) > 0 {
+		fmt.Fprintf(w, "\nSTORAGE CLASS\tFILES\tSIZE\n")
+		for _, cs := range s.StorageClasses {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", cs.StorageClass, cs.Files, filesystem.FormatSize(cs.Bytes))
+		}
+	}
+	return w.Flush()
+}
+
+func printEntries(out io.Writer, entries []localsql.Entry) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "STATE\tUPLOADED\tSIZE\tPARTS\tCLASS\tDESTINATION\tKEY\tPATH\n")
+	for _, e := range entries {
+		state, uploaded, key, class := "pending", "-", "-", "-"
+		if e.Uploaded {
+			state = "uploaded"
+			if e.UploadedAt > 0 {
+				uploaded = time.Unix(e.UploadedAt, 0).Format("2006-01-02 15:04")
+			}
+			if e.Key != "" {
+				key = e.Key
+			}
+			if e.StorageClass != "" {
+				class = e.StorageClass
+			}
+		}
+		parts := "-"
+		if e.Multipart {
+			parts = fmt.Sprint(e.Parts)
+		}
+		dest := destinationName(e.Destination)
+		if e.Destination == "" && !e.Uploaded {
+			dest = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", state, uploaded, filesystem.FormatSize(e.Size), parts, class, dest, key, e.Path)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,72 @@
+package status
+
+import (
+	"cleansync/localsql"
+	"testing"
+	"time"
+)
+
+var entries = []localsql.Entry{
+	{Path: "tv/a.mkv", Size: 10, Destination: "deep/", Uploaded: true, UploadedAt: 100, StorageClass: "DEEP_ARCHIVE"},
+	{Path: "tv/a.mkv", Size: 10, Destination: "ia/", Uploaded: true, UploadedAt: 200, StorageClass: "STANDARD_IA"},
+	{Path: "tv/big.mkv", Size: 100, Multipart: true, Parts: 3, Destination: "deep/", Uploaded: true, UploadedAt: 300, StorageClass: "DEEP_ARCHIVE"},
+	{Path: "tv/big.mkv", Size: 100, Multipart: true, Parts: 3, Destination: "ia/"},
+}
+
+func TestSummarize(t *testing.T) {
+	s := Summarize(entries)
+	if s.Files != 2 || s.Bytes != 110 || s.Multipart != 1 {
+		t.Fatalf("Expected 2 files of 110 bytes, 1 multipart, got %+v", s)
+	}
+	if len(s.Destinations) != 2 {
+		t.Fatalf("Expected 2 destinations, got %+v", s.Destinations)
+	}
+	ia := s.Destinations[1]
+	if ia.Uploaded != 1 || ia.Pending != 1 || ia.PendingBytes != 100 {
+		t.Fatalf("Expected ia/ to have one file pending, got %+v", ia)
+	}
+	if len(s.StorageClasses) != 2 || s.StorageClasses[0].StorageClass != "DEEP_ARCHIVE" || s.StorageClasses[0].Bytes != 110 {
+		t.Fatalf("Expected 110 bytes in deep archive, got %+v", s.StorageClasses)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	for _, test := range []struct {
+		filter Filter
+		want   int
+	}{
+		{Filter{}, 4},
+		{Filter{Pending: true}, 1},
+		{Filter{Multipart: true}, 2},
+		{Filter{Since: time.Unix(200, 0)}, 2},
+		{Filter{Pattern: "BIG"}, 2},
+		{Filter{Pattern: "a.*"}, 2},
+		{Filter{Pattern: "tv/*.mkv"}, 4},
+	} {
+		got := 0
+		for _, e := range entries {
+			if test.filter.Match(e) {
+				got++
+			}
+		}
+		if got != test.want {
+			t.Fatalf("Expected %+v to match %d entries, got %d", test.filter, test.want, got)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 2, 10, 12, 0, 0, 0, time.Local)
+	since, err := ParseSince("7d", now)
+	if err != nil || !since.Equal(now.AddDate(0, 0, -7)) {
+		t.Fatalf("Expected a week before now, got %s %v", since, err)
+	}
+	since, err = ParseSince("2024-01-31", now)
+	if err != nil || !since.Equal(time.Date(2024, 1, 31, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("Expected the start of 2024-01-31, got %s %v", since, err)
+	}
+	_, err = ParseSince("yesterday", now)
+	if err == nil {
+		t.Fatal("Expected an error for an unknown --since")
+	}
+}
@@ -2,10 +2,13 @@ package sync
 
 import (
 	"bufio"
+	"bytes"
 	"cleansync/filesystem"
+	"cleansync/localsql"
 	"cleansync/messages"
 	"cleansync/splitter"
 	"context"
+	"io"
 	"os"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -14,108 +17,205 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-type errMsg struct{ err error }
-
-func (e errMsg) Error() string { return e.err.Error() }
-
-func (m *UploadModel) SendError(err error) tea.Cmd {
+func (m *UploadModel) SendError(file string, err error) tea.Cmd {
 	return func() tea.Msg {
-		return errMsg{err}
+		return messages.ErrMsg{File: file, Err: err}
 	}
 }
 
-func (m *UploadModel) splitCmd(info *splitter.SplitInfo) tea.Cmd {
-	if len(info.Parts) == 0 {
-		return func() tea.Msg {
-			return info
-		}
-	}
+// planSplitCmd lays out the parts of a file that is too big to upload in one piece.
+func (m *UploadModel) planSplitCmd(file string, size int64) tea.Cmd {
 	return func() tea.Msg {
-		res, err := splitter.SplitFile(info, m.progressor)
+		info, err := planSplit(m.db, file, size, m.partSize)
 		if err != nil {
-			return errMsg{err}
+			return messages.ErrMsg{File: file, Err: err}
 		}
-		return res
-
+		return info
 	}
 }
 
-func (m *UploadModel) uploadCmd(info *messages.UploadMsg) tea.Cmd {
+func (m *UploadModel) uploadCmd(info messages.UploadMsg) tea.Cmd {
 	return func() tea.Msg {
 		return info
 	}
 }
 
-// putObject actially performs the uploading to the S3 bucket for the file (path) specified by obj.
-// if deep is true, will put it in glacier deep storage.
-// Here is where the logic will live that will split files if they are too big
-func (m *UploadModel) PutObjectCmd(ctx context.Context) tea.Cmd {
+// PutObjectCmd starts the work on the file at ndx.
+// The model decides on receiving the FileStartedMsg if the file needs to be split first.
+func (m *UploadModel) PutObjectCmd(ctx context.Context, ndx int) tea.Cmd {
+	pkg := m.toUpdate[ndx]
+	return func() tea.Msg {
+		info, err := os.Stat(pkg)
+		if err != nil {
+			return messages.ErrMsg{File: pkg, Err: err}
+		}
+		return messages.FileStartedMsg{
+			File: pkg,
+			Size: info.Size(),
+		}
+	}
+}
 
+// uploadFileCmd uploads a file that is small enough to go up in one piece to t.
+func (m *UploadModel) uploadFileCmd(ctx context.Context, file string, size int64, t target) tea.Cmd {
 	return func() tea.Msg {
-		dmsg := messages.UploadMsg{
-			Done: false,
+		err := m.doUpload(ctx, t, file, objectKey(t, file), size, m.storageClass(t, file, size))
+		if err != nil {
+			return messages.ErrMsg{File: file, Err: err}
 		}
+		return messages.UploadedMsg{File: file, Size: size, Destination: t.Name()}
+	}
+}
 
-		return dmsg
+// fileDoneCmd reports that the file is on every destination.
+func (m *UploadModel) fileDoneCmd(file string, size int64) tea.Cmd {
+	return func() tea.Msg {
+		return messages.FileDoneMsg{File: file, Size: size}
 	}
 }
 
-func (m *UploadModel) doUpload(ctx context.Context, partFilePath string, pr *filesystem.ProgressReadWriter, fileSize int64) error {
-	f, err := os.Open(partFilePath)
+// objectKey is the key the file at localPath gets in the bucket of t.
+func objectKey(t target, localPath string) string {
+	return t.Prefix + filesystem.Localize(localPath)
+}
+
+// doUpload puts the file at localPath into the bucket of t under key with the storage class sc.
+func (m *UploadModel) doUpload(ctx context.Context, t target, localPath string, key string, size int64, sc types.StorageClass) error {
+	f, err := os.Open(localPath)
 	if err != nil {
 		return err
 	}
 
 	defer f.Close()
 
-	pr.Reader = bufio.NewReader(f)
+	return m.put(ctx, t, key, bufio.NewReaderSize(f, int(m.chunkSize)), size, sc)
+}
 
-	storageClass := types.StorageClassStandard
-	if m.deep {
-		storageClass = types.StorageClassDeepArchive
-	}
-	m.progressor.ResetProgress()
-	pr.Size = fileSize
-
-	_, err = m.s3Client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:        aws.String(m.bucket),
-		Key:           aws.String(filesystem.Localize(partFilePath)),
-		StorageClass:  storageClass,
-		Body:          pr,
-		ContentLength: &pr.Size,
+// put uploads size bytes from body to key in the bucket of t.
+func (m *UploadModel) put(ctx context.Context, t target, key string, body io.Reader, size int64, sc types.StorageClass) error {
+	_, err := t.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(t.Bucket),
+		Key:           aws.String(key),
+		StorageClass:  sc,
+		Body:          m.limiter.Reader(m.progressor.Track(body)),
+		ContentLength: &size,
 	})
-	if err != nil {
-		return err
+	return err
+}
+
+// uploadedParts counts the parts of the split file that are on t already, e.g. from before the run was interrupted.
+func (m *UploadModel) uploadedParts(info *splitter.SplitInfo, t target) (int, error) {
+	n := 0
+	for _, part := range info.Parts {
+		done, err := m.db.PartUploaded(part, t.Name())
+		if err != nil {
+			return 0, err
+		}
+		if done {
+			n++
+		}
 	}
-	return nil
+	return n, nil
 }
 
-func (m *UploadModel) uploadParts(ctx context.Context, orgFile string, parts []string, i int) tea.Cmd {
+// uploadParts uploads part i of the split file to t, read straight from the original file.
+// Parts that already went to t are skipped. Once all parts are there the sidecar listing them follows.
+func (m *UploadModel) uploadParts(ctx context.Context, info *splitter.SplitInfo, i int, t target) tea.Cmd {
+	orgFile := info.OrgFilePath
 	return func() tea.Msg {
-		if i >= len(parts) {
-			return errMsg{}
-		}
-		if len(parts) > 0 {
-			f, err := os.Open(parts[i])
+		for ; i < len(info.Parts); i++ {
+			done, err := m.db.PartUploaded(info.Parts[i], t.Name())
 			if err != nil {
-				return errMsg{err}
+				return messages.ErrMsg{File: orgFile, Err: err}
+			}
+			if !done {
+				break
 			}
-			info, err := f.Stat()
+			_, size := info.Section(i)
+			m.progressor.Skip(size)
+		}
+
+		f, err := os.Open(orgFile)
+		if err != nil {
+			return messages.ErrMsg{File: orgFile, Err: err}
+		}
+		defer f.Close()
+
+		if i >= len(info.Parts) {
+			err = m.putSidecar(ctx, info, f, t)
 			if err != nil {
-				return errMsg{err}
+				return messages.ErrMsg{File: orgFile, Err: err}
 			}
+			return messages.UploadedMsg{File: orgFile, Parts: info.Parts, Size: info.OrgFileSize, Destination: t.Name()}
+		}
 
-			err = m.doUpload(ctx, parts[i], m.progressor, info.Size())
+		known := info.Hashes[i]
+		offset, size := info.Section(i)
+		part := info.ReadPart(f, i)
+
+		// every part gets the class the whole file would have had
+		err = m.put(ctx, t, partKey(t, orgFile, i), bufio.NewReaderSize(part, int(m.chunkSize)), size, m.storageClass(t, orgFile, info.OrgFileSize))
+		if err != nil {
+			return messages.ErrMsg{File: orgFile, Err: err}
+		}
+		// the other destinations have to get the same bytes
+		sum, err := part.Done()
+		if err != nil {
+			return messages.ErrMsg{File: orgFile, Err: err}
+		}
+		if known == "" {
+			err = m.db.RecordPart(info.VideoID, localsql.Part{Index: i, Path: info.Parts[i], Offset: offset, Size: size, Hash: sum})
 			if err != nil {
-				return errMsg{err}
+				return messages.ErrMsg{File: orgFile, Err: err}
 			}
 		}
+		err = m.db.UpdatePartUpload(info.Parts[i], t.Name())
+		if err != nil {
+			return messages.ErrMsg{File: orgFile, Err: err}
+		}
 
-		uploadPartsM := messages.UploadPartsMsg{
+		return messages.UploadPartsMsg{
 			OriginalFile: orgFile,
-			Parts:        parts,
+			Parts:        info.Parts,
 			Index:        i,
+			Size:         size,
+			Destination:  t.Name(),
 		}
-		return uploadPartsM
 	}
 }
+
+// putSidecar uploads the sidecar that lists the parts of the file next to them. It is small and
+// needed first on a restore, so it always goes up as STANDARD.
+func (m *UploadModel) putSidecar(ctx context.Context, info *splitter.SplitInfo, f *os.File, t target) error {
+	// parts an earlier run uploaded have not been read in this one
+	known := info.Hash != ""
+	err := info.Complete(f)
+	if err != nil {
+		return err
+	}
+	if !known {
+		err = m.db.RecordSplitHash(info.VideoID, info.Hash)
+		if err != nil {
+			return err
+		}
+	}
+	sc, err := info.Sidecar()
+	if err != nil {
+		return err
+	}
+	for i := range sc.Parts {
+		sc.Parts[i].Key = partKey(t, info.OrgFilePath, i)
+	}
+	b, err := sc.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = t.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(t.Bucket),
+		Key:          aws.String(sidecarKey(t, info.OrgFilePath)),
+		StorageClass: types.StorageClassStandard,
+		ContentType:  aws.String("application/json"),
+		Body:         bytes.NewReader(b),
+	})
+	return err
+}
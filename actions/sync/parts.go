@@ -0,0 +1,78 @@
+package sync
+
+import (
+	"cleansync/localsql"
+	"cleansync/splitter"
+	"os"
+	"strings"
+)
+
+// partKey is the key part i of the file at orgFile gets in the bucket of t, next to where the
+// whole file would go so files with the same name in different folders keep their parts apart.
+func partKey(t target, orgFile string, i int) string {
+	return splitter.PartName(objectKey(t, orgFile), i)
+}
+
+// sidecarKey is the key of the sidecar that lists the parts of the file at orgFile in the bucket of t.
+func sidecarKey(t target, orgFile string) string {
+	return splitter.SidecarName(objectKey(t, orgFile))
+}
+
+// planSplit lays out the parts of the file and records them in the manifest. The layout of an
+// earlier run is kept as long as it splits the file the same way, so the parts it uploaded
+// and their hashes still count.
+func planSplit(db *localsql.Sqldb, file string, size int64, partSize int64) (*splitter.SplitInfo, error) {
+	id, err := db.SetMultipart(file)
+	if err != nil {
+		return nil, err
+	}
+	info := splitter.Layout(file, size, partSize)
+	info.VideoID = id
+
+	recorded, err := db.Parts(id)
+	if err != nil {
+		return nil, err
+	}
+	same := len(recorded) == len(info.Parts)
+	for i := 0; same && i < len(recorded); i++ {
+		offset, n := info.Section(i)
+		r := recorded[i]
+		same = r.Index == i && r.Path == info.Parts[i] && r.Offset == offset && r.Size == n
+	}
+	if same {
+		for i, r := range recorded {
+			info.Hashes[i] = r.Hash
+		}
+		info.Hash, err = db.SplitHash(id)
+		return info, err
+	}
+	if len(recorded) > 0 {
+		err = db.ResetParts(id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range info.Parts {
+		offset, n := info.Section(i)
+		err = db.RecordPart(id, localsql.Part{Index: i, Path: info.Parts[i], Offset: offset, Size: n})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// cleanStaleParts removes the part files older versions wrote to disk before uploading them.
+// Parts are read straight from the original file now, so none of them are needed anymore.
+func cleanStaleParts(db *localsql.Sqldb) error {
+	recorded, err := db.PartFiles()
+	if err != nil {
+		return err
+	}
+	for part, video := range recorded {
+		if !strings.HasPrefix(part, video+".part") {
+			os.Remove(part)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package sync
+
+import (
+	"cleansync/filesystem"
+	"cleansync/localsql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanSplitKeepsLayout(t *testing.T) {
+	dir := t.TempDir()
+	db, err := localsql.InitDb(filepath.Join(dir, "manifest.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	org := filepath.Join(dir, "video.mkv")
+	err = db.UpdateManifest(map[string]localsql.File{org: {Modified: 1, Size: 250}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := planSplit(db, org, 250, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Parts) != 3 || info.Parts[2] != org+".part2" || info.Sizes[2] != 50 {
+		t.Fatalf("Expected parts of 100, 100 and 50 bytes, got %v %v", info.Parts, info.Sizes)
+	}
+	if _, err := os.Stat(info.Parts[0]); !os.IsNotExist(err) {
+		t.Fatal("Expected no part to be written to disk")
+	}
+
+	// an interrupted run that uploaded the first part
+	err = db.RecordPart(info.VideoID, localsql.Part{Index: 0, Path: info.Parts[0], Size: 100, Hash: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.UpdatePartUpload(info.Parts[0], "b/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.RecordSplitHash(info.VideoID, "whole")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := planSplit(db, org, 250, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Hashes[0] != "abc" || resumed.Hash != "whole" {
+		t.Fatalf("Expected the hashes of the part and the whole file to be kept, got %v %q", resumed.Hashes, resumed.Hash)
+	}
+	m := UploadModel{db: db}
+	if n, _ := m.uploadedParts(resumed, target{Destination: Destination{Bucket: "b"}}); n != 1 {
+		t.Fatalf("Expected 1 part on b/ already, got %d", n)
+	}
+
+	// split differently, everything has to go again
+	other, err := planSplit(db, org, 250, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other.Parts) != 2 || other.Hashes[0] != "" || other.Hash != "" {
+		t.Fatalf("Expected a fresh layout of 2 parts, got %v %v %q", other.Parts, other.Hashes, other.Hash)
+	}
+	if again, _ := planSplit(db, org, 250, 200); again.Hash != "" {
+		t.Fatalf("Expected the hash of the whole file to be forgotten with the old layout, got %q", again.Hash)
+	}
+	if n, _ := m.uploadedParts(other, target{Destination: Destination{Bucket: "b"}}); n != 0 {
+		t.Fatalf("Expected no parts on b/ after the layout changed, got %d", n)
+	}
+}
+
+func TestCleanStaleParts(t *testing.T) {
+	dir := t.TempDir()
+	db, err := localsql.InitDb(filepath.Join(dir, "manifest.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	org := filepath.Join(dir, "video.mkv")
+	err = db.UpdateManifest(map[string]localsql.File{org: {Modified: 1, Size: 250}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := db.SetMultipart(org)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// what older versions split to disk, next to a file that happens to look like a part
+	old := filepath.Join(dir, "tmp", "video.mkv.part0")
+	os.MkdirAll(filepath.Dir(old), 0755)
+	os.WriteFile(old, []byte("x"), 0644)
+	os.WriteFile(org+".part0", []byte("y"), 0644)
+	err = db.RecordPart(id, localsql.Part{Path: old})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.RecordPart(id, localsql.Part{Path: org + ".part0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cleanStaleParts(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatal("Expected the part split to disk to be removed")
+	}
+	if _, err := os.Stat(org + ".part0"); err != nil {
+		t.Fatal("Expected files next to the original to be left alone")
+	}
+}
+
+func TestPartKeysOfSameNamedFiles(t *testing.T) {
+	dest := target{Destination: Destination{Prefix: "tv/"}}
+	a := partKey(dest, filepath.Join("shows", "a", "movie.mkv"), 0)
+	b := partKey(dest, filepath.Join("shows", "b", "movie.mkv"), 0)
+	if a == b {
+		t.Fatalf("Expected the parts of files in different folders to get different keys, both got %s", a)
+	}
+	if want := "tv/" + filesystem.Localize(filepath.Join("shows", "a", "movie.mkv")) + ".part0"; a != want {
+		t.Fatalf("Expected %s, got %s", want, a)
+	}
+	if want := a[:len(a)-len(".part0")] + ".parts.json"; sidecarKey(dest, filepath.Join("shows", "a", "movie.mkv")) != want {
+		t.Fatalf("Expected the sidecar next to the parts at %s", want)
+	}
+}
+
+func TestValidateSplit(t *testing.T) {
+	o := Options{}
+	err := o.validateSplit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.PartSize != 2<<30 || o.SplitThreshold != 4<<30 || o.ChunkSize != 16<<20 {
+		t.Fatalf("Expected the defaults, got %+v", o)
+	}
+	for _, o := range []Options{{PartSize: 6 << 30}, {SplitThreshold: 6 << 30}, {PartSize: 1 << 20, ChunkSize: 2 << 20}} {
+		if err := o.validateSplit(); err == nil {
+			t.Fatalf("Expected %+v to be refused", o)
+		}
+	}
+}
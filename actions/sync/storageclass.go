@@ -0,0 +1,139 @@
+package sync
+
+import (
+	"cleansync/config"
+	"cleansync/filesystem"
+	"cleansync/rules"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// StorageClasses are the classes files can be uploaded with.
+var StorageClasses = []types.StorageClass{
+	types.StorageClassStandard,
+	types.StorageClassStandardIa,
+	types.StorageClassOnezoneIa,
+	types.StorageClassIntelligentTiering,
+	types.StorageClassGlacierIr,
+	types.StorageClassGlacier,
+	types.StorageClassDeepArchive,
+}
+
+// parseStorageClass checks s against StorageClasses, case insensitively.
+func parseStorageClass(s string) (types.StorageClass, error) {
+	sc := types.StorageClass(strings.ToUpper(strings.TrimSpace(s)))
+	if !validStorageClass(sc) {
+		names := make([]string, len(StorageClasses))
+		for i, c := range StorageClasses {
+			names[i] = string(c)
+		}
+		return "", fmt.Errorf("unknown storage class %q, expected one of %s", s, strings.Join(names, ", "))
+	}
+	return sc, nil
+}
+
+func validStorageClass(sc types.StorageClass) bool {
+	for _, v := range StorageClasses {
+		if v == sc {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassRule uploads the files it matches with its own storage class instead of the one of the destination.
+// All conditions that are set have to hold.
+type ClassRule struct {
+	StorageClass types.StorageClass
+	MinSize      int64       // at least this many bytes
+	MaxSize      int64       // at most this many bytes
+	Pattern      *rules.Rule // gitignore style, relative to the source path
+}
+
+// ParseClassRule parses the --class-rule flag, CLASS:CONDITION where the condition is
+// <SIZE, >SIZE or a glob: "GLACIER_IR:<1GB", "STANDARD:*.nfo".
+func ParseClassRule(s string) (ClassRule, error) {
+	class, cond, ok := strings.Cut(s, ":")
+	if !ok || strings.TrimSpace(cond) == "" {
+		return ClassRule{}, fmt.Errorf("invalid class rule %q, expected CLASS:<SIZE, CLASS:>SIZE or CLASS:PATTERN", s)
+	}
+	sc, err := parseStorageClass(class)
+	if err != nil {
+		return ClassRule{}, err
+	}
+	r := ClassRule{StorageClass: sc}
+	cond = strings.TrimSpace(cond)
+	switch {
+	case strings.HasPrefix(cond, "<"):
+		r.MaxSize, err = filesystem.ParseSize(cond[1:])
+	case strings.HasPrefix(cond, ">"):
+		r.MinSize, err = filesystem.ParseSize(cond[1:])
+	default:
+		r.Pattern, err = classPattern(cond, s)
+	}
+	return r, err
+}
+
+// classRuleFromConfig converts a storage rule of a profile.
+func classRuleFromConfig(c config.StorageRule) (ClassRule, error) {
+	sc, err := parseStorageClass(c.StorageClass)
+	if err != nil {
+		return ClassRule{}, err
+	}
+	r := ClassRule{StorageClass: sc}
+	for _, err := range []error{setSize(&r.MinSize, c.MinSize), setSize(&r.MaxSize, c.MaxSize)} {
+		if err != nil {
+			return r, err
+		}
+	}
+	if c.Pattern != "" {
+		r.Pattern, err = classPattern(c.Pattern, "storage rule "+c.StorageClass)
+		if err != nil {
+			return r, err
+		}
+	}
+	if r.MinSize == 0 && r.MaxSize == 0 && r.Pattern == nil {
+		return r, fmt.Errorf("the storage rule for %s has no condition, set min_size, max_size or pattern", c.StorageClass)
+	}
+	return r, nil
+}
+
+func classPattern(pattern string, source string) (*rules.Rule, error) {
+	rule, ok := rules.ParseRule(pattern, "", source)
+	if !ok {
+		return nil, fmt.Errorf("invalid pattern %q", pattern)
+	}
+	return &rule, nil
+}
+
+// matches reports whether the rule applies to the file p of size bytes below root.
+func (r ClassRule) matches(root string, p string, size int64) bool {
+	if r.MinSize > 0 && size < r.MinSize {
+		return false
+	}
+	if r.MaxSize > 0 && size > r.MaxSize {
+		return false
+	}
+	return r.Pattern == nil || r.Pattern.Match(root, p, false)
+}
+
+// storageClass is the class the file p of size bytes is uploaded to t with, the first
+// class rule that matches wins over the class of the destination.
+func (m *UploadModel) storageClass(t target, p string, size int64) types.StorageClass {
+	root := ""
+	for _, r := range m.roots {
+		if rel, err := filepath.Rel(r, p); err == nil && !strings.HasPrefix(rel, "..") {
+			root = r
+			break
+		}
+	}
+	for _, r := range m.classRules {
+		if r.matches(root, p, size) {
+			return r.StorageClass
+		}
+	}
+	return t.StorageClass
+}
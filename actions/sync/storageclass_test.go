@@ -0,0 +1,40 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestClassRules(t *testing.T) {
+	small, err := ParseClassRule("glacier_ir:<1GB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs, err := ParseClassRule("STANDARD:*.srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := UploadModel{roots: []string{"/tv"}, classRules: []ClassRule{subs, small}}
+	deep := target{Destination: Destination{StorageClass: types.StorageClassDeepArchive}}
+
+	for _, test := range []struct {
+		file string
+		size int64
+		want types.StorageClass
+	}{
+		{"/tv/show/e1.mkv", 4 << 30, types.StorageClassDeepArchive},
+		{"/tv/show/e1.mkv", 500 << 20, types.StorageClassGlacierIr},
+		{"/tv/show/e1.en.srt", 4 << 30, types.StorageClassStandard},
+	} {
+		if got := m.storageClass(deep, test.file, test.size); got != test.want {
+			t.Fatalf("Expected %s of %d bytes to go to %s, got %s", test.file, test.size, test.want, got)
+		}
+	}
+
+	for _, bad := range []string{"GLACIER_IR", "NEARLINE:<1GB", "GLACIER_IR:<lots"} {
+		if _, err := ParseClassRule(bad); err == nil {
+			t.Fatalf("Expected an error for the class rule %q", bad)
+		}
+	}
+}
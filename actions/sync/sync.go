@@ -1,58 +1,455 @@
 package sync
 
 import (
+	"cleansync/config"
 	"cleansync/filesystem"
 	"cleansync/localsql"
+	"cleansync/lock"
 	"cleansync/messages"
+	"cleansync/output"
+	"cleansync/rules"
+	"cleansync/splitter"
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	tea "github.com/charmbracelet/bubbletea"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/urfave/cli/v2"
 )
 
+// Options holds everything a sync run needs, merged from the profile and the command line.
+type Options struct {
+	Manifest     string
+	Paths        []string
+	Destinations []Destination
+	Filters      []string
+	Includes     []string
+	Excludes     []string
+	MinSize      int64
+	MaxSize      int64
+	MinAge       time.Duration
+	MaxAge       time.Duration
+	Concurrency  int
+	RateLimit    int64       // bytes per second, 0 for no limit
+	ClassRules   []ClassRule // checked in order before the storage class of the destination
+	// Files over SplitThreshold are uploaded in parts of PartSize, the defaults come from the splitter package.
+	PartSize       int64
+	SplitThreshold int64
+	ChunkSize      int64 // read buffer for the uploads
+}
+
+// Destination is a bucket (and prefix within it) that the sources are uploaded to.
+type Destination struct {
+	Bucket       string
+	Region       string // empty to use the region of the aws config
+	Prefix       string
+	StorageClass types.StorageClass
+}
+
+// Name identifies the destination in the manifest.
+func (d Destination) Name() string {
+	return d.Bucket + "/" + d.Prefix
+}
+
 func Sync(c *cli.Context) error {
+	mode, err := output.ParseMode(c.String("output"))
+	if err != nil {
+		return err
+	}
+
+	opts := Options{}
+	name := c.String("profile")
+	profile := config.Profile{}
+	if name != "" {
+		cfg, err := config.Load(c.String("config"), c.IsSet("config"))
+		if err != nil {
+			return err
+		}
+		profile, err = cfg.Profile(name)
+		if err != nil {
+			return err
+		}
+		opts, err = OptionsFromProfile(profile)
+		if err != nil {
+			return err
+		}
+	}
+	opts.Manifest = ManifestPath(c, name, profile, mode)
+	err = opts.applyFlags(c)
+	if err != nil {
+		return err
+	}
+
+	if c.IsSet("explain") {
+		return explain(opts, c.String("explain"), mode)
+	}
+	return Run(c.Context, opts, mode)
+}
 
-	bucket := c.String("bucket")
-	folderPath := c.String("path")
-	filters := c.StringSlice("filter")
-	deep := c.Bool("deep")
+// ManifestPath returns the manifest for the profile called name, see config.ManifestPath.
+// It warns when an old manifest in the working directory is used.
+func ManifestPath(c *cli.Context, name string, profile config.Profile, mode output.Mode) string {
+	p, legacy := config.ManifestPath(c.String("db"), name, profile)
+	if legacy {
+		output.Warn(mode, fmt.Sprintf("using %s from the working directory, move it to %s or point --db at it", p, config.DefaultManifest(name)))
+	}
+	return p
+}
+
+// ruleSet builds the rules that decide which files under the source paths are synced.
+func (o *Options) ruleSet() *rules.Set {
+	set := rules.New(o.Filters, o.Includes, o.Excludes)
+	set.MinSize = o.MinSize
+	set.MaxSize = o.MaxSize
+	set.MinAge = o.MinAge
+	set.MaxAge = o.MaxAge
+	return set
+}
 
-	ctx := c.Context
-	client, err := getAwsClient(ctx)
+// explain prints whether the file at p would be synced and which rule decided it.
+func explain(opts Options, p string, mode output.Mode) error {
+	p, err := filepath.Abs(p)
 	if err != nil {
 		return err
 	}
+	set := opts.ruleSet()
+	decision := rules.Decision{Reason: "it is not below any of the source paths"}
+	for _, root := range opts.Paths {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(root, p); err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		decision, err = set.Explain(root, p)
+		if err != nil {
+			return err
+		}
+		break
+	}
 
-	db, err := localsql.InitDb("manifest.db")
+	if mode == output.JSON {
+		b, err := json.Marshal(map[string]interface{}{"path": p, "included": decision.Included, "reason": decision.Reason})
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	verdict := "excluded"
+	if decision.Included {
+		verdict = "included"
+	}
+	fmt.Printf("%s is %s: %s\n", p, verdict, decision.Reason)
+	return nil
+}
+
+// OptionsFromProfile converts the sync settings of a config profile.
+func OptionsFromProfile(p config.Profile) (Options, error) {
+	opts := Options{
+		Paths:       p.Paths,
+		Filters:     p.Filters,
+		Includes:    p.Include,
+		Excludes:    p.Exclude,
+		Concurrency: p.Concurrency,
+	}
+	for _, err := range []error{
+		setSize(&opts.MinSize, p.MinSize),
+		setSize(&opts.MaxSize, p.MaxSize),
+		setSize(&opts.RateLimit, p.RateLimit),
+		setSize(&opts.PartSize, p.PartSize),
+		setSize(&opts.SplitThreshold, p.SplitThreshold),
+		setSize(&opts.ChunkSize, p.ChunkSize),
+		setAge(&opts.MinAge, p.MinAge),
+		setAge(&opts.MaxAge, p.MaxAge),
+	} {
+		if err != nil {
+			return opts, err
+		}
+	}
+	if p.Bucket != "" {
+		opts.Destinations = append(opts.Destinations, Destination{
+			Bucket:       p.Bucket,
+			Prefix:       p.Prefix,
+			StorageClass: types.StorageClass(p.StorageClass),
+		})
+	}
+	for _, r := range p.StorageRules {
+		rule, err := classRuleFromConfig(r)
+		if err != nil {
+			return opts, err
+		}
+		opts.ClassRules = append(opts.ClassRules, rule)
+	}
+	for _, d := range p.Destinations {
+		dest := Destination{
+			Bucket:       d.Bucket,
+			Region:       d.Region,
+			Prefix:       d.Prefix,
+			StorageClass: types.StorageClass(d.StorageClass),
+		}
+		if dest.Prefix == "" {
+			dest.Prefix = p.Prefix
+		}
+		if dest.StorageClass == "" {
+			dest.StorageClass = types.StorageClass(p.StorageClass)
+		}
+		opts.Destinations = append(opts.Destinations, dest)
+	}
+	return opts, nil
+}
+
+// applyFlags overrides the options with everything that was given on the command line.
+// Buckets given as flags replace the destinations of the profile, --prefix and --storage-class apply to all of them.
+func (o *Options) applyFlags(c *cli.Context) error {
+	if c.IsSet("deep") && c.IsSet("storage-class") {
+		return fmt.Errorf("use either --deep or --storage-class")
+	}
+	if c.IsSet("path") {
+		o.Paths = c.StringSlice("path")
+	}
+	if c.IsSet("bucket") {
+		o.Destinations = nil
+		for _, bucket := range c.StringSlice("bucket") {
+			o.Destinations = append(o.Destinations, Destination{Bucket: bucket})
+		}
+	}
+	for i := range o.Destinations {
+		if c.IsSet("prefix") {
+			o.Destinations[i].Prefix = c.String("prefix")
+		}
+		if c.IsSet("storage-class") {
+			o.Destinations[i].StorageClass = types.StorageClass(c.String("storage-class"))
+		}
+		if c.IsSet("deep") {
+			o.Destinations[i].StorageClass = types.StorageClassStandard
+			if c.Bool("deep") {
+				o.Destinations[i].StorageClass = types.StorageClassDeepArchive
+			}
+		}
+	}
+	if c.IsSet("class-rule") {
+		o.ClassRules = nil
+		for _, s := range c.StringSlice("class-rule") {
+			rule, err := ParseClassRule(s)
+			if err != nil {
+				return err
+			}
+			o.ClassRules = append(o.ClassRules, rule)
+		}
+	}
+	if c.IsSet("filter") {
+		o.Filters = c.StringSlice("filter")
+	}
+	if c.IsSet("include") {
+		o.Includes = c.StringSlice("include")
+	}
+	if c.IsSet("exclude") {
+		o.Excludes = c.StringSlice("exclude")
+	}
+	for _, err := range []error{
+		setSize(&o.MinSize, c.String("min-size")),
+		setSize(&o.MaxSize, c.String("max-size")),
+		setAge(&o.MinAge, c.String("min-age")),
+		setAge(&o.MaxAge, c.String("max-age")),
+		setSize(&o.PartSize, c.String("part-size")),
+		setSize(&o.SplitThreshold, c.String("split-threshold")),
+		setSize(&o.ChunkSize, c.String("chunk-size")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	if c.IsSet("concurrency") {
+		o.Concurrency = c.Int("concurrency")
+	}
+	return setSize(&o.RateLimit, c.String("rate-limit"))
+}
+
+// setSize parses value into dest, an empty value leaves dest alone.
+func setSize(dest *int64, value string) error {
+	if value == "" {
+		return nil
+	}
+	size, err := filesystem.ParseSize(value)
+	if err != nil {
+		return err
+	}
+	*dest = size
+	return nil
+}
+
+// setAge parses value into dest, an empty value leaves dest alone.
+func setAge(dest *time.Duration, value string) error {
+	if value == "" {
+		return nil
+	}
+	age, err := rules.ParseAge(value)
+	if err != nil {
+		return err
+	}
+	*dest = age
+	return nil
+}
+
+// validate fills in defaults and checks that the options can be used for a run.
+func (o *Options) validate() error {
+	if len(o.Paths) == 0 {
+		return fmt.Errorf("no source path, use --path or a profile")
+	}
+	if len(o.Destinations) == 0 {
+		return fmt.Errorf("no bucket, use --bucket or a profile")
+	}
+	if o.Manifest == "" {
+		return fmt.Errorf("no manifest, use --db or a profile")
+	}
+	seen := make(map[string]bool)
+	for i := range o.Destinations {
+		d := &o.Destinations[i]
+		if d.Bucket == "" {
+			return fmt.Errorf("destination %d has no bucket", i+1)
+		}
+		if seen[d.Name()] {
+			return fmt.Errorf("destination %s is listed twice", d.Name())
+		}
+		seen[d.Name()] = true
+		if d.StorageClass == "" {
+			d.StorageClass = types.StorageClassStandard
+		}
+		sc, err := parseStorageClass(string(d.StorageClass))
+		if err != nil {
+			return err
+		}
+		d.StorageClass = sc
+	}
+	if o.Concurrency < 1 {
+		o.Concurrency = 1
+	}
+	return o.validateSplit()
+}
+
+// validateSplit fills in the split defaults and keeps every object within what a single PUT can upload.
+func (o *Options) validateSplit() error {
+	if o.PartSize == 0 {
+		o.PartSize = splitter.DefaultPartSize
+	}
+	if o.SplitThreshold == 0 {
+		o.SplitThreshold = splitter.DefaultSplitThreshold
+	}
+	if o.ChunkSize == 0 {
+		o.ChunkSize = splitter.DefaultChunkSize
+	}
+	limit := filesystem.FormatSize(splitter.MaxObjectSize)
+	if o.PartSize > splitter.MaxObjectSize {
+		return fmt.Errorf("the part size can be at most %s", limit)
+	}
+	if o.SplitThreshold > splitter.MaxObjectSize {
+		return fmt.Errorf("the split threshold can be at most %s, bigger files can not be uploaded in one piece", limit)
+	}
+	if o.ChunkSize > o.PartSize {
+		return fmt.Errorf("the chunk size can not be bigger than the part size")
+	}
+	return nil
+}
+
+// Run takes an inventory of the source paths and uploads everything new to every destination.
+func Run(ctx context.Context, opts Options, mode output.Mode) error {
+	err := opts.validate()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(opts.Manifest), 0755)
 	if err != nil {
 		return err
 	}
+	// Only one run may work on a manifest at a time
+	l, err := lock.Acquire(opts.Manifest)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
 
-	files, err := filesystem.WalkAndHash(filters, folderPath)
+	db, err := localsql.InitDb(opts.Manifest)
 	if err != nil {
 		return err
 	}
 
+	files := make(map[string]localsql.File)
+	set := opts.ruleSet()
+	if set.Empty() {
+		output.Warn(mode, "there is no filter or include pattern, nothing is synced. Use -filter '*' to sync every file")
+	}
+	for _, folderPath := range opts.Paths {
+		found, err := filesystem.WalkAndHash(set, folderPath)
+		if err != nil {
+			return err
+		}
+		for k, v := range found {
+			files[k] = localsql.File{Modified: v.ModTime().Unix(), Size: v.Size()}
+		}
+	}
+
 	err = db.UpdateManifest(files)
 	if err != nil {
 		return err
 	}
 
-	uploads, err := db.GetUploadList()
+	// Work out which destinations each file still has to go to
+	var targets []target
+	var uploads []string
+	pending := make(map[string][]int)
+	for i, dest := range opts.Destinations {
+		client, err := GetAwsClient(ctx, dest.Region)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, target{Destination: dest, client: client})
+		if db.Created() && bucketHasObjects(ctx, client, dest) {
+			output.Warn(mode, fmt.Sprintf("%s is a new, empty manifest but s3://%s/%s already holds objects, everything will be uploaded again. "+
+				"If this is not the first sync to it, stop now and point --db or the manifest setting of the profile at the existing manifest", opts.Manifest, dest.Bucket, dest.Prefix))
+		}
+
+		err = db.ClaimLegacyUploads(dest.Name())
+		if err != nil {
+			return err
+		}
+		list, err := db.GetUploadList(dest.Name())
+		if err != nil {
+			return err
+		}
+		for _, file := range list {
+			if _, ok := pending[file]; !ok {
+				uploads = append(uploads, file)
+			}
+			pending[file] = append(pending[file], i)
+		}
+	}
+
+	err = cleanStaleParts(db)
 	if err != nil {
 		return err
 	}
 
-	// So we can monitor the progress of the file file writing
+	// So we can monitor the progress of the whole run
 	progressor := &filesystem.ProgressReadWriter{}
+	for _, upload := range uploads {
+		progressor.Size += files[upload].Size * int64(len(pending[upload]))
+	}
 	ch := make(chan messages.ProgressMsg)
 	go progressor.GetProgress(ch)
 	//
 
 	// This should send it to the execution loop
-	prog := tea.NewProgram(NewModel(folderPath, client, uploads, bucket, db, filters, progressor, deep))
+	prog := output.NewProgram(NewModel(opts, targets, uploads, pending, db, progressor), mode)
 
 	//Sends progress status for video reads/writes
 	go func() {
@@ -62,19 +459,43 @@ func Sync(c *cli.Context) error {
 		}
 	}()
 
-	_, err = prog.Run()
+	final, err := prog.Run()
 	if err != nil {
 		return err
 	}
+	if m, ok := final.(UploadModel); ok && m.err != nil {
+		return m.err
+	}
 
 	return nil
 }
 
-func getAwsClient(ctx context.Context) (*s3.Client, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
+// target is a destination together with the client for its region.
+type target struct {
+	Destination
+	client *s3.Client
+}
+
+// bucketHasObjects reports whether there is anything under the prefix of the destination already.
+// A bucket that cannot be listed counts as empty, the upload will tell what is wrong with it.
+func bucketHasObjects(ctx context.Context, client *s3.Client, dest Destination) bool {
+	res, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(dest.Bucket),
+		Prefix:  aws.String(dest.Prefix),
+		MaxKeys: aws.Int32(1),
+	})
+	return err == nil && len(res.Contents) > 0
+}
+
+// GetAwsClient returns an s3 client, region overrides the region of the aws config when it is set.
+func GetAwsClient(ctx context.Context, region string) (*s3.Client, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if region != "" {
+		cfg.Region = region
+	}
 
 	client := s3.NewFromConfig(cfg)
 	return client, nil
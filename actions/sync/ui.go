@@ -3,11 +3,12 @@ package sync
 import (
 	"cleansync/filesystem"
 	"cleansync/localsql"
-	"context"
+	"cleansync/messages"
+	"cleansync/splitter"
 	"fmt"
+	"path/filepath"
 	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
@@ -16,21 +17,29 @@ import (
 
 type UploadModel struct {
 	toUpdate       []string
-	folderPath     string
-	s3Client       *s3.Client
+	targets        []target
+	pending        map[string][]int // file -> index of the targets it still has to go to
 	db             *localsql.Sqldb
-	bucket         string
-	deep           bool
-	index          int
+	roots          []string // the source paths, class rule patterns are relative to them
+	classRules     []ClassRule
+	splits         map[string]*splitter.SplitInfo // the layout of the files that are uploaded in parts
+	partSize       int64
+	splitThreshold int64
+	chunkSize      int64
+	concurrency    int
+	limiter        *filesystem.RateLimiter
+	next           int
+	inFlight       int
+	finished       int
 	width          int
 	height         int
 	spinner        spinner.Model
 	progress       progress.Model
 	done           bool
-	filters        []string
 	currentProcess string
 	indention      string
 	progressor     *filesystem.ProgressReadWriter
+	err            error
 }
 
 var (
@@ -40,33 +49,40 @@ var (
 )
 
 // NewModel initializes and returns a new model
-func NewModel(folderPath string, client *s3.Client, fileList []string, bucket string, db *localsql.Sqldb, filters []string, progressor *filesystem.ProgressReadWriter, deep bool) UploadModel {
+func NewModel(opts Options, targets []target, fileList []string, pending map[string][]int, db *localsql.Sqldb, progressor *filesystem.ProgressReadWriter) UploadModel {
 	p := progress.New(
 		progress.WithDefaultGradient(),
 		progress.WithWidth(40),
 	)
 	s := spinner.New()
 	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("63"))
+	var roots []string
+	for _, p := range opts.Paths {
+		roots = append(roots, filepath.Clean(filesystem.Localize(p)))
+	}
 
 	return UploadModel{
-		spinner:    s,
-		progress:   p,
-		s3Client:   client,
-		bucket:     bucket,
-		deep:       deep,
-		db:         db,
-		index:      0,
-		folderPath: folderPath,
-		filters:    filters,
-		toUpdate:   fileList,
-		progressor: progressor,
+		spinner:        s,
+		progress:       p,
+		targets:        targets,
+		pending:        pending,
+		roots:          roots,
+		classRules:     opts.ClassRules,
+		splits:         make(map[string]*splitter.SplitInfo),
+		partSize:       opts.PartSize,
+		splitThreshold: opts.SplitThreshold,
+		chunkSize:      opts.ChunkSize,
+		concurrency:    opts.Concurrency,
+		limiter:        filesystem.NewRateLimiter(opts.RateLimit),
+		db:             db,
+		toUpdate:       fileList,
+		progressor:     progressor,
 	}
 }
 
 // Init is the entry point of the ui/program
 func (m UploadModel) Init() tea.Cmd {
-	ctx := context.Background()
-	return tea.Batch(m.PutObjectCmd(ctx), m.spinner.Tick)
+	return tea.Batch(m.uploadCmd(messages.UploadMsg{}), m.spinner.Tick)
 }
 
 // View is the initial state of the ui
@@ -78,7 +94,7 @@ func (m UploadModel) View() string {
 		return doneStyle.Render(fmt.Sprintf("Done! Processed %d packages.\n", n))
 	}
 
-	pkgCount := fmt.Sprintf(" %*d/%*d", w, m.index, w, n)
+	pkgCount := fmt.Sprintf(" %*d/%*d", w, m.finished, w, n)
 
 	spin := m.spinner.View() + " "
 	prog := m.progress.View()
@@ -90,6 +106,29 @@ func (m UploadModel) View() string {
 	return spin + info + gap + prog + pkgCount
 }
 
+// nextTarget returns the target file has to go to after the one named after, or false when there is none.
+// An empty after returns the first one.
+func (m UploadModel) nextTarget(file string, after string) (target, bool) {
+	found := after == ""
+	for _, i := range m.pending[file] {
+		if found {
+			return m.targets[i], true
+		}
+		found = m.targets[i].Name() == after
+	}
+	return target{}, false
+}
+
+// targetNamed returns the target with the given manifest name.
+func (m UploadModel) targetNamed(name string) target {
+	for _, t := range m.targets {
+		if t.Name() == name {
+			return t
+		}
+	}
+	return target{}
+}
+
 // max does what it implies and returns the mbigger of 2 ints
 func max(a, b int) int {
 	if a > b {
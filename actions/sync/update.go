@@ -1,11 +1,11 @@
 package sync
 
 import (
+	"cleansync/localsql"
 	"cleansync/messages"
 	"cleansync/splitter"
 	"context"
 	"fmt"
-	"os"
 	"path/filepath"
 
 	"github.com/charmbracelet/bubbles/progress"
@@ -13,6 +13,21 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 )
 
+// startParts starts uploading the parts of the split file to t, telling how many of them
+// an earlier run uploaded already.
+func (m UploadModel) startParts(info *splitter.SplitInfo, t target) tea.Cmd {
+	upload := m.uploadParts(context.Background(), info, 0, t)
+	n, err := m.uploadedParts(info, t)
+	if err != nil {
+		return m.SendError(info.OrgFilePath, err)
+	}
+	if n == 0 {
+		return upload
+	}
+	reused := messages.PartsReusedMsg{File: info.OrgFilePath, Reused: n, Total: len(info.Parts), Destination: t.Name()}
+	return tea.Sequence(func() tea.Msg { return reused }, upload)
+}
+
 func (m UploadModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
@@ -24,91 +39,107 @@ func (m UploadModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 	case *splitter.SplitInfo:
-
-		// This is the exit point once the file is completly split. We move on to uploading for the next step
-		if msg.Eof {
-			ctx := context.Background()
-			uploadPartsCmd := m.uploadParts(ctx, msg.OrgFilePath, msg.Parts, 0)
-			m.currentProcess = fmt.Sprintf("%s  Uploading part: %s", m.indention, msg.Parts[0])
-			storage := "Standard Storage"
-			if m.deep {
-				storage = "Glacier Deep Archive"
-			}
-			return m, tea.Batch(
-				tea.Printf("%s%s  Uploading %d parts of %s to %s us %s", flagMark, m.indention, len(msg.Parts), filepath.Base(msg.OrgFilePath), m.bucket, storage),
-				uploadPartsCmd,
-			)
-		}
-		//
-
-		msg.Parts = append(msg.Parts, fmt.Sprintf("%s.part%d", filepath.Base(msg.OrgFilePath), msg.Index))
+		// The parts are laid out, they are read from the file as they are uploaded
+		m.splits[msg.OrgFilePath] = msg
+		t, _ := m.nextTarget(msg.OrgFilePath, "")
 		m.indention = "   "
-		output := fmt.Sprintf("%s%s  1. Splitting part: %s", m.indention, checkMark, msg.Parts[msg.Index])
-		m.currentProcess = fmt.Sprintf("%s  2. Splitting part: %s", m.indention, msg.Parts[msg.Index])
+		m.currentProcess = fmt.Sprintf("%s  Uploading parts of: %s", m.indention, filepath.Base(msg.OrgFilePath))
 		return m, tea.Sequence(
-			m.splitCmd(msg),
-			tea.Printf(output),
+			tea.Printf("%s%s  Uploading %d parts of %s to %s as %s", flagMark, m.indention, len(msg.Parts), filepath.Base(msg.OrgFilePath), t.Bucket, m.storageClass(t, msg.OrgFilePath, msg.OrgFileSize)),
+			m.startParts(msg, t),
 		)
 
 	case messages.UploadPartsMsg:
 		m.indention = "\t"
 		pkg := msg.Parts[msg.Index]
-		m.progressor.ResetProgress()
-		m.currentProcess = fmt.Sprintf("%s  Uploading part: %s", m.indention, pkg)
-		if msg.Index >= len(msg.Parts) {
-			return m, tea.Batch(tea.Printf("%s%s Parts Uploaded for %s", m.indention, checkMark, msg.OriginalFile), m.uploadCmd(&messages.UploadMsg{Done: false}))
-		}
-		m.currentProcess = fmt.Sprintf("%s  Uploading part: %s", m.indention, pkg)
+		t := m.targetNamed(msg.Destination)
 		msg.Index++
+		m.currentProcess = fmt.Sprintf("%s  Uploading part list of: %s", m.indention, filepath.Base(msg.OriginalFile))
+		if msg.Index < len(msg.Parts) {
+			m.currentProcess = fmt.Sprintf("%s  Uploading part: %s", m.indention, filepath.Base(msg.Parts[msg.Index]))
+		}
 		ctx := context.Background()
 		return m, tea.Batch(
-			tea.Printf("%s%s Uploading part: %s", m.indention, checkMark, pkg),
-			m.uploadParts(ctx, msg.OriginalFile, msg.Parts, msg.Index),
+			tea.Printf("%s%s Uploaded part: %s", m.indention, checkMark, filepath.Base(pkg)),
+			m.uploadParts(ctx, m.splits[msg.OriginalFile], msg.Index, t),
 		)
-	case messages.UploadMsg:
-		// Were going to check first to see if we needc to split the file up
-
-		pkg := m.toUpdate[m.index]
-		info, err := os.Stat(pkg)
+	case messages.PartsReusedMsg:
+		return m, tea.Printf("%s%s  %d of %d parts of %s are on %s already", m.indention, checkMark, msg.Reused, msg.Total, filepath.Base(msg.File), msg.Destination)
+	case messages.UploadedMsg:
+		var cmds []tea.Cmd
+		if len(msg.Parts) > 0 {
+			cmds = append(cmds, tea.Printf("%s%s Parts Uploaded for %s to %s", m.indention, checkMark, msg.File, msg.Destination))
+		}
+		done := m.targetNamed(msg.Destination)
+		key := objectKey(done, msg.File)
+		if len(msg.Parts) > 0 {
+			key = partKey(done, msg.File, 0)
+		}
+		err := m.db.UpdateUploadStatus(msg.File, localsql.Upload{
+			Destination:  msg.Destination,
+			Key:          key,
+			StorageClass: string(m.storageClass(done, msg.File, msg.Size)),
+		})
 		if err != nil {
-			return m, m.SendError(err)
+			return m, m.SendError(msg.File, err)
 		}
-
-		if info.Size() > 4294967296 {
-			si := &splitter.SplitInfo{
-				OrgFilePath: m.toUpdate[m.index],
-				Parts:       []string{},
-				OrgFileSize: info.Size(),
-			}
+		t, ok := m.nextTarget(msg.File, msg.Destination)
+		if !ok {
+			delete(m.splits, msg.File)
+			return m, tea.Sequence(append(cmds, m.fileDoneCmd(msg.File, msg.Size))...)
+		}
+		ctx := context.Background()
+		m.currentProcess = fmt.Sprintf("Uploading file: %s to %s", msg.File, t.Name())
+		if info, ok := m.splits[msg.File]; ok {
+			return m, tea.Sequence(append(cmds, m.startParts(info, t))...)
+		}
+		return m, tea.Sequence(append(cmds, m.uploadFileCmd(ctx, msg.File, msg.Size, t))...)
+	case messages.UploadMsg:
+		if len(m.toUpdate) == 0 {
+			// Nothing new to upload
+			m.done = true
+			return m, tea.Quit
+		}
+		// Start as many files as we are allowed to upload at the same time
+		ctx := context.Background()
+		var cmds []tea.Cmd
+		for m.next < len(m.toUpdate) && m.inFlight < m.concurrency {
+			cmds = append(cmds, m.PutObjectCmd(ctx, m.next))
+			m.next++
+			m.inFlight++
+		}
+		return m, tea.Batch(cmds...)
+	case messages.FileStartedMsg:
+		// Were going to check first to see if we needc to split the file up
+		m.indention = ""
+		m.currentProcess = fmt.Sprintf("Uploading file: %s", msg.File)
+		if msg.Size > m.splitThreshold {
 			return m, tea.Sequence(
-				tea.Printf("%s%s  %s is too big, splitting into parts.", flagMark, m.indention, filepath.Base(pkg)),
-				m.splitCmd(si),
+				tea.Printf("%s%s  %s is too big, splitting into parts.", flagMark, m.indention, filepath.Base(msg.File)),
+				m.planSplitCmd(msg.File, msg.Size),
 			)
 		}
 		// Do the upload
-		ctx := context.Background()
-		err = m.doUpload(ctx, m.toUpdate[m.index], m.progressor, info.Size())
-		if err != nil {
-			return m, m.SendError(err)
-		}
-
-		if m.index >= len(m.toUpdate)-1 {
-			// Everything's been Downloaded. We're done!
+		t, _ := m.nextTarget(msg.File, "")
+		return m, m.uploadFileCmd(context.Background(), msg.File, msg.Size, t)
+	case messages.FileDoneMsg:
+		m.finished++
+		m.inFlight--
+		if m.finished >= len(m.toUpdate) {
+			// Everything's been uploaded. We're done!
 			m.done = true
 			return m, tea.Sequence(
-				// progressCmd,
-				tea.Printf("%s %s", checkMark, m.toUpdate[m.index]), // print the last success message
-				tea.Quit, // exit the program
+				tea.Printf("%s %s", checkMark, msg.File), // print the last success message
+				tea.Quit,                                 // exit the program
 			)
 		}
-		m.index++
 		return m, tea.Batch(
-			tea.Printf("%s %s", checkMark, pkg),
-			m.PutObjectCmd(ctx),
+			tea.Printf("%s %s", checkMark, msg.File),
+			m.uploadCmd(messages.UploadMsg{}),
 		)
 	case messages.ErrMsg:
-		// handle errorI guess
-		return m, tea.Quit
+		m.err = msg
+		return m, tea.Sequence(tea.Printf("Error: %s", msg.Error()), tea.Quit)
 	case messages.ProgressMsg:
 		progressCmd := m.progress.SetPercent(msg.Progress)
 		return m, tea.Batch(progressCmd)
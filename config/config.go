@@ -0,0 +1,280 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config is the content of the cleansync config file.
+//
+//	[profiles.tv]
+//	manifest = "X:/tv/manifest.db"
+//	paths = ["X:/tv"]
+//	bucket = "my-backup-bucket"
+//	filters = ["mkv", "mp4"]
+//	storage_class = "DEEP_ARCHIVE"
+//
+//	[[profiles.tv.destinations]]
+//	bucket = "my-other-bucket"
+//	region = "eu-west-1"
+//	storage_class = "STANDARD_IA"
+//
+//	[[profiles.tv.storage_rules]]
+//	storage_class = "GLACIER_IR"
+//	max_size = "1GB"
+//
+//	[profiles.tv.adclear]
+//	source = "C:/PlayOn"
+//	dest = "X:/tv"
+//	skip_first = true
+//
+//	[[profiles.tv.adclear.rules]]
+//	title = "^(commercial|ad break)$"
+//
+//	[pricing.DEEP_ARCHIVE]
+//	storage_per_gb = 0.0018
+//
+//	[transcode.small]
+//	codec = "hevc"
+//	crf = 28
+type Config struct {
+	Profiles map[string]Profile `toml:"profiles"`
+	// Pricing overrides the prices cost uses, by storage class, see the pricing package.
+	Pricing map[string]map[string]float64 `toml:"pricing"`
+	// Transcode adds transcode profiles adclear can use, or replaces built in ones.
+	Transcode map[string]Transcode `toml:"transcode"`
+}
+
+// Profile is a named set of sync and adclear settings.
+type Profile struct {
+	Manifest     string   `toml:"manifest"` // defaults to <name>.db in the data directory
+	Paths        []string `toml:"paths"`
+	Bucket       string   `toml:"bucket"`
+	Prefix       string   `toml:"prefix"`
+	Filters      []string `toml:"filters"`
+	Include      []string `toml:"include"` // glob patterns, see the rules package
+	Exclude      []string `toml:"exclude"`
+	MinSize      string   `toml:"min_size"`
+	MaxSize      string   `toml:"max_size"`
+	MinAge       string   `toml:"min_age"` // e.g. "2d", files younger than this are skipped
+	MaxAge       string   `toml:"max_age"`
+	StorageClass string   `toml:"storage_class"`
+	Concurrency  int      `toml:"concurrency"`
+	RateLimit    string   `toml:"rate_limit"` // bytes per second, e.g. "20MB"
+	// Files over SplitThreshold (4GB) are uploaded in parts of PartSize (2GB), read ChunkSize (16MB) at a time.
+	PartSize       string   `toml:"part_size"`
+	SplitThreshold string   `toml:"split_threshold"`
+	ChunkSize      string   `toml:"chunk_size"`
+	Adclear        *Adclear `toml:"adclear"`
+	// Destinations are synced in addition to Bucket. Prefix and storage class default to the profile's.
+	Destinations []Destination `toml:"destinations"`
+	// StorageRules pick another storage class for some files, the first one that matches wins.
+	StorageRules []StorageRule `toml:"storage_rules"`
+}
+
+// StorageRule uploads the files that match every condition that is set with StorageClass.
+type StorageRule struct {
+	StorageClass string `toml:"storage_class"`
+	MinSize      string `toml:"min_size"`
+	MaxSize      string `toml:"max_size"`
+	Pattern      string `toml:"pattern"` // gitignore style glob
+}
+
+// Destination is a bucket the sources of a profile are uploaded to.
+type Destination struct {
+	Bucket       string `toml:"bucket"`
+	Region       string `toml:"region"`
+	Prefix       string `toml:"prefix"`
+	StorageClass string `toml:"storage_class"`
+}
+
+// Adclear holds the adclear settings of a profile.
+type Adclear struct {
+	Source    string `toml:"source"`
+	Dest      string `toml:"dest"`
+	SkipFirst bool   `toml:"skip_first"`
+	// Rules decide which chapters are ads, the first one that matches wins. Chapters titled
+	// Advertisement are removed unless a rule says otherwise.
+	Rules []ChapterRule `toml:"rules"`
+	// Cutlist is the cut list of a single source video, only set by the --cutlist flag.
+	Cutlist string `toml:"-"`
+	// CutlistMode is replace (the default) for a cut list next to a video to replace its chapters,
+	// or merge to cut its stretches out of them.
+	CutlistMode string `toml:"cutlist_mode"`
+	// CutMode is keyframe (the default) to copy everything, or accurate to re-encode around each cut.
+	CutMode string `toml:"cut_mode"`
+	// MarkBreaks tags the chapters of the output that follow a removed break.
+	MarkBreaks bool `toml:"mark_breaks"`
+	// AudioLanguages and SubtitleLanguages keep only the audio and subtitle streams, and .srt sidecars,
+	// in these languages, e.g. ["eng"]. Empty keeps them all.
+	AudioLanguages    []string `toml:"audio_languages"`
+	SubtitleLanguages []string `toml:"subtitle_languages"`
+	// VerifyTolerance is how far the duration of the output may be off per kept stretch, "2s" by default.
+	VerifyTolerance string `toml:"verify_tolerance"`
+	// VerifyDecode decodes every frame of the output before it is copied to the destination.
+	VerifyDecode bool `toml:"verify_decode"`
+	// Transcode names the transcode profile the videos are re-encoded with after the ads are removed.
+	Transcode string `toml:"transcode"`
+	// Transcodes are the transcode profiles of the config file, set when it is loaded.
+	Transcodes map[string]Transcode `toml:"-"`
+	// Detect finds the commercial breaks of videos without chapters from black frames and silence.
+	Detect *Detect `toml:"detect"`
+	// Jobs is how many videos are processed at the same time, 1 by default. CutJobs and CopyJobs
+	// limit how many of them are cut and copied at the same time, they default to Jobs.
+	Jobs     int `toml:"jobs"`
+	CutJobs  int `toml:"cut_jobs"`
+	CopyJobs int `toml:"copy_jobs"`
+	// Manifest records the videos that were processed so unchanged ones are skipped, set by the command.
+	Manifest string `toml:"-"`
+	// Force processes videos again even when they did not change since they were processed.
+	Force bool `toml:"-"`
+}
+
+// Transcode re-encodes the video of the adclear output, see the ffmpeg package for the built in ones.
+type Transcode struct {
+	Codec        string `toml:"codec"`   // hevc, av1 or h264
+	CRF          int    `toml:"crf"`     // used unless bitrate is set
+	Bitrate      string `toml:"bitrate"` // e.g. "2500k"
+	Preset       string `toml:"preset"`
+	AudioCodec   string `toml:"audio_codec"` // the audio is copied when empty
+	AudioBitrate string `toml:"audio_bitrate"`
+	MaxHeight    int    `toml:"max_height"` // e.g. 1080, taller videos are scaled down
+}
+
+// Detect tunes the commercial detection, settings that are left out keep their defaults.
+type Detect struct {
+	BlackMin       string  `toml:"black_min"`       // shortest run of black frames, e.g. "0.1s"
+	BlackThreshold float64 `toml:"black_threshold"` // 0 to 1, how dark a pixel has to be to count as black
+	SilenceNoise   string  `toml:"silence_noise"`   // e.g. "-50dB"
+	SilenceMin     string  `toml:"silence_min"`
+	MaxSpot        string  `toml:"max_spot"` // longest single ad, e.g. "2m"
+	MinBreak       string  `toml:"min_break"`
+	MaxBreak       string  `toml:"max_break"`
+}
+
+// ChapterRule removes the chapters that match every condition that is set, or keeps them with Keep.
+type ChapterRule struct {
+	Title     string `toml:"title"`      // regular expression, case insensitive
+	MinLength string `toml:"min_length"` // e.g. "30s" or "2m"
+	MaxLength string `toml:"max_length"`
+	Position  string `toml:"position"` // first or last
+	Keep      bool   `toml:"keep"`
+}
+
+// DefaultPath returns where the config file lives when --config is not given.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "cleansync.toml"
+	}
+	return filepath.Join(dir, "cleansync", "config.toml")
+}
+
+// DataDir returns the per-user directory the manifests are kept in.
+func DataDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "cleansync")
+	}
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		// %AppData% and ~/Library/Application Support
+		dir, err := os.UserConfigDir()
+		if err == nil {
+			return filepath.Join(dir, "cleansync")
+		}
+	default:
+		home, err := os.UserHomeDir()
+		if err == nil {
+			return filepath.Join(home, ".local", "share", "cleansync")
+		}
+	}
+	return "."
+}
+
+// LegacyManifest is where manifests were kept before they moved to the data directory.
+const LegacyManifest = "manifest.db"
+
+// DefaultManifest is where the manifest of the profile called name is kept, name is empty without a profile.
+func DefaultManifest(name string) string {
+	if name == "" {
+		return filepath.Join(DataDir(), "manifest.db")
+	}
+	return filepath.Join(DataDir(), name+".db")
+}
+
+// ManifestPath decides which manifest a run uses: the --db flag, then the manifest setting of
+// the profile, then one manifest per profile in the data directory. legacy is set when the default
+// does not exist yet but a manifest.db in the working directory does, that one is used instead.
+func ManifestPath(flag string, name string, p Profile) (path string, legacy bool) {
+	if flag != "" {
+		return flag, false
+	}
+	if p.Manifest != "" {
+		return p.Manifest, false
+	}
+	path = DefaultManifest(name)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(LegacyManifest); err == nil {
+			return LegacyManifest, true
+		}
+	}
+	return path, false
+}
+
+// Load reads the config file at path. A missing file is only an error if required is set,
+// otherwise an empty config is returned.
+func Load(path string, required bool) (*Config, error) {
+	cfg := &Config{Profiles: map[string]Profile{}}
+	if path == "" {
+		return cfg, nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) && !required {
+		return cfg, nil
+	}
+	md, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config %s: %s", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		return nil, fmt.Errorf("unknown settings in config %s: %s", path, strings.Join(keys, ", "))
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]Profile{}
+	}
+	for _, p := range cfg.Profiles {
+		if p.Adclear != nil {
+			p.Adclear.Transcodes = cfg.Transcode
+		}
+	}
+	return cfg, nil
+}
+
+// Profile returns the profile with the given name.
+func (c *Config) Profile(name string) (Profile, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("no profile named %q in the config", name)
+	}
+	return p, nil
+}
+
+// Names returns the profile names in a stable order.
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
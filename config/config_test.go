@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(path, []byte(`
+[profiles.tv]
+paths = ["X:/tv"]
+bucket = "backup"
+filters = ["mkv", "mp4"]
+concurrency = 2
+
+[profiles.tv.adclear]
+source = "C:/PlayOn"
+dest = "X:/tv"
+skip_first = true
+
+[[profiles.tv.adclear.rules]]
+title = "commercial"
+max_length = "3m"
+
+[profiles.movies]
+paths = ["X:/movies"]
+bucket = "backup"
+
+[transcode.small]
+codec = "hevc"
+crf = 28
+max_height = 720
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := cfg.Names()
+	if len(names) != 2 || names[0] != "movies" || names[1] != "tv" {
+		t.Fatalf("Expected the profiles movies and tv, got %v", names)
+	}
+	tv, err := cfg.Profile("tv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tv.Concurrency != 2 || tv.Adclear == nil || !tv.Adclear.SkipFirst {
+		t.Fatalf("Unexpected tv profile %+v", tv)
+	}
+	if len(tv.Adclear.Rules) != 1 || tv.Adclear.Rules[0].Title != "commercial" || tv.Adclear.Rules[0].MaxLength != "3m" {
+		t.Fatalf("Unexpected chapter rules %+v", tv.Adclear.Rules)
+	}
+	if tv.Adclear.Transcodes["small"].CRF != 28 || tv.Adclear.Transcodes["small"].MaxHeight != 720 {
+		t.Fatalf("Expected the transcode profiles to be handed to adclear, got %+v", tv.Adclear.Transcodes)
+	}
+	if _, err := cfg.Profile("music"); err == nil {
+		t.Fatal("Expected an error for a missing profile")
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.toml")
+	if _, err := Load(path, false); err != nil {
+		t.Fatalf("A missing default config should not be an error: %s", err)
+	}
+	if _, err := Load(path, true); err == nil {
+		t.Fatal("Expected an error for a missing config that was asked for")
+	}
+}
+
+func TestManifestPath(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(t.TempDir())
+
+	if p, _ := ManifestPath("x.db", "tv", Profile{Manifest: "tv.db"}); p != "x.db" {
+		t.Fatalf("Expected --db to win, got %s", p)
+	}
+	if p, _ := ManifestPath("", "tv", Profile{Manifest: "tv.db"}); p != "tv.db" {
+		t.Fatalf("Expected the manifest setting of the profile, got %s", p)
+	}
+	p, legacy := ManifestPath("", "tv", Profile{})
+	if p != DefaultManifest("tv") || legacy || filepath.Base(p) != "tv.db" {
+		t.Fatalf("Expected a manifest per profile in the data directory, got %s", p)
+	}
+
+	err := os.WriteFile(LegacyManifest, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, legacy = ManifestPath("", "tv", Profile{})
+	if p != LegacyManifest || !legacy {
+		t.Fatalf("Expected the manifest in the working directory to be picked up, got %s", p)
+	}
+}
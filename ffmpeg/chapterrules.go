@@ -0,0 +1,153 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Position limits a chapter rule to a chapter at the start or the end of the video.
+type Position string
+
+const (
+	AnyChapter   Position = ""
+	FirstChapter Position = "first"
+	LastChapter  Position = "last"
+	// FirstKeptChapter is the first chapter the other rules keep, it is not a setting of its own.
+	FirstKeptChapter Position = "first kept"
+)
+
+// ChapterRule removes, or with Keep keeps, the chapters it matches. All conditions that are set have to hold.
+type ChapterRule struct {
+	Title     *regexp.Regexp // matched against the chapter title
+	MinLength time.Duration  // at least this long
+	MaxLength time.Duration  // at most this long
+	Position  Position
+	Keep      bool
+	Source    string // where the rule came from, used by explain
+}
+
+// AdvertisementRule removes the chapters PlayOn titles Advertisement. It is checked after the configured rules.
+func AdvertisementRule() ChapterRule {
+	return ChapterRule{Title: regexp.MustCompile(`(?i)^advertisement$`), Source: "the default rule"}
+}
+
+// SkipFirstRule removes the first chapter that is not an ad, which PlayOn uses for its 'Recorded by...'
+// intro. Recordings that start with an ad have the intro after it. Synthetic chapters have no intro, their
+// first segment is part of the show, so the rule leaves them alone.
+func SkipFirstRule() ChapterRule {
+	return ChapterRule{Position: FirstKeptChapter, Source: "skip_first"}
+}
+
+// ParsePosition checks a position setting.
+func ParsePosition(s string) (Position, error) {
+	switch p := Position(strings.ToLower(strings.TrimSpace(s))); p {
+	case AnyChapter, FirstChapter, LastChapter:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown chapter position %q, expected first or last", s)
+}
+
+// CompileTitle compiles a title pattern, titles are matched case insensitively.
+func CompileTitle(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid title pattern %q: %s", pattern, err)
+	}
+	return re, nil
+}
+
+func (r ChapterRule) String() string {
+	var conds []string
+	if r.Title != nil {
+		conds = append(conds, fmt.Sprintf("title matches %s", strings.TrimPrefix(r.Title.String(), "(?i)")))
+	}
+	if r.MinLength > 0 {
+		conds = append(conds, fmt.Sprintf("at least %s", r.MinLength))
+	}
+	if r.MaxLength > 0 {
+		conds = append(conds, fmt.Sprintf("at most %s", r.MaxLength))
+	}
+	if r.Position != AnyChapter {
+		conds = append(conds, fmt.Sprintf("%s chapter", r.Position))
+	}
+	if len(conds) == 0 {
+		return "every chapter"
+	}
+	return strings.Join(conds, ", ")
+}
+
+// matches reports whether the rule applies to the chapter at ndx of count chapters.
+func (r ChapterRule) matches(c Chapter, ndx int, count int) bool {
+	length := time.Duration((c.End - c.Start) * float64(time.Second))
+	if r.MinLength > 0 && length < r.MinLength {
+		return false
+	}
+	if r.MaxLength > 0 && length > r.MaxLength {
+		return false
+	}
+	if r.Position == FirstChapter && ndx != 0 {
+		return false
+	}
+	if r.Position == LastChapter && ndx != count-1 {
+		return false
+	}
+	return r.Title == nil || r.Title.MatchString(c.Title)
+}
+
+// ChapterDecision is what the rules decided for a chapter, Reason names the rule that decided it.
+type ChapterDecision struct {
+	Index   int
+	Chapter Chapter
+	Removed bool
+	Reason  string
+}
+
+// Classify checks every chapter against the rules, the first rule that matches decides. Chapters
+// no rule matches are kept. Rules for the first kept chapter are checked once the others decided, and
+// not at all for synthetic chapters.
+func (v *Video) Classify(rules []ChapterRule) []ChapterDecision {
+	res := make([]ChapterDecision, len(v.Chapters))
+	for i, c := range v.Chapters {
+		res[i] = ChapterDecision{Index: i, Chapter: c, Reason: "no rule matches it"}
+		for _, r := range rules {
+			if r.Position == FirstKeptChapter || !r.matches(c, i, len(v.Chapters)) {
+				continue
+			}
+			res[i].Removed = !r.Keep
+			res[i].Reason = fmt.Sprintf("%s: %s", r.Source, r)
+			break
+		}
+	}
+	for _, r := range rules {
+		if r.Position != FirstKeptChapter || v.Synthetic {
+			continue
+		}
+		for i := range res {
+			if res[i].Removed {
+				continue
+			}
+			if r.matches(res[i].Chapter, i, len(res)) {
+				res[i].Removed = !r.Keep
+				res[i].Reason = fmt.Sprintf("%s: %s", r.Source, r)
+			}
+			break
+		}
+	}
+	return res
+}
+
+// KeptIndexes returns the chapters the rules keep, nil when the video has no chapters.
+func (v *Video) KeptIndexes(rules []ChapterRule) []int {
+	if len(v.Chapters) == 0 {
+		return nil
+	}
+	kept := []int{}
+	for _, d := range v.Classify(rules) {
+		if !d.Removed {
+			kept = append(kept, d.Index)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,90 @@
+package ffmpeg
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	v := Video{Chapters: []Chapter{
+		{Start: 0, End: 5, Title: "Recorded by PlayOn"},
+		{Start: 5, End: 600, Title: "Segment 1"},
+		{Start: 600, End: 690, Title: "Segment 2 (ad)"},
+		{Start: 690, End: 1200, Title: "Segment 3"},
+		{Start: 1200, End: 1260, Title: "Commercial"},
+		{Start: 1260, End: 1300, Title: "advertisement"},
+		{Start: 1300, End: 1500, Title: "Commercial"},
+		{Start: 1500, End: 1520},
+	}}
+	rules := []ChapterRule{
+		SkipFirstRule(),
+		{Title: regexp.MustCompile(`(?i)\(ad\)$`), Source: "rule 1"},
+		{Title: regexp.MustCompile(`(?i)^commercial$`), MaxLength: 3 * time.Minute, Source: "rule 2"},
+		{Title: regexp.MustCompile(`(?i)^advertisement$`), Keep: true, Source: "rule 3"},
+		{Position: LastChapter, MaxLength: 30 * time.Second, Source: "rule 4"},
+		AdvertisementRule(),
+	}
+
+	kept := v.KeptIndexes(rules)
+	want := []int{1, 3, 5, 6}
+	if len(kept) != len(want) {
+		t.Fatalf("expected the chapters %v to be kept, got %v", want, kept)
+	}
+	for i := range want {
+		if kept[i] != want[i] {
+			t.Fatalf("expected the chapters %v to be kept, got %v", want, kept)
+		}
+	}
+
+	decisions := v.Classify(rules)
+	if !strings.HasPrefix(decisions[0].Reason, "skip_first") || !decisions[0].Removed {
+		t.Fatalf("expected skip_first to remove the first chapter, got %+v", decisions[0])
+	}
+	if decisions[1].Reason != "no rule matches it" || decisions[1].Removed {
+		t.Fatalf("expected no rule to match the second chapter, got %+v", decisions[1])
+	}
+	if decisions[4].Reason != "rule 2: title matches ^commercial$, at most 3m0s" {
+		t.Fatalf("unexpected reason %q", decisions[4].Reason)
+	}
+	if !strings.HasPrefix(decisions[5].Reason, "rule 3") || decisions[5].Removed {
+		t.Fatalf("expected the keep rule to win over the default rule, got %+v", decisions[5])
+	}
+}
+
+func TestSkipFirstAfterAnAd(t *testing.T) {
+	v := Video{Chapters: []Chapter{
+		{Start: 0, End: 30, Title: "Advertisement"},
+		{Start: 30, End: 35, Title: "Recorded by PlayOn"},
+		{Start: 35, End: 600, Title: "Segment 1"},
+		{Start: 600, End: 630, Title: "Advertisement"},
+		{Start: 630, End: 1200, Title: "Segment 2"},
+	}}
+	kept := v.GetNonAdIndexes(true)
+	if len(kept) != 2 || kept[0] != 2 || kept[1] != 4 {
+		t.Fatalf("expected the intro after the first ad to be skipped, got %v", kept)
+	}
+	decisions := v.Classify([]ChapterRule{SkipFirstRule(), AdvertisementRule()})
+	if !strings.HasPrefix(decisions[0].Reason, "the default rule") {
+		t.Fatalf("expected the ad to be removed as an ad, got %+v", decisions[0])
+	}
+	if !strings.HasPrefix(decisions[1].Reason, "skip_first") {
+		t.Fatalf("expected skip_first to remove the intro, got %+v", decisions[1])
+	}
+}
+
+func TestKeptIndexesWithoutChapters(t *testing.T) {
+	v := Video{}
+	if v.KeptIndexes([]ChapterRule{AdvertisementRule()}) != nil {
+		t.Fatal("expected nil for a video without chapters, it is copied as is")
+	}
+	v.Chapters = []Chapter{{Start: 0, End: 30, Title: "Advertisement"}}
+	kept := v.KeptIndexes([]ChapterRule{AdvertisementRule()})
+	if kept == nil || len(kept) != 0 {
+		t.Fatalf("expected an empty list when every chapter is removed, got %v", kept)
+	}
+	if v.GetNonAdIndexes(true) == nil {
+		t.Fatal("expected skip_first not to fail when every chapter is an ad")
+	}
+}
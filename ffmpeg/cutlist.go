@@ -0,0 +1,224 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CutlistExtensions are the sidecars next to a video that are read as its cut list.
+var CutlistExtensions = []string{".edl", ".txt"}
+
+// comskipHeader starts the .txt cut lists Comskip writes, followed by the frame rate times 100.
+const comskipHeader = "FILE PROCESSING COMPLETE"
+
+// FindCutlist returns the cut list next to the video at p, e.g. show.edl for show.mkv, or an empty
+// string if there is none. A .txt only counts when Comskip wrote it.
+func FindCutlist(p string) (string, error) {
+	base := strings.TrimSuffix(p, filepath.Ext(p))
+	for _, ext := range CutlistExtensions {
+		candidate := base + ext
+		f, err := os.Open(candidate)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		line, err := bufio.NewReader(f).ReadString('\n')
+		f.Close()
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if ext == ".txt" && !strings.HasPrefix(strings.TrimSpace(line), comskipHeader) {
+			continue
+		}
+		return candidate, nil
+	}
+	return "", nil
+}
+
+// ReadCutlist reads the stretches a cut list removes, see ParseCutlist.
+func ReadCutlist(p string) ([]Interval, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cuts, err := ParseCutlist(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the cut list %s: %s", p, err)
+	}
+	return cuts, nil
+}
+
+// ParseCutlist reads the stretches to remove from a cut list in one of the formats
+//
+//	Comskip .txt     frame numbers after a "FILE PROCESSING COMPLETE 53999 FRAMES AT 2997" header
+//	MPlayer EDL      start end action, in seconds, action 0 (cut) and 3 (commercial break) are removed, 1 (mute) is not
+//	start end        in seconds or as h:mm:ss.ms, one stretch to remove per line
+//
+// Blank lines and lines starting with # are skipped. The stretches are returned sorted with the
+// overlapping ones merged.
+func ParseCutlist(r io.Reader) ([]Interval, error) {
+	scanner := bufio.NewScanner(r)
+	var cuts []Interval
+	fps := 0.0
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, comskipHeader) {
+			fields := strings.Fields(line)
+			rate, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+			if err != nil || rate <= 0 {
+				return nil, fmt.Errorf("line %d: no frame rate in the Comskip header", n)
+			}
+			fps = rate / 100
+			continue
+		}
+		if strings.Trim(line, "-") == "" {
+			continue // the line under the Comskip header
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected start and end, and optionally an action, got %q", n, line)
+		}
+		if len(fields) == 3 {
+			action, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid action %q", n, fields[2])
+			}
+			if action != 0 && action != 3 {
+				continue
+			}
+		}
+		var cut Interval
+		var err error
+		if fps > 0 {
+			cut.Start, err = frame(fields[0], fps)
+			if err == nil {
+				cut.End, err = frame(fields[1], fps)
+			}
+		} else {
+			cut.Start, err = parseTimestamp(fields[0])
+			if err == nil {
+				cut.End, err = parseTimestamp(fields[1])
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		if cut.End <= cut.Start {
+			return nil, fmt.Errorf("line %d: the end %s is not after the start %s", n, fields[1], fields[0])
+		}
+		cuts = append(cuts, cut)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return mergeIntervals(cuts), nil
+}
+
+func frame(s string, fps float64) (float64, error) {
+	f, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid frame number %q", s)
+	}
+	return float64(f) / fps, nil
+}
+
+// parseTimestamp parses seconds, 90.5, or h:mm:ss.ms and m:ss.ms, 1:02:03.5.
+func parseTimestamp(s string) (float64, error) {
+	secs := 0.0
+	for _, part := range strings.Split(s, ":") {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		secs = secs*60 + v
+	}
+	return secs, nil
+}
+
+// mergeIntervals sorts the intervals and joins those that overlap.
+func mergeIntervals(in []Interval) []Interval {
+	sort.Slice(in, func(i, j int) bool { return in[i].Start < in[j].Start })
+	var res []Interval
+	for _, iv := range in {
+		if len(res) > 0 && iv.Start <= res[len(res)-1].End {
+			if iv.End > res[len(res)-1].End {
+				res[len(res)-1].End = iv.End
+			}
+			continue
+		}
+		res = append(res, iv)
+	}
+	return res
+}
+
+// ApplyCuts turns the stretches a cut list removes into chapters titled Advertisement, so the chapter
+// rules remove them. Without merge they replace the chapters of the video, the rest becoming Segment 1,
+// Segment 2 and so on. With merge the chapters of the video are kept and split where a cut starts or ends.
+func (v *Video) ApplyCuts(cuts []Interval, merge bool, source string) error {
+	if !merge || len(v.Chapters) == 0 {
+		if v.Duration <= 0 {
+			return fmt.Errorf("ffprobe does not know how long %s is, the cut list cannot be applied", v.filePath)
+		}
+		v.Chapters = breakChapters(cuts, v.Duration, source)
+		v.Synthetic = true
+		return nil
+	}
+	var res []Chapter
+	for _, c := range v.Chapters {
+		pos := c.Start
+		for _, cut := range cuts {
+			if cut.End <= pos || cut.Start >= c.End {
+				continue
+			}
+			if cut.Start > pos {
+				res = append(res, piece(c, pos, cut.Start))
+			}
+			end := min(cut.End, c.End)
+			res = append(res, Chapter{
+				Start: max(pos, cut.Start),
+				End:   end,
+				Title: "Advertisement",
+				Tags:  map[string]string{"title": "Advertisement", "source": source},
+			})
+			pos = end
+		}
+		if c.End > pos {
+			res = append(res, piece(c, pos, c.End))
+		}
+	}
+	for i := range res {
+		res[i].ID = int64(i)
+	}
+	v.Chapters = res
+	return nil
+}
+
+// totalLength adds up how long the intervals are.
+func totalLength(in []Interval) float64 {
+	res := 0.0
+	for _, iv := range in {
+		res += iv.End - iv.Start
+	}
+	return res
+}
+
+// piece is the part of the chapter between start and end.
+func piece(c Chapter, start float64, end float64) Chapter {
+	c.Start = start
+	c.End = end
+	return c
+}
@@ -0,0 +1,163 @@
+package ffmpeg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCutlist(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		in   string
+		want []Interval
+	}{
+		{"comskip", "FILE PROCESSING COMPLETE  39600 FRAMES AT  2997\n-------------------\n1\t899\n17982\t21578\n", []Interval{{1 / 29.97, 899 / 29.97}, {17982 / 29.97, 21578 / 29.97}}},
+		{"edl", "0.00\t29.50\t0\n600.10\t720.00\t3\n800\t805\t1\n", []Interval{{0, 29.5}, {600.1, 720}}},
+		{"start end", "# the breaks\n\n0:10:00 0:12:30.5\n90 120\n100 130\n", []Interval{{90, 130}, {600, 750.5}}},
+	} {
+		got, err := ParseCutlist(strings.NewReader(c.in))
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		if len(got) != len(c.want) {
+			t.Fatalf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+		for i := range got {
+			if got[i].Start-c.want[i].Start > 0.001 || c.want[i].Start-got[i].Start > 0.001 || got[i].End-c.want[i].End > 0.001 || c.want[i].End-got[i].End > 0.001 {
+				t.Fatalf("%s: expected %v, got %v", c.name, c.want, got)
+			}
+		}
+	}
+
+	for _, bad := range []string{"10 5\n", "soon later\n", "1 2 3 4\n", "1 2 cut\n", "FILE PROCESSING COMPLETE\n"} {
+		if _, err := ParseCutlist(strings.NewReader(bad)); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestApplyCuts(t *testing.T) {
+	cuts := []Interval{{0, 5}, {300, 420}}
+
+	v := Video{Duration: 1320, Chapters: []Chapter{{Start: 0, End: 1320, Title: "Episode"}}}
+	err := v.ApplyCuts(cuts, false, "show.edl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := []string{"Advertisement", "Segment 1", "Advertisement", "Segment 2"}
+	if len(v.Chapters) != len(titles) {
+		t.Fatalf("expected %v, got %+v", titles, v.Chapters)
+	}
+	for i, title := range titles {
+		if v.Chapters[i].Title != title {
+			t.Fatalf("expected %v, got %+v", titles, v.Chapters)
+		}
+	}
+	if v.Chapters[1].Start != 5 || v.Chapters[3].End != 1320 || v.Chapters[2].Tags["source"] != "show.edl" {
+		t.Fatalf("unexpected chapters %+v", v.Chapters)
+	}
+
+	v = Video{Duration: 1320, Chapters: []Chapter{
+		{Start: 0, End: 360, Title: "Act 1"},
+		{Start: 360, End: 1320, Title: "Act 2"},
+	}}
+	err = v.ApplyCuts(cuts, true, "show.edl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Chapter{
+		{Start: 0, End: 5, Title: "Advertisement"},
+		{Start: 5, End: 300, Title: "Act 1"},
+		{Start: 300, End: 360, Title: "Advertisement"},
+		{Start: 360, End: 420, Title: "Advertisement"},
+		{Start: 420, End: 1320, Title: "Act 2"},
+	}
+	if len(v.Chapters) != len(want) {
+		t.Fatalf("expected %+v, got %+v", want, v.Chapters)
+	}
+	for i, w := range want {
+		c := v.Chapters[i]
+		if c.Start != w.Start || c.End != w.End || c.Title != w.Title || c.ID != int64(i) {
+			t.Fatalf("expected %+v, got %+v", want, v.Chapters)
+		}
+	}
+	kept := v.GetNonAdIndexes(false)
+	if len(kept) != 2 || kept[0] != 1 || kept[1] != 4 {
+		t.Fatalf("expected the acts to be kept, got %v", kept)
+	}
+
+	v = Video{}
+	if v.ApplyCuts(cuts, false, "show.edl") == nil {
+		t.Fatal("expected an error when the duration is unknown")
+	}
+}
+
+func TestSkipFirstWithSyntheticChapters(t *testing.T) {
+	cuts := []Interval{{300, 420}}
+
+	v := Video{Duration: 1320, Chapters: []Chapter{{Start: 0, End: 1320, Title: "Episode"}}}
+	err := v.ApplyCuts(cuts, false, "show.edl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := v.GetNonAdIndexes(true)
+	if len(kept) != 2 || kept[0] != 0 || kept[1] != 2 {
+		t.Fatalf("expected Segment 1 of a cut list to be kept with skip_first, got %v", kept)
+	}
+
+	// detected breaks are synthetic the same way
+	v = Video{Synthetic: true, Chapters: breakChapters([]Interval{{600, 690}}, 1320, "blackdetect,silencedetect")}
+	kept = v.GetNonAdIndexes(true)
+	if len(kept) != 2 || kept[0] != 0 {
+		t.Fatalf("expected the first detected segment to be kept with skip_first, got %v", kept)
+	}
+
+	// merged, the chapters of the recording and its intro are still there
+	v = Video{Duration: 1320, Chapters: []Chapter{
+		{Start: 0, End: 5, Title: "Recorded by PlayOn"},
+		{Start: 5, End: 1320, Title: "Episode"},
+	}}
+	err = v.ApplyCuts(cuts, true, "show.edl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept = v.GetNonAdIndexes(true)
+	if len(kept) != 2 || kept[0] != 1 || kept[1] != 3 {
+		t.Fatalf("expected skip_first to remove the intro of a merged cut list, got %v", kept)
+	}
+}
+
+func TestFindCutlist(t *testing.T) {
+	dir := t.TempDir()
+	video := filepath.Join(dir, "show.mkv")
+	p, err := FindCutlist(video)
+	if err != nil || p != "" {
+		t.Fatalf("expected no cut list, got %q %v", p, err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "show.txt"), []byte("Recorded on channel 4\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = FindCutlist(video)
+	if err != nil || p != "" {
+		t.Fatalf("expected a .txt Comskip did not write to be ignored, got %q %v", p, err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "show.txt"), []byte("FILE PROCESSING COMPLETE  39600 FRAMES AT  2997\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = FindCutlist(video)
+	if err != nil || p != filepath.Join(dir, "show.txt") {
+		t.Fatalf("expected the Comskip .txt, got %q %v", p, err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "show.edl"), []byte("1 2 0\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err = FindCutlist(video)
+	if err != nil || p != filepath.Join(dir, "show.edl") {
+		t.Fatalf("expected the .edl to win, got %q %v", p, err)
+	}
+}
@@ -0,0 +1,207 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// DetectOptions tune how commercial breaks are found in videos without chapters. A break boundary is
+// where a run of black frames and a stretch of silence overlap, a break is a run of boundaries that
+// are at most MaxSpot apart, like the ads inside it, and lasts between MinBreak and MaxBreak.
+type DetectOptions struct {
+	BlackMin       time.Duration // shortest run of black frames that counts, blackdetect d
+	BlackThreshold float64       // how dark a pixel has to be to count as black, blackdetect pix_th
+	SilenceNoise   string        // what counts as silence, silencedetect noise, e.g. -50dB
+	SilenceMin     time.Duration // shortest silence that counts, silencedetect d
+	MaxSpot        time.Duration // longest single ad
+	MinBreak       time.Duration
+	MaxBreak       time.Duration
+}
+
+// DefaultDetectOptions work for broadcast recordings with the usual 15 to 60 second spots.
+func DefaultDetectOptions() DetectOptions {
+	return DetectOptions{
+		BlackMin:       100 * time.Millisecond,
+		BlackThreshold: 0.10,
+		SilenceNoise:   "-50dB",
+		SilenceMin:     300 * time.Millisecond,
+		MaxSpot:        2 * time.Minute,
+		MinBreak:       30 * time.Second,
+		MaxBreak:       8 * time.Minute,
+	}
+}
+
+// Interval is a stretch of the video in seconds.
+type Interval struct {
+	Start float64
+	End   float64
+}
+
+var (
+	blackRe        = regexp.MustCompile(`black_start:\s*([0-9.]+)\s+black_end:\s*([0-9.]+)`)
+	silenceStartRe = regexp.MustCompile(`silence_start:\s*(-?[0-9.]+)`)
+	silenceEndRe   = regexp.MustCompile(`silence_end:\s*([0-9.]+)`)
+)
+
+// DetectChapters finds the commercial breaks with ffmpeg's blackdetect and silencedetect filters and
+// replaces the chapters of the video with them, titled Advertisement, and the segments in between.
+// It returns the breaks it found.
+func (v *Video) DetectChapters(opts DetectOptions) ([]Interval, error) {
+	black, silence, err := v.detect(opts)
+	if err != nil {
+		return nil, err
+	}
+	breaks := findBreaks(black, silence, opts)
+	v.Chapters = breakChapters(breaks, v.Duration, "blackdetect,silencedetect")
+	v.Synthetic = true
+	return breaks, nil
+}
+
+// detect runs the filters over the whole video, which takes about as long as decoding it.
+func (v *Video) detect(opts DetectOptions) (black []Interval, silence []Interval, err error) {
+	var out bytes.Buffer
+	args := []string{
+		"-hide_banner",
+		"-nostats",
+		"-i",
+		v.filePath,
+		"-vf",
+		fmt.Sprintf("blackdetect=d=%g:pix_th=%g", opts.BlackMin.Seconds(), opts.BlackThreshold),
+		"-af",
+		fmt.Sprintf("silencedetect=noise=%s:d=%g", opts.SilenceNoise, opts.SilenceMin.Seconds()),
+		"-f",
+		"null",
+		"-",
+	}
+	f, err := os.OpenFile("log.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stdout = f
+	cmd.Stderr = io.MultiWriter(f, &out)
+	err = cmd.Run()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error detecting the breaks of %s: %s", v.filePath, err)
+	}
+	black, silence = parseDetect(&out, v.Duration)
+	return black, silence, nil
+}
+
+// parseDetect reads the blackdetect and silencedetect lines of ffmpeg's log. A silence that is
+// still going on at the end of the log ends at duration.
+func parseDetect(r io.Reader, duration float64) (black []Interval, silence []Interval) {
+	scanner := bufio.NewScanner(r)
+	silenceStart := -1.0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := blackRe.FindStringSubmatch(line); m != nil {
+			start, _ := strconv.ParseFloat(m[1], 64)
+			end, _ := strconv.ParseFloat(m[2], 64)
+			black = append(black, Interval{start, end})
+			continue
+		}
+		if m := silenceStartRe.FindStringSubmatch(line); m != nil {
+			silenceStart, _ = strconv.ParseFloat(m[1], 64)
+			if silenceStart < 0 {
+				silenceStart = 0
+			}
+			continue
+		}
+		if m := silenceEndRe.FindStringSubmatch(line); m != nil && silenceStart >= 0 {
+			end, _ := strconv.ParseFloat(m[1], 64)
+			silence = append(silence, Interval{silenceStart, end})
+			silenceStart = -1
+		}
+	}
+	if silenceStart >= 0 && duration > silenceStart {
+		silence = append(silence, Interval{silenceStart, duration})
+	}
+	return black, silence
+}
+
+// boundaryTolerance is how far apart black frames and silence may be and still mark the same
+// boundary, audio and video of a recording are rarely cut at exactly the same frame.
+const boundaryTolerance = 0.5
+
+// boundaries returns where a run of black frames and a silence meet, in the middle of the black frames.
+func boundaries(black []Interval, silence []Interval) []float64 {
+	var res []float64
+	for _, b := range black {
+		for _, s := range silence {
+			if s.Start <= b.End+boundaryTolerance && b.Start <= s.End+boundaryTolerance {
+				res = append(res, (b.Start+b.End)/2)
+				break
+			}
+		}
+	}
+	sort.Float64s(res)
+	// black frames split by a single lighter frame are one boundary
+	var dedup []float64
+	for _, t := range res {
+		if len(dedup) > 0 && t-dedup[len(dedup)-1] < 1 {
+			continue
+		}
+		dedup = append(dedup, t)
+	}
+	return dedup
+}
+
+// findBreaks groups the boundaries into commercial breaks.
+func findBreaks(black []Interval, silence []Interval, opts DetectOptions) []Interval {
+	bounds := boundaries(black, silence)
+	var breaks []Interval
+	for i := 0; i < len(bounds); {
+		j := i
+		for j+1 < len(bounds) && bounds[j+1]-bounds[j] <= opts.MaxSpot.Seconds() {
+			j++
+		}
+		length := bounds[j] - bounds[i]
+		if length >= opts.MinBreak.Seconds() && length <= opts.MaxBreak.Seconds() {
+			breaks = append(breaks, Interval{bounds[i], bounds[j]})
+		}
+		i = j + 1
+	}
+	return breaks
+}
+
+// breakChapters turns the breaks into chapters covering the whole video, the breaks titled
+// Advertisement so the default chapter rule removes them. Their source tag says where they came from.
+func breakChapters(breaks []Interval, duration float64, source string) []Chapter {
+	var res []Chapter
+	add := func(start float64, end float64, title string) {
+		if end-start < 0.5 {
+			return
+		}
+		res = append(res, Chapter{
+			ID:    int64(len(res)),
+			Start: start,
+			End:   end,
+			Title: title,
+			Tags:  map[string]string{"title": title, "source": source},
+		})
+	}
+	pos := 0.0
+	segment := 1
+	for _, b := range breaks {
+		if b.Start-pos >= 0.5 {
+			add(pos, b.Start, fmt.Sprintf("Segment %d", segment))
+			segment++
+		}
+		add(b.Start, b.End, "Advertisement")
+		pos = b.End
+	}
+	if len(breaks) > 0 {
+		add(pos, duration, fmt.Sprintf("Segment %d", segment))
+	}
+	return res
+}
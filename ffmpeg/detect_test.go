@@ -0,0 +1,86 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+)
+
+const detectLog = `Input #0, matroska,webm, from 'show.mkv':
+  Duration: 00:22:00.00, start: 0.000000, bitrate: 4000 kb/s
+[silencedetect @ 0x5581c0] silence_start: -0.0213
+[silencedetect @ 0x5581c0] silence_end: 0.52 | silence_duration: 0.5413
+[blackdetect @ 0x5581a0] black_start:0 black_end:0.6 black_duration:0.6
+[blackdetect @ 0x5581a0] black_start:300.1 black_end:300.9 black_duration:0.8
+[silencedetect @ 0x5581c0] silence_start: 300.2
+[silencedetect @ 0x5581c0] silence_end: 301.1 | silence_duration: 0.9
+[blackdetect @ 0x5581a0] black_start:330.4 black_end:330.6 black_duration:0.2
+[silencedetect @ 0x5581c0] silence_start: 330.0
+[silencedetect @ 0x5581c0] silence_end: 330.5 | silence_duration: 0.5
+[blackdetect @ 0x5581a0] black_start:331.0 black_end:331.2 black_duration:0.2
+[blackdetect @ 0x5581a0] black_start:390.5 black_end:391.5 black_duration:1.0
+[silencedetect @ 0x5581c0] silence_start: 391.6
+[silencedetect @ 0x5581c0] silence_end: 392.0 | silence_duration: 0.4
+[blackdetect @ 0x5581a0] black_start:420.0 black_end:420.5 black_duration:0.5
+[silencedetect @ 0x5581c0] silence_start: 420.1
+[silencedetect @ 0x5581c0] silence_end: 420.4 | silence_duration: 0.3
+[blackdetect @ 0x5581a0] black_start:800.0 black_end:800.4 black_duration:0.4
+[blackdetect @ 0x5581a0] black_start:1000.0 black_end:1000.4 black_duration:0.4
+[silencedetect @ 0x5581c0] silence_start: 1000.0
+[silencedetect @ 0x5581c0] silence_end: 1000.4 | silence_duration: 0.4
+[silencedetect @ 0x5581c0] silence_start: 1318.5
+frame=31680 fps=800 q=-0.0 Lsize=N/A time=00:22:00.00 bitrate=N/A speed=33x
+`
+
+func TestParseDetect(t *testing.T) {
+	black, silence := parseDetect(strings.NewReader(detectLog), 1320)
+	if len(black) != 8 || black[1].Start != 300.1 || black[1].End != 300.9 {
+		t.Fatalf("unexpected black frames %v", black)
+	}
+	if len(silence) != 7 {
+		t.Fatalf("expected 7 silences, got %v", silence)
+	}
+	if silence[0].Start != 0 {
+		t.Fatalf("expected a silence starting before the video to start at 0, got %f", silence[0].Start)
+	}
+	if last := silence[len(silence)-1]; last.Start != 1318.5 || last.End != 1320 {
+		t.Fatalf("expected the silence that lasts to the end to end with the video, got %v", last)
+	}
+}
+
+func TestFindBreaks(t *testing.T) {
+	black, silence := parseDetect(strings.NewReader(detectLog), 1320)
+
+	bounds := boundaries(black, silence)
+	// 331.1 is too close to 330.5 and 800.2 has no silence
+	want := []float64{0.3, 300.5, 330.5, 391, 420.25, 1000.2}
+	if len(bounds) != len(want) {
+		t.Fatalf("expected the boundaries %v, got %v", want, bounds)
+	}
+	for i := range want {
+		if bounds[i] < want[i]-0.01 || bounds[i] > want[i]+0.01 {
+			t.Fatalf("expected the boundaries %v, got %v", want, bounds)
+		}
+	}
+
+	breaks := findBreaks(black, silence, DefaultDetectOptions())
+	if len(breaks) != 1 || breaks[0].Start != 300.5 || breaks[0].End != 420.25 {
+		t.Fatalf("expected one break from 300.5 to 420.25, got %v", breaks)
+	}
+
+	chapters := breakChapters(breaks, 1320, "test")
+	if len(chapters) != 3 {
+		t.Fatalf("expected 3 chapters, got %v", chapters)
+	}
+	if chapters[0].Title != "Segment 1" || chapters[1].Title != "Advertisement" || chapters[2].Title != "Segment 2" || chapters[2].End != 1320 {
+		t.Fatalf("unexpected chapters %+v", chapters)
+	}
+	v := Video{Chapters: chapters}
+	kept := v.GetNonAdIndexes(false)
+	if len(kept) != 2 || kept[0] != 0 || kept[1] != 2 {
+		t.Fatalf("expected the default rule to remove the detected break, got %v", kept)
+	}
+
+	if breakChapters(nil, 1320, "test") != nil {
+		t.Fatal("expected no chapters when no break was found, the video is copied as is")
+	}
+}
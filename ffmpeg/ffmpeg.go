@@ -1,28 +1,33 @@
 package ffmpeg
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 )
 
-type Chapter struct {
-	start float64
-	end   float64
-	title string
-}
-
+// Video is a video file with what ffprobe reports about it.
 type Video struct {
 	videoBaseName string
 	videoExt      string
 	filePath      string
 	TmpFolder     string
-	chapters      []Chapter
+	CutMode       CutMode             // KeyframeCut unless set
+	MarkBreaks    bool                // tag the chapters of the recut video that follow a removed break
+	Keep          StreamSelection     // the audio and subtitle streams to keep
+	Sidecars      []string            // the .srt sidecars that go with the video Recut returns
+	OnProgress    func(RecutProgress) // called while Recut runs ffmpeg
+	FormatName    string              // e.g. matroska,webm
+	Duration      float64             // seconds
+	Size          int64
+	BitRate       int64
+	Tags          map[string]string // tags of the container, e.g. title
+	Streams       []Stream
+	Chapters      []Chapter
+	Synthetic     bool // the chapters were made from a cut list or detected breaks, the recording has no intro then
 }
 
 func NewVideo(filePath string, tmpFolder string) (Video, error) {
@@ -37,114 +42,63 @@ func NewVideo(filePath string, tmpFolder string) (Video, error) {
 			return Video{}, fmt.Errorf("error renaming file: %s", err)
 		}
 		filePath = newVidPath
-		vidname = newVidName
 	}
 
-	ext := filepath.Ext(vidname)
+	video, err := Probe(filePath)
+	if err != nil {
+		return Video{}, err
+	}
+	video.TmpFolder = tmpFolder
+	return video, nil
+}
 
+// Probe reads what ffprobe reports about the video without touching the file, unlike NewVideo
+// it does not get it ready to be recut.
+func Probe(filePath string) (Video, error) {
+	vidname := filepath.Base(filePath)
+	ext := filepath.Ext(vidname)
 	video := Video{
 		filePath:      filePath,
-		TmpFolder:     tmpFolder,
 		videoBaseName: strings.Replace(vidname, ext, "", -1),
 		videoExt:      ext,
 	}
-
-	err := video.getChapterInfo()
+	err := video.probe()
 	if err != nil {
 		return Video{}, err
 	}
 	return video, nil
 }
 
-func (v *Video) getChapterInfo() error {
-	var out bytes.Buffer
-	args := []string{
-		"-i",
-		v.filePath,
-		"-show_chapters",
-		"-loglevel",
-		"error",
-	}
-	f, err := os.OpenFile("log.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	mwriter := io.MultiWriter(f, &out)
-	cmd := exec.Command("ffprobe", args...)
-	cmd.Stdout = mwriter
-	cmd.Stderr = f
-	err = cmd.Run()
-	if err != nil {
-		return fmt.Errorf("error running ffprobe with the args: %s, %s", args, err)
-	}
-	chapterNum := 0
-	for {
-		line, err := out.ReadString('\n')
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("error reading chapter information: %s", err)
-		}
-		line = strings.TrimRight(line, "\r\n\t")
-		if line == "[CHAPTER]" { // then the next lines are the chapter information
-			v.chapters = append(v.chapters, Chapter{})
-			for {
-				chaptline, err := out.ReadString('\n')
-				if err == io.EOF {
-					break
-				}
-				if err != nil {
-					return fmt.Errorf("error reading chapter line: %s", err)
-				}
-				chaptline = strings.ToLower(strings.TrimRight(chaptline, "\r\n\t"))
-				if strings.HasPrefix(chaptline, "start_time=") {
-					parts := strings.Split(chaptline, "=")
-					if len(parts) != 2 {
-						return fmt.Errorf("malformed start_time chapter information")
-					}
-					v.chapters[chapterNum].start, err = strconv.ParseFloat(parts[1], 64)
-					if err != nil {
-						return fmt.Errorf("unable to parse start information")
-					}
-				}
-				if strings.HasPrefix(chaptline, "end_time=") {
-					parts := strings.Split(chaptline, "=")
-					if len(parts) != 2 {
-						return fmt.Errorf("malformed end_time chapter information")
-					}
-					v.chapters[chapterNum].end, err = strconv.ParseFloat(parts[1], 64)
-					if err != nil {
-						return fmt.Errorf("unable to parse end information")
-					}
-				}
-				if strings.HasPrefix(chaptline, "tag:title=") {
-					parts := strings.Split(chaptline, "=")
-					if len(parts) != 2 {
-						return fmt.Errorf("malformed title chapter information")
-					}
-					v.chapters[chapterNum].title = parts[1]
-					break
-				}
-			}
-			chapterNum++
-		}
-	}
-	return nil
+// FilePath returns the path of the video.
+func (v *Video) FilePath() string {
+	return v.filePath
 }
 
+// Recut writes the chapters at ndxs to a new video in the temp folder, or copies the video when ndxs is nil.
+// The .srt sidecars of the video are trimmed to match and listed in Sidecars.
 func (v *Video) Recut(ndxs []int) (string, error) {
 	// remove the single quotes from the v.videoBaseName
 	videoBaseName := strings.Replace(v.videoBaseName, "'", "", -1)
 	tempVideo := filepath.Join(v.TmpFolder, fmt.Sprintf("%s%s", videoBaseName, v.videoExt))
+	sidecars, err := v.SubtitleSidecars()
+	if err != nil {
+		return "", fmt.Errorf("error looking for subtitles: %s", err)
+	}
 	if ndxs == nil {
-		// just copy the file to the temp location
 		err := os.MkdirAll(v.TmpFolder, os.ModePerm)
 		if err != nil {
 			return "", fmt.Errorf("error creating temp folder: %s", err)
 		}
+		v.Sidecars = sidecars
+		if !v.Keep.empty() {
+			err = v.remux(tempVideo)
+			if err != nil {
+				return "", fmt.Errorf("error selecting streams: %s", err)
+			}
+			return tempVideo, nil
+		}
 
+		// just copy the file to the temp location
 		srcFile, err := os.Open(v.filePath)
 		if err != nil {
 			return "", fmt.Errorf("error opening source file: %s", err)
@@ -164,41 +118,79 @@ func (v *Video) Recut(ndxs []int) (string, error) {
 
 		return tempVideo, nil
 	}
+	var segments []Interval
+	for _, ndx := range ndxs {
+		segments = append(segments, Interval{v.Chapters[ndx].Start, v.Chapters[ndx].End})
+	}
+	segments = mergeIntervals(segments)
+	// the concat demuxer loses the chapters, the ones that are kept are written back afterwards
+	chaptersFile, err := v.writeChapters(ndxs)
+	if err != nil {
+		return "", err
+	}
+	if v.CutMode == AccurateCut {
+		err = v.recutAccurate(segments, chaptersFile, tempVideo)
+	} else {
+		err = v.recutKeyframe(ndxs, segments, chaptersFile, tempVideo)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	v.Sidecars = nil
+	for _, p := range sidecars {
+		out := filepath.Join(v.TmpFolder, videoBaseName+strings.TrimPrefix(filepath.Base(p), v.videoBaseName))
+		err := trimSidecar(p, segments, out)
+		if err != nil {
+			return "", err
+		}
+		v.Sidecars = append(v.Sidecars, out)
+	}
+	return tempVideo, nil
+}
+
+// recutKeyframe joins the chapters at ndxs straight from the video, cutting on the keyframes.
+func (v *Video) recutKeyframe(ndxs []int, segments []Interval, chaptersFile string, tempVideo string) error {
 	// Create a text document used to reassemble:
 	concatString := ""
 
 	for _, ndx := range ndxs {
-		concatString = fmt.Sprintf("%sfile '%s'\ninpoint %f\noutpoint %f\n", concatString, v.filePath, v.chapters[ndx].start, v.chapters[ndx].end)
+		concatString = fmt.Sprintf("%sfile '%s'\ninpoint %f\noutpoint %f\n", concatString, v.filePath, v.Chapters[ndx].Start, v.Chapters[ndx].End)
 	}
 	concatFile := filepath.Join(v.TmpFolder, "concat.txt")
 	err := os.WriteFile(concatFile, []byte(concatString), 0644)
 	if err != nil {
-		return "", fmt.Errorf("error writing concat file: %s", err)
+		return fmt.Errorf("error writing concat file: %s", err)
 	}
 
-	err = runFFmpegCommand([]string{"-y", "-f", "concat", "-safe", "0", "-i", concatFile, "-c", "copy", "-map", "0", tempVideo})
+	kept := totalLength(segments)
+	err = v.concat(concatFile, chaptersFile, v.streamMaps(0), nil, tempVideo, v.tracker(kept), kept)
 	if err != nil {
-		return "", fmt.Errorf("error concatenating parts: %s", err)
+		return fmt.Errorf("error concatenating parts: %s", err)
 	}
+	return nil
+}
 
-	return tempVideo, nil
+// concat joins the files listed in concatFile, length seconds together, into out with the streams maps
+// picks, the chapters of chaptersFile and the attachments of the video, which the concat demuxer drops.
+// Streams are copied unless codecs says otherwise.
+func (v *Video) concat(concatFile string, chaptersFile string, maps []string, codecs []string, out string, t *progressTracker, length float64) error {
+	args := []string{"-y", "-f", "concat", "-safe", "0", "-i", concatFile, "-f", "ffmetadata", "-i", chaptersFile}
+	args = append(args, v.attachmentMaps(2)...)
+	args = append(args, maps...)
+	args = append(args, "-map_chapters", "1", "-c", "copy")
+	args = append(args, codecs...)
+	args = append(args, out)
+	return runFFmpegProgress(args, t, length)
 }
 
+// GetNonAdIndexes returns the chapters that are not PlayOn ads, see KeptIndexes for other rules.
 func (v *Video) GetNonAdIndexes(skipFirst bool) []int {
-	if len(v.chapters) == 0 {
-		return nil
-	}
-	var nonads []int
-	for i, chap := range v.chapters {
-		if strings.ToLower(chap.title) != "advertisement" {
-			nonads = append(nonads, i)
-		}
-	}
+	var rules []ChapterRule
 	if skipFirst {
-		return nonads[1:]
+		rules = append(rules, SkipFirstRule())
 	}
-
-	return nonads
+	return v.KeptIndexes(append(rules, AdvertisementRule()))
 }
 
 func runFFmpegCommand(args []string) error {
@@ -6,17 +6,17 @@ import (
 )
 
 func TestGetChapterInfo(t *testing.T) {
-	video, err := NewVideo("C:\\artifacts\\original.mp4")
+	video, err := NewVideo("C:\\artifacts\\original.mp4", "C:\\artifacts\\tmp")
 	if err != nil {
 		t.Fatal(err)
 	}
-	if video.Chapters[1].end != 20.967 {
-		t.Fatalf("Expected the second chapter to end on 20967 but it ended on %f", video.Chapters[1].end)
+	if video.Chapters[1].End != 20.967 {
+		t.Fatalf("Expected the second chapter to end on 20967 but it ended on %f", video.Chapters[1].End)
 	}
 }
 
 func TestReassembleChapters(t *testing.T) {
-	video, err := NewVideo("C:\\artifacts\\original.mp4")
+	video, err := NewVideo("C:\\artifacts\\original.mp4", "C:\\artifacts\\tmp")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -27,7 +27,7 @@ func TestReassembleChapters(t *testing.T) {
 }
 
 func TestGetNonAdIndexes(t *testing.T) {
-	video, err := NewVideo("C:\\artifacts\\original.mp4")
+	video, err := NewVideo("C:\\artifacts\\original.mp4", "C:\\artifacts\\tmp")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,81 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BreakTag is set on a chapter of a recut video that follows a removed break, to how many seconds were removed.
+const BreakTag = "break_removed"
+
+// keptChapters returns the chapters at ndxs as they are in the recut video: moved up by everything
+// removed before them, with their original titles. With markBreaks the chapters that follow a removed
+// stretch get a BreakTag.
+func (v *Video) keptChapters(ndxs []int, markBreaks bool) []Chapter {
+	var res []Chapter
+	pos := 0.0  // in the recut video
+	prev := 0.0 // end of the previous kept chapter in the original
+	for _, ndx := range ndxs {
+		c := v.Chapters[ndx]
+		length := c.End - c.Start
+		kept := Chapter{ID: int64(len(res)), Start: pos, End: pos + length, Title: c.Title}
+		if c.Title != "" {
+			kept.Tags = map[string]string{"title": c.Title}
+		}
+		if removed := c.Start - prev; markBreaks && removed > 0.5 {
+			if kept.Tags == nil {
+				kept.Tags = map[string]string{}
+			}
+			kept.Tags[BreakTag] = fmt.Sprintf("%.3f", removed)
+		}
+		res = append(res, kept)
+		pos += length
+		prev = c.End
+	}
+	return res
+}
+
+// ffmetadata writes the chapters in ffmpeg's metadata format, in milliseconds.
+func ffmetadata(chapters []Chapter) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for _, c := range chapters {
+		b.WriteString("[CHAPTER]\nTIMEBASE=1/1000\n")
+		fmt.Fprintf(&b, "START=%d\nEND=%d\n", int64(math.Round(c.Start*1000)), int64(math.Round(c.End*1000)))
+		keys := make([]string, 0, len(c.Tags))
+		for k := range c.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s=%s\n", escapeMetadata(k), escapeMetadata(c.Tags[k]))
+		}
+	}
+	return b.String()
+}
+
+// escapeMetadata escapes the characters the metadata format gives a meaning.
+func escapeMetadata(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune("=;#\\\n", r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// writeChapters writes the chapters of the recut video to a metadata file in the temp folder.
+func (v *Video) writeChapters(ndxs []int) (string, error) {
+	p := filepath.Join(v.TmpFolder, "chapters.txt")
+	err := os.WriteFile(p, []byte(ffmetadata(v.keptChapters(ndxs, v.MarkBreaks))), 0644)
+	if err != nil {
+		return "", fmt.Errorf("error writing chapter file: %s", err)
+	}
+	return p, nil
+}
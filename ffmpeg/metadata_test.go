@@ -0,0 +1,51 @@
+package ffmpeg
+
+import (
+	"testing"
+)
+
+func TestKeptChapters(t *testing.T) {
+	v := Video{Chapters: []Chapter{
+		{Start: 0, End: 5, Title: "Recorded by PlayOn"},
+		{Start: 5, End: 300, Title: "Act 1"},
+		{Start: 300, End: 420, Title: "Advertisement"},
+		{Start: 420, End: 900, Title: "Act 2"},
+		{Start: 900, End: 1200},
+	}}
+	kept := v.keptChapters([]int{1, 3, 4}, true)
+	want := []Chapter{
+		{Start: 0, End: 295, Title: "Act 1"},
+		{Start: 295, End: 775, Title: "Act 2"},
+		{Start: 775, End: 1075},
+	}
+	if len(kept) != len(want) {
+		t.Fatalf("expected %+v, got %+v", want, kept)
+	}
+	for i, w := range want {
+		if kept[i].Start != w.Start || kept[i].End != w.End || kept[i].Title != w.Title || kept[i].ID != int64(i) {
+			t.Fatalf("expected %+v, got %+v", want, kept)
+		}
+	}
+	if kept[0].Tags[BreakTag] != "5.000" || kept[1].Tags[BreakTag] != "120.000" {
+		t.Fatalf("expected the chapters after the removed stretches to be tagged, got %+v", kept)
+	}
+	if _, ok := kept[2].Tags[BreakTag]; ok {
+		t.Fatalf("expected the chapter right after a kept one not to be tagged, got %+v", kept[2])
+	}
+	if kept := v.keptChapters([]int{1, 3}, false); kept[1].Tags[BreakTag] != "" {
+		t.Fatalf("expected no break tags unless asked for, got %+v", kept)
+	}
+}
+
+func TestFFMetadata(t *testing.T) {
+	got := ffmetadata([]Chapter{
+		{Start: 0, End: 295.0004, Tags: map[string]string{"title": "Act 1; Scene=2", BreakTag: "5.000"}},
+		{Start: 295.0004, End: 775.5},
+	})
+	want := ";FFMETADATA1\n" +
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=295000\nbreak_removed=5.000\ntitle=Act 1\\; Scene\\=2\n" +
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=295000\nEND=775500\n"
+	if got != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, got)
+	}
+}
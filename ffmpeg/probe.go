@@ -0,0 +1,204 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// Chapter is a chapter of a video, PlayOn marks the ads with chapters titled Advertisement.
+type Chapter struct {
+	ID    int64
+	Start float64 // seconds
+	End   float64
+	Title string            // empty when the chapter has no title
+	Tags  map[string]string // every tag of the chapter, title included
+}
+
+// Stream is one of the video, audio, subtitle, data or attachment streams of a video.
+type Stream struct {
+	Index     int
+	CodecType string // video, audio, subtitle, data or attachment
+	CodecName string
+	Profile   string
+	Level     int // as ffprobe reports it, e.g. 41 for h264 4.1 or 123 for hevc 4.1, 0 when unknown
+	Width     int // video streams only
+	Height    int
+	PixFmt    string
+	Channels  int // audio streams only
+	Language  string
+	Duration  float64 // 0 when the container does not say
+	BitRate   int64
+	Tags      map[string]string
+}
+
+// probeOutput is what ffprobe prints with -print_format json. It gives most numbers as strings.
+type probeOutput struct {
+	Streams []struct {
+		Index     int               `json:"index"`
+		CodecType string            `json:"codec_type"`
+		CodecName string            `json:"codec_name"`
+		Profile   string            `json:"profile"`
+		Level     int               `json:"level"`
+		Width     int               `json:"width"`
+		Height    int               `json:"height"`
+		PixFmt    string            `json:"pix_fmt"`
+		Channels  int               `json:"channels"`
+		Duration  string            `json:"duration"`
+		BitRate   string            `json:"bit_rate"`
+		Tags      map[string]string `json:"tags"`
+	} `json:"streams"`
+	Chapters []struct {
+		ID        int64             `json:"id"`
+		StartTime string            `json:"start_time"`
+		EndTime   string            `json:"end_time"`
+		Tags      map[string]string `json:"tags"`
+	} `json:"chapters"`
+	Format struct {
+		FormatName string            `json:"format_name"`
+		Duration   string            `json:"duration"`
+		Size       string            `json:"size"`
+		BitRate    string            `json:"bit_rate"`
+		Tags       map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+// probe runs ffprobe on the video and fills in its format, streams and chapters.
+func (v *Video) probe() error {
+	var out bytes.Buffer
+	args := []string{
+		"-loglevel",
+		"error",
+		"-print_format",
+		"json",
+		"-show_chapters",
+		"-show_format",
+		"-show_streams",
+		"-i",
+		v.filePath,
+	}
+	f, err := os.OpenFile("log.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cmd := exec.Command("ffprobe", args...)
+	cmd.Stdout = io.MultiWriter(f, &out)
+	cmd.Stderr = f
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("error running ffprobe with the args: %s, %s", args, err)
+	}
+	return v.parseProbe(out.Bytes())
+}
+
+// parseProbe fills in the video from the json output of ffprobe.
+func (v *Video) parseProbe(data []byte) error {
+	var p probeOutput
+	err := json.Unmarshal(data, &p)
+	if err != nil {
+		return fmt.Errorf("error reading the ffprobe output of %s: %s", v.filePath, err)
+	}
+
+	v.FormatName = p.Format.FormatName
+	v.Tags = p.Format.Tags
+	if v.Duration, err = parseFloat(p.Format.Duration); err != nil {
+		return fmt.Errorf("unable to parse the duration of %s: %s", v.filePath, err)
+	}
+	if v.Size, err = parseInt(p.Format.Size); err != nil {
+		return fmt.Errorf("unable to parse the size of %s: %s", v.filePath, err)
+	}
+	if v.BitRate, err = parseInt(p.Format.BitRate); err != nil {
+		return fmt.Errorf("unable to parse the bit rate of %s: %s", v.filePath, err)
+	}
+
+	v.Streams = nil
+	for _, s := range p.Streams {
+		stream := Stream{
+			Index:     s.Index,
+			CodecType: s.CodecType,
+			CodecName: s.CodecName,
+			Profile:   s.Profile,
+			Level:     max(s.Level, 0),
+			Width:     s.Width,
+			Height:    s.Height,
+			PixFmt:    s.PixFmt,
+			Channels:  s.Channels,
+			Language:  s.Tags["language"],
+			Tags:      s.Tags,
+		}
+		if stream.Duration, err = parseFloat(s.Duration); err != nil {
+			return fmt.Errorf("unable to parse the duration of stream %d: %s", s.Index, err)
+		}
+		if stream.BitRate, err = parseInt(s.BitRate); err != nil {
+			return fmt.Errorf("unable to parse the bit rate of stream %d: %s", s.Index, err)
+		}
+		v.Streams = append(v.Streams, stream)
+	}
+
+	v.Chapters = nil
+	for i, c := range p.Chapters {
+		chapter := Chapter{
+			ID:    c.ID,
+			Title: c.Tags["title"],
+			Tags:  c.Tags,
+		}
+		if chapter.Start, err = parseFloat(c.StartTime); err != nil {
+			return fmt.Errorf("unable to parse the start of chapter %d: %s", i, err)
+		}
+		if chapter.End, err = parseFloat(c.EndTime); err != nil {
+			return fmt.Errorf("unable to parse the end of chapter %d: %s", i, err)
+		}
+		v.Chapters = append(v.Chapters, chapter)
+	}
+	return nil
+}
+
+// VideoStream returns the first video stream that is not a cover picture.
+func (v *Video) VideoStream() (Stream, bool) {
+	for _, s := range v.Streams {
+		if s.CodecType == "video" && s.CodecName != "mjpeg" && s.CodecName != "png" {
+			return s, true
+		}
+	}
+	return Stream{}, false
+}
+
+// StreamsOf returns the streams of the codec type, e.g. audio or subtitle.
+func (v *Video) StreamsOf(codecType string) []Stream {
+	var res []Stream
+	for _, s := range v.Streams {
+		if s.CodecType == codecType {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// Resolution returns the size of the picture, e.g. 1920x1080, or an empty string for audio only files.
+func (v *Video) Resolution() string {
+	s, ok := v.VideoStream()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", s.Width, s.Height)
+}
+
+// parseFloat parses the numbers ffprobe prints as strings, which are left out or N/A when unknown.
+func parseFloat(s string) (float64, error) {
+	if s == "" || s == "N/A" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseInt(s string) (int64, error) {
+	if s == "" || s == "N/A" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
@@ -0,0 +1,141 @@
+package ffmpeg
+
+import (
+	"testing"
+)
+
+const probeJSON = `{
+    "streams": [
+        {
+            "index": 0,
+            "codec_name": "h264",
+            "profile": "High",
+            "level": 31,
+            "codec_type": "video",
+            "width": 1280,
+            "height": 720,
+            "pix_fmt": "yuv420p",
+            "bit_rate": "N/A",
+            "tags": {"language": "eng"}
+        },
+        {
+            "index": 1,
+            "codec_name": "aac",
+            "codec_type": "audio",
+            "channels": 2,
+            "duration": "1302.528000",
+            "bit_rate": "128000",
+            "tags": {"language": "eng", "handler_name": "SoundHandler"}
+        },
+        {
+            "index": 2,
+            "codec_name": "mjpeg",
+            "codec_type": "video",
+            "width": 600,
+            "height": 900
+        }
+    ],
+    "chapters": [
+        {
+            "id": 0,
+            "time_base": "1/1000",
+            "start": 0,
+            "start_time": "0.000000",
+            "end": 5005,
+            "end_time": "5.005000",
+            "tags": {"title": "Recorded by PlayOn"}
+        },
+        {
+            "id": 1,
+            "time_base": "1/1000",
+            "start": 5005,
+            "start_time": "5.005000",
+            "end": 20967,
+            "end_time": "20.967000",
+            "tags": {"title": "Advertisement"}
+        },
+        {
+            "id": 2,
+            "time_base": "1/1000",
+            "start": 20967,
+            "start_time": "20.967000",
+            "end": 1302528,
+            "end_time": "1302.528000"
+        },
+        {
+            "id": 3,
+            "time_base": "1/1000",
+            "start": 1302528,
+            "start_time": "1302.528000",
+            "end": 1302600,
+            "end_time": "1302.600000",
+            "tags": {"title": "Act=2 Scene=1", "comment": "from the EPG"}
+        }
+    ],
+    "format": {
+        "filename": "show.mp4",
+        "nb_streams": 3,
+        "format_name": "mov,mp4,m4a,3gp,3g2,mj2",
+        "duration": "1302.600000",
+        "size": "987654321",
+        "bit_rate": "6065533",
+        "tags": {"title": "Show S01E01"}
+    }
+}`
+
+func TestParseProbe(t *testing.T) {
+	v := Video{filePath: "show.mp4"}
+	err := v.parseProbe([]byte(probeJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Duration != 1302.6 || v.Size != 987654321 || v.BitRate != 6065533 || v.Tags["title"] != "Show S01E01" {
+		t.Fatalf("unexpected format %s %f %d %d %v", v.FormatName, v.Duration, v.Size, v.BitRate, v.Tags)
+	}
+
+	if len(v.Streams) != 3 {
+		t.Fatalf("expected 3 streams, got %d", len(v.Streams))
+	}
+	if v.Resolution() != "1280x720" {
+		t.Fatalf("expected the resolution of the first video stream, got %s", v.Resolution())
+	}
+	audio := v.StreamsOf("audio")
+	if len(audio) != 1 || audio[0].CodecName != "aac" || audio[0].Channels != 2 || audio[0].BitRate != 128000 || audio[0].Language != "eng" {
+		t.Fatalf("unexpected audio streams %+v", audio)
+	}
+	if v.Streams[0].PixFmt != "yuv420p" {
+		t.Fatalf("expected the pixel format of the video stream, got %q", v.Streams[0].PixFmt)
+	}
+	if v.Streams[0].BitRate != 0 {
+		t.Fatalf("expected N/A to be read as 0, got %d", v.Streams[0].BitRate)
+	}
+
+	if len(v.Chapters) != 4 {
+		t.Fatalf("expected 4 chapters, got %d", len(v.Chapters))
+	}
+	if v.Chapters[0].Title != "Recorded by PlayOn" {
+		t.Fatalf("expected the title to keep its case, got %q", v.Chapters[0].Title)
+	}
+	if v.Chapters[1].Start != 5.005 || v.Chapters[1].End != 20.967 {
+		t.Fatalf("unexpected times of the second chapter %f %f", v.Chapters[1].Start, v.Chapters[1].End)
+	}
+	if v.Chapters[2].Title != "" || v.Chapters[2].End != 1302.528 {
+		t.Fatalf("unexpected chapter without a title %+v", v.Chapters[2])
+	}
+	if v.Chapters[3].Title != "Act=2 Scene=1" || v.Chapters[3].Tags["comment"] != "from the EPG" {
+		t.Fatalf("unexpected tags %+v", v.Chapters[3].Tags)
+	}
+
+	nonads := v.GetNonAdIndexes(true)
+	if len(nonads) != 2 || nonads[0] != 2 || nonads[1] != 3 {
+		t.Fatalf("expected chapters 2 and 3 to be kept, got %v", nonads)
+	}
+}
+
+func TestParseProbeBadOutput(t *testing.T) {
+	v := Video{filePath: "show.mp4"}
+	err := v.parseProbe([]byte(`{"chapters": [{"id": 0, "start_time": "soon", "end_time": "1.0"}]}`))
+	if err == nil {
+		t.Fatal("expected an error for a start time that is not a number")
+	}
+}
@@ -0,0 +1,104 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecutProgress is how far Recut is, see Video.OnProgress.
+type RecutProgress struct {
+	Fraction  float64
+	Speed     float64       // times real time, as ffmpeg reports it, 0 when unknown
+	Remaining time.Duration // estimated from the time taken so far, 0 when unknown
+}
+
+// progressTracker adds up the progress of the ffmpeg commands of one recut.
+type progressTracker struct {
+	total   float64 // seconds of video the commands write together
+	done    float64 // seconds written by the commands that finished
+	started time.Time
+	report  func(RecutProgress)
+}
+
+// tracker follows commands that write total seconds of video, it is nil when nobody listens.
+func (v *Video) tracker(total float64) *progressTracker {
+	if v.OnProgress == nil || total <= 0 {
+		return nil
+	}
+	return &progressTracker{total: total, started: time.Now(), report: v.OnProgress}
+}
+
+// update reports that the running command wrote pos seconds of video at speed.
+func (t *progressTracker) update(pos float64, speed float64) {
+	p := RecutProgress{Fraction: min(1, (t.done+pos)/t.total), Speed: speed}
+	if p.Fraction > 0 {
+		elapsed := time.Since(t.started)
+		p.Remaining = time.Duration(float64(elapsed) / p.Fraction * (1 - p.Fraction)).Round(time.Second)
+	}
+	t.report(p)
+}
+
+// parseProgress reads the key=value blocks ffmpeg writes with -progress and calls update at the
+// end of each with the seconds written so far and the speed.
+func parseProgress(r io.Reader, update func(pos float64, speed float64)) error {
+	pos, speed := 0.0, 0.0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		// both are in microseconds, out_time_ms is misnamed
+		case "out_time_us", "out_time_ms":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				pos = float64(us) / 1e6
+			}
+		case "speed":
+			speed, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "x"), 64)
+		case "progress":
+			update(pos, speed)
+		}
+	}
+	return scanner.Err()
+}
+
+// runFFmpegProgress runs a command that writes length seconds of video and reports its progress to
+// the tracker, the rest of what ffmpeg prints goes to the log like with runFFmpegCommand.
+func runFFmpegProgress(args []string, t *progressTracker, length float64) error {
+	if t == nil {
+		return runFFmpegCommand(args)
+	}
+	cmd := exec.Command("ffmpeg", append([]string{"-progress", "pipe:1", "-nostats"}, args...)...)
+
+	f, err := os.OpenFile("log.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cmd.Stderr = f
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	err = parseProgress(out, t.update)
+	if err != nil {
+		io.Copy(io.Discard, out)
+	}
+	err = cmd.Wait()
+	if err != nil {
+		return err
+	}
+	t.done += length
+	return nil
+}
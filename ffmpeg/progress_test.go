@@ -0,0 +1,66 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const progressOutput = `frame=0
+out_time_us=N/A
+out_time_ms=N/A
+speed=N/A
+progress=continue
+frame=240
+out_time_us=10010000
+out_time_ms=10010000
+out_time=00:00:10.010000
+speed=2.5x
+progress=continue
+frame=480
+out_time_ms=20020000
+speed=3x
+progress=end
+`
+
+func TestParseProgress(t *testing.T) {
+	var pos, speed []float64
+	err := parseProgress(strings.NewReader(progressOutput), func(p float64, s float64) {
+		pos = append(pos, p)
+		speed = append(speed, s)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pos) != 3 {
+		t.Fatalf("expected an update per block, got %v", pos)
+	}
+	if pos[0] != 0 || speed[0] != 0 {
+		t.Fatalf("expected N/A to be read as nothing written yet, got %f %f", pos[0], speed[0])
+	}
+	if pos[1] != 10.01 || speed[1] != 2.5 || pos[2] != 20.02 || speed[2] != 3 {
+		t.Fatalf("unexpected updates %v %v", pos, speed)
+	}
+}
+
+func TestProgressTracker(t *testing.T) {
+	var got []RecutProgress
+	v := Video{OnProgress: func(p RecutProgress) { got = append(got, p) }}
+	tr := v.tracker(100)
+	tr.started = time.Now().Add(-10 * time.Second)
+	tr.update(20, 2)
+	// a second command, the first one wrote 50 seconds
+	tr.done = 50
+	tr.update(60, 2)
+
+	if len(got) != 2 || got[0].Fraction != 0.2 || got[0].Speed != 2 || got[1].Fraction != 1 {
+		t.Fatalf("unexpected progress %+v", got)
+	}
+	if got[0].Remaining != 40*time.Second {
+		t.Fatalf("expected 40s left after 10s for a fifth, got %s", got[0].Remaining)
+	}
+
+	if (&Video{}).tracker(100) != nil || v.tracker(0) != nil {
+		t.Fatal("expected no tracker without a listener or a length")
+	}
+}
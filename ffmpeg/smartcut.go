@@ -0,0 +1,326 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CutMode is how Recut cuts the chapters out.
+type CutMode string
+
+const (
+	// KeyframeCut copies everything, fast, but every cut lands on the keyframe before it, which
+	// leaves a few seconds of the ad or a frozen frame at the joins.
+	KeyframeCut CutMode = "keyframe"
+	// AccurateCut re-encodes the frames between each cut and the nearest keyframe and copies the rest.
+	// The re-encoded frames get the profile, level and pixel format of the original, but the encoder
+	// still writes its own parameter sets (SPS and PPS for h264 and hevc). Every piece therefore
+	// carries them in front of its keyframes, the pieces are written as mkv and an mp4 is only muxed
+	// when they are joined, tagged avc3 or hev1 so players look for the parameter sets in the stream.
+	// Players that ignore those can still show a glitch at a join.
+	AccurateCut CutMode = "accurate"
+)
+
+// ParseCutMode checks a cut mode setting, empty is KeyframeCut.
+func ParseCutMode(s string) (CutMode, error) {
+	switch m := CutMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return KeyframeCut, nil
+	case KeyframeCut, AccurateCut:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown cut mode %q, expected keyframe or accurate", s)
+}
+
+// encoders are the encoders used to re-encode the frames around a cut, by codec. Other codecs
+// can only be cut on keyframes.
+var encoders = map[string][]string{
+	"h264":       {"libx264", "-preset", "medium", "-crf", "18"},
+	"hevc":       {"libx265", "-preset", "medium", "-crf", "20"},
+	"mpeg2video": {"mpeg2video", "-q:v", "2"},
+}
+
+// inBand are the bitstream filters that put the parameter sets of the original in front of every
+// keyframe of a copied piece, so a player switches back to them after a re-encoded piece.
+var inBand = map[string]string{
+	"h264": "h264_mp4toannexb",
+	"hevc": "hevc_mp4toannexb",
+}
+
+// inBandTags are the mp4 tags that say the parameter sets can change in the stream, by codec.
+var inBandTags = map[string]string{
+	"h264": "avc3",
+	"hevc": "hev1",
+}
+
+// cutPiece is a stretch of the video that is either copied or re-encoded.
+type cutPiece struct {
+	Start  float64
+	End    float64
+	Encode bool
+}
+
+// keyframeSlack is how close a cut may be to a keyframe to be treated as on it, the timestamps
+// ffprobe prints are rounded.
+const keyframeSlack = 0.001
+
+// planCuts splits the segments to keep into pieces: from each start to the first keyframe and from
+// the last keyframe to the end are re-encoded, in between is copied. keyframes has to be sorted.
+func planCuts(segments []Interval, keyframes []float64) []cutPiece {
+	var res []cutPiece
+	for _, seg := range segments {
+		// first keyframe at or after the start
+		i := sort.SearchFloat64s(keyframes, seg.Start-keyframeSlack)
+		// last keyframe at or before the end
+		j := sort.SearchFloat64s(keyframes, seg.End+keyframeSlack) - 1
+		if i >= len(keyframes) || j < 0 || keyframes[i] >= keyframes[j] {
+			res = append(res, cutPiece{seg.Start, seg.End, true})
+			continue
+		}
+		first, last := keyframes[i], keyframes[j]
+		if first-seg.Start > keyframeSlack {
+			res = append(res, cutPiece{seg.Start, first, true})
+		} else {
+			first = seg.Start
+		}
+		if seg.End-last <= keyframeSlack {
+			last = seg.End
+		}
+		res = append(res, cutPiece{first, last, false})
+		if seg.End > last {
+			res = append(res, cutPiece{last, seg.End, true})
+		}
+	}
+	return res
+}
+
+// keyframes lists the times of the keyframes of the main video stream.
+func (v *Video) keyframes() ([]float64, error) {
+	var out bytes.Buffer
+	args := []string{
+		"-loglevel",
+		"error",
+		"-select_streams",
+		"V:0",
+		"-skip_frame",
+		"nokey",
+		"-show_entries",
+		"frame=best_effort_timestamp_time",
+		"-of",
+		"csv=p=0",
+		v.filePath,
+	}
+	cmd := exec.Command("ffprobe", args...)
+	cmd.Stdout = &out
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("error listing the keyframes of %s: %s", v.filePath, err)
+	}
+	return parseKeyframes(&out)
+}
+
+// parseKeyframes reads one time per line, skipping frames without one.
+func parseKeyframes(r io.Reader) ([]float64, error) {
+	var res []float64
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.Trim(strings.TrimSpace(scanner.Text()), ",")
+		if line == "" || line == "N/A" {
+			continue
+		}
+		t, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected keyframe time %q", line)
+		}
+		res = append(res, t)
+	}
+	sort.Float64s(res)
+	return res, scanner.Err()
+}
+
+// pieceArgs are the ffmpeg arguments that write the piece to out. The selected streams are copied but the
+// main video stream of re-encoded pieces, which gets the codec, profile, level and pixel format of the
+// original. Either way the main video stream has its parameter sets in front of every keyframe.
+func (v *Video) pieceArgs(p cutPiece, out string) ([]string, error) {
+	args := []string{
+		"-y",
+		"-ss", fmt.Sprintf("%f", p.Start),
+		"-i", v.filePath,
+		"-t", fmt.Sprintf("%f", p.End-p.Start),
+	}
+	args = append(args, v.streamMaps(0)...)
+	// the kept chapters are added when the pieces are joined
+	args = append(args, "-map_chapters", "-1", "-c", "copy", "-avoid_negative_ts", "make_zero")
+	args = append(args, v.pieceSubtitles()...)
+	stream, ok := v.VideoStream()
+	if !ok {
+		if p.Encode {
+			return nil, fmt.Errorf("%s has no video stream to re-encode", v.filePath)
+		}
+		return append(args, out), nil
+	}
+	spec := v.videoSpec(stream)
+	if !p.Encode {
+		if bsf, ok := inBand[stream.CodecName]; ok {
+			args = append(args, "-bsf"+spec, bsf)
+		}
+		return append(args, out), nil
+	}
+	encoder, ok := encoders[stream.CodecName]
+	if !ok {
+		return nil, fmt.Errorf("accurate cuts cannot re-encode %s video, cut %s on keyframes instead", stream.CodecName, v.filePath)
+	}
+	args = append(args, "-c"+spec, encoder[0])
+	args = append(args, encoder[1:]...)
+	if profile := encoderProfile(stream); profile != "" {
+		args = append(args, "-profile"+spec, profile)
+	}
+	args = append(args, encoderParams(stream, spec)...)
+	if stream.PixFmt != "" {
+		args = append(args, "-pix_fmt"+spec, stream.PixFmt)
+	}
+	return append(args, out), nil
+}
+
+// encoderParams are the level of the original and the options that make the encoder repeat its
+// parameter sets in front of every keyframe. mpeg2video always repeats its sequence header.
+func encoderParams(s Stream, spec string) []string {
+	switch s.CodecName {
+	case "h264":
+		res := []string{"-x264-params" + spec, "repeat-headers=1"}
+		if s.Level > 0 {
+			res = append(res, "-level"+spec, strconv.Itoa(s.Level))
+		}
+		return res
+	case "hevc":
+		params := "repeat-headers=1"
+		if s.Level > 0 {
+			// ffprobe reports the general_level_idc, which is 30 times the level
+			params += fmt.Sprintf(":level-idc=%g", float64(s.Level)/30)
+		}
+		return []string{"-x265-params" + spec, params}
+	case "mpeg2video":
+		if s.Level > 0 {
+			return []string{"-level" + spec, strconv.Itoa(s.Level)}
+		}
+	}
+	return nil
+}
+
+// pieceSubtitles converts the mov_text subtitles of an mp4, which the mkv pieces cannot hold, to srt.
+func (v *Video) pieceSubtitles() []string {
+	var res []string
+	n := 0
+	for _, s := range v.SelectedStreams() {
+		if s.CodecType != "subtitle" {
+			continue
+		}
+		if s.CodecName == "mov_text" {
+			res = append(res, fmt.Sprintf("-c:s:%d", n), "srt")
+		}
+		n++
+	}
+	return res
+}
+
+// joinCodecs are the codec options that turn the mkv pieces into an mp4 when they are joined: the tag
+// for parameter sets in the stream and mov_text subtitles. Other containers take the pieces as they are.
+func (v *Video) joinCodecs() []string {
+	if !strings.EqualFold(v.videoExt, ".mp4") {
+		return nil
+	}
+	var res []string
+	if stream, ok := v.VideoStream(); ok {
+		if tag, ok := inBandTags[stream.CodecName]; ok {
+			res = append(res, "-tag"+v.videoSpec(stream), tag)
+		}
+	}
+	for _, s := range v.SelectedStreams() {
+		if s.CodecType == "subtitle" {
+			return append(res, "-c:s", "mov_text")
+		}
+	}
+	return res
+}
+
+// videoSpec is the stream specifier of a video stream, its index among the video streams, cover
+// pictures included, e.g. :v:0.
+func (v *Video) videoSpec(stream Stream) string {
+	ndx := 0
+	for _, s := range v.StreamsOf("video") {
+		if s.Index == stream.Index {
+			break
+		}
+		ndx++
+	}
+	return fmt.Sprintf(":v:%d", ndx)
+}
+
+// encoderProfile turns the profile ffprobe reports, e.g. High or Main 10, into what the encoder takes.
+func encoderProfile(s Stream) string {
+	profile := strings.ToLower(strings.ReplaceAll(s.Profile, " ", ""))
+	switch s.CodecName {
+	case "h264":
+		switch profile {
+		case "baseline", "constrainedbaseline":
+			return "baseline"
+		case "main", "high", "high10", "high422", "high444":
+			return profile
+		}
+	case "hevc":
+		switch profile {
+		case "main", "main10":
+			return profile
+		}
+	}
+	return ""
+}
+
+// recutAccurate writes the segments to keep piece by piece and joins them without cutting again.
+func (v *Video) recutAccurate(segments []Interval, chaptersFile string, tempVideo string) error {
+	keyframes, err := v.keyframes()
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp(v.TmpFolder, "pieces")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	// the pieces are written and then copied again by the concat
+	kept := totalLength(segments)
+	t := v.tracker(2 * kept)
+
+	var list strings.Builder
+	for i, p := range planCuts(segments, keyframes) {
+		out := filepath.Join(dir, fmt.Sprintf("piece%03d.mkv", i))
+		args, err := v.pieceArgs(p, out)
+		if err != nil {
+			return err
+		}
+		err = runFFmpegProgress(args, t, p.End-p.Start)
+		if err != nil {
+			return fmt.Errorf("error cutting %f to %f: %s", p.Start, p.End, err)
+		}
+		fmt.Fprintf(&list, "file '%s'\n", out)
+	}
+	concatFile := filepath.Join(dir, "concat.txt")
+	err = os.WriteFile(concatFile, []byte(list.String()), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing concat file: %s", err)
+	}
+	// the pieces only have the selected streams
+	err = v.concat(concatFile, chaptersFile, []string{"-map", "0"}, v.joinCodecs(), tempVideo, t, kept)
+	if err != nil {
+		return fmt.Errorf("error concatenating parts: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlanCuts(t *testing.T) {
+	keyframes := []float64{0, 2.002, 4.004, 6.006, 8.008, 10.01, 12.012}
+	pieces := planCuts([]Interval{{0, 5}, {6.006, 12.012}, {8.5, 9.5}}, keyframes)
+	want := []cutPiece{
+		{0, 4.004, false},
+		{4.004, 5, true},
+		{6.006, 12.012, false},
+		{8.5, 9.5, true},
+	}
+	if len(pieces) != len(want) {
+		t.Fatalf("expected %v, got %v", want, pieces)
+	}
+	for i := range want {
+		if pieces[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, pieces)
+		}
+	}
+
+	pieces = planCuts([]Interval{{1, 11}}, keyframes)
+	want = []cutPiece{{1, 2.002, true}, {2.002, 10.01, false}, {10.01, 11, true}}
+	for i := range want {
+		if len(pieces) != len(want) || pieces[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, pieces)
+		}
+	}
+
+	pieces = planCuts([]Interval{{1, 3}}, keyframes)
+	if len(pieces) != 1 || !pieces[0].Encode {
+		t.Fatalf("expected a segment with a single keyframe to be re-encoded, got %v", pieces)
+	}
+}
+
+func TestParseKeyframes(t *testing.T) {
+	kf, err := parseKeyframes(strings.NewReader("0.000000\n2.002000,\nN/A\n\n4.004000\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kf) != 3 || kf[1] != 2.002 {
+		t.Fatalf("unexpected keyframes %v", kf)
+	}
+	if _, err := parseKeyframes(strings.NewReader("soon\n")); err == nil {
+		t.Fatal("expected an error for a time that is not a number")
+	}
+}
+
+func TestPieceArgs(t *testing.T) {
+	v := Video{filePath: "show.mp4"}
+	err := v.parseProbe([]byte(probeJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, err := v.pieceArgs(cutPiece{1, 2.002, true}, "piece000.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(args, " ")
+	for _, want := range []string{"-ss 1.000000 -i show.mp4 -t 1.002000", "-map 0:0 -map 0:1 -map 0:2 -map_chapters -1 -c copy", "-c:v:0 libx264", "-profile:v:0 high", "-x264-params:v:0 repeat-headers=1", "-level:v:0 31", "-pix_fmt:v:0 yuv420p", "piece000.mkv"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in %s", want, got)
+		}
+	}
+	args, err = v.pieceArgs(cutPiece{2.002, 10.01, false}, "piece001.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(strings.Join(args, " "), "libx264") {
+		t.Fatalf("expected a copied piece not to be re-encoded, got %v", args)
+	}
+	if !strings.Contains(strings.Join(args, " "), "-bsf:v:0 h264_mp4toannexb") {
+		t.Fatalf("expected the parameter sets of a copied piece to be put in-band, got %v", args)
+	}
+
+	v.Streams[0].CodecName, v.Streams[0].Profile, v.Streams[0].Level = "hevc", "Main", 120
+	args, err = v.pieceArgs(cutPiece{1, 2.002, true}, "piece000.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(args, " "); !strings.Contains(got, "-x265-params:v:0 repeat-headers=1:level-idc=4") {
+		t.Fatalf("expected the level of the original for hevc, got %s", got)
+	}
+
+	v.Streams[0].CodecName = "vp9"
+	if _, err := v.pieceArgs(cutPiece{1, 2.002, true}, "piece000.mkv"); err == nil {
+		t.Fatal("expected an error for a codec that cannot be re-encoded")
+	}
+}
+
+func TestJoinCodecs(t *testing.T) {
+	v := Video{filePath: "show.mp4", videoExt: ".mp4", Streams: []Stream{
+		{Index: 0, CodecType: "video", CodecName: "h264"},
+		{Index: 1, CodecType: "audio", CodecName: "aac"},
+		{Index: 2, CodecType: "subtitle", CodecName: "mov_text"},
+	}}
+	if got := strings.Join(v.pieceSubtitles(), " "); got != "-c:s:0 srt" {
+		t.Fatalf("expected the mov_text subtitles to become srt in the pieces, got %s", got)
+	}
+	if got := strings.Join(v.joinCodecs(), " "); got != "-tag:v:0 avc3 -c:s mov_text" {
+		t.Fatalf("expected the mp4 to be tagged avc3 and get mov_text again, got %s", got)
+	}
+	v.videoExt = ".mkv"
+	if got := v.joinCodecs(); got != nil {
+		t.Fatalf("expected the pieces to be joined as they are into an mkv, got %v", got)
+	}
+}
+
+func TestParseCutMode(t *testing.T) {
+	for in, want := range map[string]CutMode{"": KeyframeCut, "Accurate": AccurateCut, "keyframe": KeyframeCut} {
+		got, err := ParseCutMode(in)
+		if err != nil || got != want {
+			t.Fatalf("expected %s for %q, got %s %v", want, in, got, err)
+		}
+	}
+	if _, err := ParseCutMode("exact"); err == nil {
+		t.Fatal("expected an error for an unknown cut mode")
+	}
+}
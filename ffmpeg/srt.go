@@ -0,0 +1,136 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// cue is one subtitle of an .srt file.
+type cue struct {
+	Start float64
+	End   float64
+	Text  string
+}
+
+// parseSRT reads the cues of an .srt file. The numbers before the times are not needed and skipped.
+func parseSRT(r io.Reader) ([]cue, error) {
+	var res []cue
+	var cur *cue
+	var text []string
+	flush := func() {
+		if cur != nil {
+			cur.Text = strings.Join(text, "\n")
+			res = append(res, *cur)
+		}
+		cur = nil
+		text = nil
+	}
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if n == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		switch {
+		case strings.Contains(line, "-->"):
+			flush()
+			times := strings.SplitN(line, "-->", 2)
+			start, err := parseSRTTime(times[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+			// the end can be followed by position settings
+			end, err := parseSRTTime(strings.Fields(times[1] + " ")[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+			cur = &cue{Start: start, End: end}
+		case strings.TrimSpace(line) == "":
+			flush()
+		case cur != nil:
+			text = append(text, line)
+		}
+	}
+	flush()
+	return res, scanner.Err()
+}
+
+// parseSRTTime parses 01:02:03,456, a dot instead of the comma is accepted.
+func parseSRTTime(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	parts := strings.Split(strings.Replace(s, ",", ".", 1), ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid subtitle time %q", s)
+	}
+	secs := 0.0
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid subtitle time %q", s)
+		}
+		secs = secs*60 + v
+	}
+	return secs, nil
+}
+
+// formatSRTTime writes the seconds as 01:02:03,456.
+func formatSRTTime(t float64) string {
+	ms := int64(math.Round(t * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// trimCues moves the cues to where they are once only the segments are kept. Cues in the removed
+// stretches are dropped, those that run into one are cut short. segments has to be sorted.
+func trimCues(cues []cue, segments []Interval) []cue {
+	var res []cue
+	for _, c := range cues {
+		pos := 0.0 // start of the segment in the recut video
+		for _, seg := range segments {
+			start, end := max(c.Start, seg.Start), min(c.End, seg.End)
+			if end > start {
+				res = append(res, cue{pos + start - seg.Start, pos + end - seg.Start, c.Text})
+			}
+			pos += seg.End - seg.Start
+		}
+	}
+	return res
+}
+
+// writeSRT writes the cues numbered from 1.
+func writeSRT(w io.Writer, cues []cue) error {
+	bw := bufio.NewWriter(w)
+	for i, c := range cues {
+		fmt.Fprintf(bw, "%d\n%s --> %s\n%s\n\n", i+1, formatSRTTime(c.Start), formatSRTTime(c.End), c.Text)
+	}
+	return bw.Flush()
+}
+
+// trimSidecar writes the .srt at p to out with the cues moved to match the segments kept of the video.
+func trimSidecar(p string, segments []Interval, out string) error {
+	in, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	cues, err := parseSRT(in)
+	if err != nil {
+		return fmt.Errorf("error reading the subtitles %s: %s", p, err)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = writeSRT(f, trimCues(cues, segments))
+	if err != nil {
+		return fmt.Errorf("error writing the subtitles %s: %s", out, err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const srtFixture = "\ufeff1\r\n00:00:01,000 --> 00:00:03,500\r\nHello\r\nthere\r\n\r\n" +
+	"2\n00:00:12.000 --> 00:00:14,000 X1:40 X2:600\n<i>Buy now</i>\n\n" +
+	"3\n00:00:19,000 --> 00:00:22,000\nBack to the show\n"
+
+func TestParseSRT(t *testing.T) {
+	cues, err := parseSRT(strings.NewReader(srtFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cues) != 3 {
+		t.Fatalf("expected 3 cues, got %+v", cues)
+	}
+	if cues[0].Start != 1 || cues[0].End != 3.5 || cues[0].Text != "Hello\nthere" {
+		t.Fatalf("unexpected first cue %+v", cues[0])
+	}
+	if cues[1].Start != 12 || cues[1].End != 14 {
+		t.Fatalf("expected a dot and position settings to be accepted, got %+v", cues[1])
+	}
+	if _, err := parseSRT(strings.NewReader("1\n00:01,000 --> 00:00:02,000\nHi\n")); err == nil {
+		t.Fatal("expected an error for a time without hours")
+	}
+}
+
+func TestTrimCues(t *testing.T) {
+	cues, err := parseSRT(strings.NewReader(srtFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the break from 10s to 20s is removed
+	trimmed := trimCues(cues, []Interval{{0, 10}, {20, 3600}})
+	if len(trimmed) != 2 {
+		t.Fatalf("expected the cue in the break to be dropped, got %+v", trimmed)
+	}
+	if trimmed[1].Start != 10 || trimmed[1].End != 12 {
+		t.Fatalf("expected the cue running out of the break to be cut short and moved up, got %+v", trimmed[1])
+	}
+
+	var b bytes.Buffer
+	err = writeSRT(&b, trimmed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "1\n00:00:01,000 --> 00:00:03,500\nHello\nthere\n\n2\n00:00:10,000 --> 00:00:12,000\nBack to the show\n\n"
+	if b.String() != want {
+		t.Fatalf("unexpected srt\n%s", b.String())
+	}
+	if got := formatSRTTime(3723.4567); got != "01:02:03,457" {
+		t.Fatalf("unexpected time %s", got)
+	}
+}
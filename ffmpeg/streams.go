@@ -0,0 +1,127 @@
+package ffmpeg
+
+import (
+	"cleansync/filesystem"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// StreamSelection picks the audio and subtitle streams Recut keeps by language, e.g. eng. Empty keeps
+// them all. Video streams and attachments such as fonts are always kept, data streams such as timecodes
+// only when nothing is selected, like they were before streams could be picked.
+type StreamSelection struct {
+	AudioLanguages    []string
+	SubtitleLanguages []string
+}
+
+// empty reports whether the selection keeps every stream.
+func (s StreamSelection) empty() bool {
+	return len(s.AudioLanguages) == 0 && len(s.SubtitleLanguages) == 0
+}
+
+// matchLanguage reports whether lang is one of langs, which keeps everything when empty. Two letter
+// codes match the three letter ones they start, en matches eng.
+func matchLanguage(lang string, langs []string) bool {
+	if len(langs) == 0 {
+		return true
+	}
+	lang = strings.ToLower(lang)
+	for _, l := range langs {
+		l = strings.ToLower(l)
+		if l == lang || (len(l) == 2 && strings.HasPrefix(lang, l)) || (len(lang) == 2 && strings.HasPrefix(l, lang)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectedStreams returns the streams Recut keeps, attachments aside. When no audio stream has one of
+// the audio languages all audio is kept, a video without sound is never what was asked for.
+func (v *Video) SelectedStreams() []Stream {
+	var audio []Stream
+	for _, s := range v.StreamsOf("audio") {
+		if matchLanguage(s.Language, v.Keep.AudioLanguages) {
+			audio = append(audio, s)
+		}
+	}
+	if len(audio) == 0 {
+		audio = v.StreamsOf("audio")
+	}
+	var res []Stream
+	for _, s := range v.Streams {
+		switch s.CodecType {
+		case "video":
+			res = append(res, s)
+		case "audio":
+			for _, a := range audio {
+				if a.Index == s.Index {
+					res = append(res, s)
+				}
+			}
+		case "subtitle":
+			if matchLanguage(s.Language, v.Keep.SubtitleLanguages) {
+				res = append(res, s)
+			}
+		case "data":
+			if v.Keep.empty() && !v.chapterTrack(s) {
+				res = append(res, s)
+			}
+		}
+	}
+	return res
+}
+
+// chapterTrack reports whether s is the text track mp4 and mov keep the chapters in. ffprobe shows it
+// as a bin_data stream, which the muxer cannot copy but writes again from the chapters.
+func (v *Video) chapterTrack(s Stream) bool {
+	return s.CodecType == "data" && s.CodecName == "bin_data" && strings.Contains(v.FormatName, "mp4") && len(v.Chapters) > 0
+}
+
+// streamMaps maps the selected streams of the input, which has the streams of the video.
+func (v *Video) streamMaps(input int) []string {
+	var res []string
+	for _, s := range v.SelectedStreams() {
+		res = append(res, "-map", fmt.Sprintf("%d:%d", input, s.Index))
+	}
+	return res
+}
+
+// attachmentMaps adds the attachments of the video, which the concat demuxer drops, as an input
+// that is numbered input.
+func (v *Video) attachmentMaps(input int) []string {
+	if len(v.StreamsOf("attachment")) == 0 {
+		return nil
+	}
+	return []string{"-i", v.filePath, "-map", fmt.Sprintf("%d:t", input)}
+}
+
+// remux writes the selected streams to out without cutting anything.
+func (v *Video) remux(out string) error {
+	args := []string{"-y", "-i", v.filePath}
+	args = append(args, v.streamMaps(0)...)
+	args = append(args, "-map", "0:t?", "-c", "copy", out)
+	return runFFmpegProgress(args, v.tracker(v.Duration), v.Duration)
+}
+
+// SubtitleSidecars returns the .srt files next to the video, show.srt, show.eng.srt or show.en.forced.srt
+// for show.mkv, that the subtitle languages keep. Sidecars without a language are always kept.
+func (v *Video) SubtitleSidecars() ([]string, error) {
+	base := strings.TrimSuffix(v.filePath, v.videoExt)
+	matches, err := filepath.Glob(filesystem.GlobEscape(base) + "*.srt")
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, m := range matches {
+		rest := strings.TrimSuffix(strings.TrimPrefix(m, base), filepath.Ext(m))
+		if rest != "" && !strings.HasPrefix(rest, ".") {
+			continue // another video, show2.srt
+		}
+		lang := strings.Split(strings.TrimPrefix(rest, "."), ".")[0]
+		if lang == "" || matchLanguage(lang, v.Keep.SubtitleLanguages) {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,106 @@
+package ffmpeg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func streamsVideo() Video {
+	return Video{
+		filePath: "show.mkv",
+		Streams: []Stream{
+			{Index: 0, CodecType: "video", CodecName: "h264"},
+			{Index: 1, CodecType: "audio", CodecName: "ac3", Language: "eng"},
+			{Index: 2, CodecType: "audio", CodecName: "ac3", Language: "spa"},
+			{Index: 3, CodecType: "subtitle", CodecName: "subrip", Language: "eng"},
+			{Index: 4, CodecType: "subtitle", CodecName: "subrip", Language: "fre"},
+			{Index: 5, CodecType: "data", CodecName: "bin_data"},
+			{Index: 6, CodecType: "attachment", CodecName: "ttf"},
+		},
+	}
+}
+
+func TestSelectedStreams(t *testing.T) {
+	v := streamsVideo()
+	if got := strings.Join(v.streamMaps(0), " "); got != "-map 0:0 -map 0:1 -map 0:2 -map 0:3 -map 0:4 -map 0:5" {
+		t.Fatalf("expected every stream but attachments, got %s", got)
+	}
+
+	mp4 := Video{
+		FormatName: "mov,mp4,m4a,3gp,3g2,mj2",
+		Streams:    []Stream{{Index: 0, CodecType: "video"}, {Index: 1, CodecType: "audio"}, {Index: 2, CodecType: "data", CodecName: "bin_data"}},
+		Chapters:   []Chapter{{Start: 0, End: 10}},
+	}
+	if got := strings.Join(mp4.streamMaps(0), " "); got != "-map 0:0 -map 0:1" {
+		t.Fatalf("expected the chapter track of an mp4 to be left to the muxer, got %s", got)
+	}
+
+	v.Keep = StreamSelection{AudioLanguages: []string{"en"}, SubtitleLanguages: []string{"ENG"}}
+	if got := strings.Join(v.streamMaps(0), " "); got != "-map 0:0 -map 0:1 -map 0:3" {
+		t.Fatalf("expected the english streams, got %s", got)
+	}
+
+	v.Keep = StreamSelection{AudioLanguages: []string{"ger"}, SubtitleLanguages: []string{"ger"}}
+	if got := strings.Join(v.streamMaps(0), " "); got != "-map 0:0 -map 0:1 -map 0:2" {
+		t.Fatalf("expected all audio when no language matches and no subtitles, got %s", got)
+	}
+
+	if got := strings.Join(v.attachmentMaps(2), " "); got != "-i show.mkv -map 2:t" {
+		t.Fatalf("unexpected attachment maps %s", got)
+	}
+	v.Streams = v.Streams[:6]
+	if got := v.attachmentMaps(2); got != nil {
+		t.Fatalf("expected no attachment maps without attachments, got %v", got)
+	}
+}
+
+func TestSubtitleSidecars(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"show.mkv", "show.srt", "show.eng.srt", "show.en.forced.srt", "show.spa.srt", "show2.srt", "show.edl"} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	v := Video{filePath: filepath.Join(dir, "show.mkv"), videoBaseName: "show", videoExt: ".mkv"}
+	got, err := v.SubtitleSidecars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("expected the 4 sidecars of show.mkv, got %v", got)
+	}
+
+	v.Keep.SubtitleLanguages = []string{"eng"}
+	got, err = v.SubtitleSidecars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range got {
+		names = append(names, filepath.Base(p))
+	}
+	if strings.Join(names, " ") != "show.en.forced.srt show.eng.srt show.srt" {
+		t.Fatalf("expected the english sidecars and the one without a language, got %v", names)
+	}
+}
+
+func TestSubtitleSidecarsWithBrackets(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"Show [720p].mp4", "Show [720p].eng.srt", "Show 7.srt"} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	v := Video{filePath: filepath.Join(dir, "Show [720p].mp4"), videoBaseName: "Show [720p]", videoExt: ".mp4"}
+	got, err := v.SubtitleSidecars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || filepath.Base(got[0]) != "Show [720p].eng.srt" {
+		t.Fatalf("expected the sidecar of the bracketed name, got %v", got)
+	}
+}
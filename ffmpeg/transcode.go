@@ -0,0 +1,128 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TranscodeProfile re-encodes the main video stream of a recut video to make it smaller. Everything
+// else is copied unless AudioCodec is set.
+type TranscodeProfile struct {
+	Name         string
+	Codec        string // hevc, av1 or h264
+	CRF          int    // quality, lower is better, used unless Bitrate is set
+	Bitrate      string // e.g. 2500k
+	Preset       string // the encoder's speed preset, e.g. medium for x265 or 8 for SVT-AV1
+	AudioCodec   string // e.g. aac or opus, empty copies the audio
+	AudioBitrate string // e.g. 128k
+	MaxHeight    int    // taller videos are scaled down to this height, 0 keeps the size
+}
+
+// TranscodeCodecs are the encoders used for the codecs of a transcode profile.
+var TranscodeCodecs = map[string]string{
+	"hevc": "libx265",
+	"av1":  "libsvtav1",
+	"h264": "libx264",
+}
+
+// TranscodeProfiles are the built in transcode profiles, the config file can add more.
+var TranscodeProfiles = map[string]TranscodeProfile{
+	"hevc-1080p": {Name: "hevc-1080p", Codec: "hevc", CRF: 24, Preset: "medium", MaxHeight: 1080},
+	"hevc-720p":  {Name: "hevc-720p", Codec: "hevc", CRF: 26, Preset: "medium", MaxHeight: 720},
+	"av1-1080p":  {Name: "av1-1080p", Codec: "av1", CRF: 30, Preset: "8", MaxHeight: 1080},
+	"av1-720p":   {Name: "av1-720p", Codec: "av1", CRF: 32, Preset: "8", MaxHeight: 720},
+	"h264-720p":  {Name: "h264-720p", Codec: "h264", CRF: 22, Preset: "medium", MaxHeight: 720},
+}
+
+// Check makes sure the profile can be turned into an ffmpeg command.
+func (p TranscodeProfile) Check() error {
+	if _, ok := TranscodeCodecs[p.Codec]; !ok {
+		return fmt.Errorf("transcode profile %s: unknown codec %q, expected hevc, av1 or h264", p.Name, p.Codec)
+	}
+	if p.CRF < 0 || p.CRF > 63 {
+		return fmt.Errorf("transcode profile %s: crf %d is out of range", p.Name, p.CRF)
+	}
+	if p.CRF == 0 && p.Bitrate == "" {
+		return fmt.Errorf("transcode profile %s needs a crf or a bitrate", p.Name)
+	}
+	if p.MaxHeight < 0 {
+		return fmt.Errorf("transcode profile %s: max_height cannot be negative", p.Name)
+	}
+	return nil
+}
+
+// TranscodeResult is what a transcode did to the size of the video.
+type TranscodeResult struct {
+	Before int64
+	After  int64
+	Kept   bool // the transcode was smaller and replaced the video
+}
+
+// transcodeArgs are the ffmpeg arguments that write the video transcoded with p to out.
+func (v *Video) transcodeArgs(p TranscodeProfile, out string) ([]string, error) {
+	stream, ok := v.VideoStream()
+	if !ok {
+		return nil, fmt.Errorf("%s has no video stream to transcode", v.filePath)
+	}
+	spec := v.videoSpec(stream)
+	args := []string{"-y", "-i", v.filePath}
+	args = append(args, v.streamMaps(0)...)
+	args = append(args, "-map", "0:t?", "-c", "copy", "-c"+spec, TranscodeCodecs[p.Codec])
+	if p.Bitrate != "" {
+		args = append(args, "-b"+spec, p.Bitrate)
+	} else {
+		args = append(args, "-crf", strconv.Itoa(p.CRF))
+	}
+	if p.Preset != "" {
+		args = append(args, "-preset", p.Preset)
+	}
+	if p.MaxHeight > 0 && stream.Height > p.MaxHeight {
+		// -2 keeps the aspect ratio with an even width
+		args = append(args, "-filter"+spec, fmt.Sprintf("scale=-2:%d", p.MaxHeight))
+	}
+	if p.Codec == "hevc" && strings.EqualFold(v.videoExt, ".mp4") {
+		// QuickTime and Apple devices only play HEVC in mp4 tagged hvc1
+		args = append(args, "-tag"+spec, "hvc1")
+	}
+	if p.AudioCodec != "" {
+		args = append(args, "-c:a", p.AudioCodec)
+		if p.AudioBitrate != "" {
+			args = append(args, "-b:a", p.AudioBitrate)
+		}
+	}
+	return append(args, out), nil
+}
+
+// Transcode re-encodes the video with p next to it and replaces the video with the result if
+// that is smaller, otherwise the result is removed and the video is left as it is.
+func (v *Video) Transcode(p TranscodeProfile) (TranscodeResult, error) {
+	var res TranscodeResult
+	info, err := os.Stat(v.filePath)
+	if err != nil {
+		return res, err
+	}
+	res.Before = info.Size()
+
+	out := strings.TrimSuffix(v.filePath, v.videoExt) + ".transcode" + v.videoExt
+	args, err := v.transcodeArgs(p, out)
+	if err != nil {
+		return res, err
+	}
+	err = runFFmpegProgress(args, v.tracker(v.Duration), v.Duration)
+	if err != nil {
+		os.Remove(out)
+		return res, fmt.Errorf("error transcoding %s with %s: %s", v.filePath, p.Name, err)
+	}
+	info, err = os.Stat(out)
+	if err != nil {
+		return res, err
+	}
+	res.After = info.Size()
+	if res.After >= res.Before {
+		return res, os.Remove(out)
+	}
+	res.Kept = true
+	return res, os.Rename(out, v.filePath)
+}
@@ -0,0 +1,76 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTranscodeArgs(t *testing.T) {
+	v := Video{filePath: "show.mp4", videoExt: ".mp4"}
+	err := v.parseProbe([]byte(probeJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, err := v.transcodeArgs(TranscodeProfiles["hevc-720p"], "show.transcode.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(args, " ")
+	want := "-y -i show.mp4 -map 0:0 -map 0:1 -map 0:2 -map 0:t? -c copy -c:v:0 libx265 -crf 26 -preset medium -tag:v:0 hvc1 show.transcode.mp4"
+	if got != want {
+		t.Fatalf("expected a 720p video not to be scaled\n%s, got\n%s", want, got)
+	}
+
+	p := TranscodeProfile{Name: "small", Codec: "av1", Bitrate: "1500k", MaxHeight: 480, AudioCodec: "opus", AudioBitrate: "96k"}
+	args, err = v.transcodeArgs(p, "out.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = strings.Join(args, " ")
+	for _, want := range []string{"-c:v:0 libsvtav1 -b:v:0 1500k", "-filter:v:0 scale=-2:480", "-c:a opus -b:a 96k"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in %s", want, got)
+		}
+	}
+	if strings.Contains(got, "-crf") || strings.Contains(got, "hvc1") {
+		t.Fatalf("expected no crf with a bitrate and no hvc1 tag for av1, got %s", got)
+	}
+}
+
+func TestTranscodeArgsChapterTrack(t *testing.T) {
+	v := Video{
+		filePath:   "show.mp4",
+		videoExt:   ".mp4",
+		FormatName: "mov,mp4,m4a,3gp,3g2,mj2",
+		Streams:    []Stream{{Index: 0, CodecType: "video", Height: 720}, {Index: 1, CodecType: "audio"}, {Index: 2, CodecType: "data", CodecName: "bin_data"}},
+		Chapters:   []Chapter{{Start: 0, End: 10}},
+	}
+	args, err := v.transcodeArgs(TranscodeProfiles["hevc-720p"], "show.transcode.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(args, " ")
+	if strings.Contains(got, "0:2") || strings.Contains(got, "-map 0 ") {
+		t.Fatalf("expected the chapter track of an mp4 to be left to the muxer, got %s", got)
+	}
+	if !strings.Contains(got, "-map 0:0 -map 0:1 -map 0:t? -c copy") {
+		t.Fatalf("expected the video and audio streams to be mapped, got %s", got)
+	}
+}
+
+func TestTranscodeProfileCheck(t *testing.T) {
+	for name, p := range TranscodeProfiles {
+		if err := p.Check(); err != nil {
+			t.Fatalf("built in profile %s: %s", name, err)
+		}
+	}
+	for _, p := range []TranscodeProfile{
+		{Name: "vp9", Codec: "vp9", CRF: 30},
+		{Name: "no quality", Codec: "hevc"},
+		{Name: "crf", Codec: "hevc", CRF: 70},
+	} {
+		if err := p.Check(); err == nil {
+			t.Fatalf("expected an error for %+v", p)
+		}
+	}
+}
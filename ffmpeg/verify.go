@@ -0,0 +1,106 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Expectation is what the video Recut writes should look like.
+type Expectation struct {
+	Duration float64        // seconds
+	Segments int            // stretches joined, each can be off by up to a keyframe interval
+	Streams  map[string]int // by codec type
+}
+
+// Expect describes the video Recut writes for the chapters at ndxs.
+func (v *Video) Expect(ndxs []int) Expectation {
+	res := Expectation{Duration: v.Duration, Segments: 1, Streams: map[string]int{}}
+	if ndxs == nil && v.Keep.empty() {
+		// copied as it is
+		for _, s := range v.Streams {
+			res.Streams[s.CodecType]++
+		}
+		return res
+	}
+	for _, s := range v.SelectedStreams() {
+		res.Streams[s.CodecType]++
+	}
+	if n := len(v.StreamsOf("attachment")); n > 0 {
+		res.Streams["attachment"] = n
+	}
+	if ndxs != nil {
+		var segments []Interval
+		for _, ndx := range ndxs {
+			segments = append(segments, Interval{v.Chapters[ndx].Start, v.Chapters[ndx].End})
+		}
+		segments = mergeIntervals(segments)
+		res.Duration = totalLength(segments)
+		res.Segments = len(segments)
+	}
+	return res
+}
+
+// check compares the video with the expectation, its duration may be off by tolerance per segment.
+// Data streams are not counted: mp4 and mov write the chapters as a text track that ffprobe shows as
+// one, so how many there are depends on the container rather than on the cut.
+func (e Expectation) check(v Video, tolerance time.Duration) error {
+	var problems []string
+	allowed := tolerance.Seconds() * float64(max(1, e.Segments))
+	if e.Duration > 0 && math.Abs(v.Duration-e.Duration) > allowed {
+		problems = append(problems, fmt.Sprintf("it is %s long instead of %s", seconds(v.Duration), seconds(e.Duration)))
+	}
+	found := map[string]int{}
+	for _, s := range v.Streams {
+		found[s.CodecType]++
+	}
+	var types []string
+	for t := range e.Streams {
+		types = append(types, t)
+	}
+	for t := range found {
+		if _, ok := e.Streams[t]; !ok {
+			types = append(types, t)
+		}
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		if t != "data" && found[t] != e.Streams[t] {
+			problems = append(problems, fmt.Sprintf("it has %d %s streams instead of %d", found[t], t, e.Streams[t]))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// seconds writes a duration in seconds like 1m30.5s.
+func seconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(100 * time.Millisecond).String()
+}
+
+// Verify checks that ffprobe can read the video at p and that it matches the expectation, with a
+// duration off by at most tolerance per joined stretch. With decode every frame is decoded too,
+// which takes about as long as the cut.
+func Verify(p string, want Expectation, tolerance time.Duration, decode bool, onProgress func(RecutProgress)) error {
+	v, err := Probe(p)
+	if err != nil {
+		return fmt.Errorf("ffprobe cannot read %s: %s", p, err)
+	}
+	err = want.check(v, tolerance)
+	if err != nil {
+		return fmt.Errorf("%s is not what was expected: %s", p, err)
+	}
+	if !decode {
+		return nil
+	}
+	v.OnProgress = onProgress
+	err = runFFmpegProgress([]string{"-v", "error", "-xerror", "-i", p, "-map", "0:V?", "-map", "0:a?", "-f", "null", "-"}, v.tracker(v.Duration), v.Duration)
+	if err != nil {
+		return fmt.Errorf("%s cannot be decoded: %s", p, err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package ffmpeg
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpect(t *testing.T) {
+	v := streamsVideo()
+	v.Duration = 100
+	v.Chapters = []Chapter{{Start: 0, End: 30}, {Start: 30, End: 50}, {Start: 50, End: 70}, {Start: 70, End: 100}}
+
+	copied := v.Expect(nil)
+	if copied.Duration != 100 || copied.Streams["data"] != 1 || copied.Streams["audio"] != 2 {
+		t.Fatalf("expected a copy to keep everything, got %+v", copied)
+	}
+
+	v.Keep.AudioLanguages = []string{"eng"}
+	cut := v.Expect([]int{0, 2, 3})
+	if cut.Duration != 80 || cut.Segments != 2 {
+		t.Fatalf("expected 80s in 2 stretches, got %+v", cut)
+	}
+	if cut.Streams["audio"] != 1 || cut.Streams["subtitle"] != 2 || cut.Streams["attachment"] != 1 || cut.Streams["data"] != 0 {
+		t.Fatalf("expected the selected streams and the attachment, got %+v", cut.Streams)
+	}
+}
+
+func TestExpectationCheck(t *testing.T) {
+	want := Expectation{Duration: 80, Segments: 2, Streams: map[string]int{"video": 1, "audio": 1}}
+	out := Video{Duration: 83, Streams: []Stream{{CodecType: "video"}, {CodecType: "audio"}}}
+	if err := want.check(out, 2*time.Second); err != nil {
+		t.Fatalf("expected 3s off over 2 stretches to be within 2s each, got %s", err)
+	}
+	if err := want.check(out, time.Second); err == nil || !strings.Contains(err.Error(), "1m23s long instead of 1m20s") {
+		t.Fatalf("expected the duration to be off, got %v", err)
+	}
+
+	out.Streams = []Stream{{CodecType: "video"}, {CodecType: "subtitle"}}
+	err := want.check(out, 2*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "0 audio streams instead of 1") || !strings.Contains(err.Error(), "1 subtitle streams instead of 0") {
+		t.Fatalf("expected a missing audio and an extra subtitle stream, got %v", err)
+	}
+}
+
+func TestExpectMP4WithChapters(t *testing.T) {
+	v := Video{
+		FormatName: "mov,mp4,m4a,3gp,3g2,mj2",
+		Duration:   100,
+		Streams:    []Stream{{Index: 0, CodecType: "video"}, {Index: 1, CodecType: "audio"}, {Index: 2, CodecType: "data", CodecName: "bin_data"}},
+		Chapters:   []Chapter{{Start: 0, End: 30, Title: "Advertisement"}, {Start: 30, End: 100, Title: "Episode"}},
+	}
+	want := v.Expect([]int{1})
+	// -map_chapters 1 makes the muxer write a chapter track again
+	out := Video{Duration: 70, Streams: []Stream{{CodecType: "video"}, {CodecType: "audio"}, {CodecType: "data", CodecName: "bin_data"}}}
+	if err := want.check(out, 2*time.Second); err != nil {
+		t.Fatalf("expected the chapter track of the mp4 not to count, got %s", err)
+	}
+	out.Streams = out.Streams[:2]
+	if err := want.check(out, 2*time.Second); err != nil {
+		t.Fatalf("expected an mp4 without a chapter track to pass too, got %s", err)
+	}
+}
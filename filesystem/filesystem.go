@@ -3,35 +3,42 @@ package filesystem
 import (
 	"bufio"
 	"cleansync/messages"
+	"cleansync/rules"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 const chunkSize = int64(16 * 1024 * 1024)
 
 // WalkAndHash walks the directory structure that is specifed in the Syncer.Folderpath.
-// Will filter for filetypes listed in the filters slice.
-// Returns a map of filepath[lastModDate]
-func WalkAndHash(filters []string, folderPath string) (map[string]int64, error) {
+// Only files the rule set includes are listed, excluded directories are skipped entirely.
+// Returns a map of filepath[fileinfo]
+func WalkAndHash(set *rules.Set, folderPath string) (map[string]os.FileInfo, error) {
 
-	retMap := make(map[string]int64)
+	retMap := make(map[string]os.FileInfo)
 	err := filepath.Walk(folderPath, func(p string, info os.FileInfo, err error) error {
 		if err == nil {
-			if !info.IsDir() {
-				if !inFilters(info.Name(), filters) {
-					return nil
+			if info.IsDir() {
+				if p != folderPath && !set.Check(folderPath, p, info).Included {
+					return filepath.SkipDir
 				}
-				h, err := getLastModDate(p)
-				if err != nil {
-					return err
-				}
-				p := Localize(p)
-				retMap[p] = h
+				return nil
 			}
-
+			if !set.Check(folderPath, p, info).Included {
+				return nil
+			}
+			// stat rather than lstat so links report what they point at
+			target, err := os.Stat(p)
+			if err != nil {
+				return err
+			}
+			retMap[Localize(p)] = target
 		}
 		return nil
 	})
@@ -43,32 +50,33 @@ func WalkAndHash(filters []string, folderPath string) (map[string]int64, error)
 	return retMap, nil
 }
 
-// localize converts paths to windows paths if needed, has its own function for future needs.
-func Localize(s string) string {
-	s = filepath.FromSlash(s)
-	return s
-
+// GlobEscape keeps the characters filepath.Glob gives a meaning in p, e.g. the brackets of
+// Show [720p].mp4, from matching anything but themselves. It works the same on every OS.
+func GlobEscape(p string) string {
+	r := strings.NewReplacer("[", "[[]", "*", "[*]", "?", "[?]")
+	return r.Replace(p)
 }
 
-// inFilters checks to see if the name of the file has one of the extensions listed in the filters slice, it returns true.
-func inFilters(name string, filters []string) bool {
-	for _, filter := range filters {
-		if strings.HasSuffix(name, filter) {
-			return true
-		}
+// HashFile returns the hex sha256 of the file at p.
+func HashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
 	}
-	return false
-}
-
-// get lastModDate returns the last moidified date for the file specified by f (file path).
-// Returns unix time
-func getLastModDate(f string) (int64, error) {
-	fileinfo, err := os.Stat(f)
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
 	if err != nil {
-		return 0, err
+		return "", err
 	}
-	atime := fileinfo.ModTime().Unix()
-	return atime, nil
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// localize converts paths to windows paths if needed, has its own function for future needs.
+func Localize(s string) string {
+	s = filepath.FromSlash(s)
+	return s
+
 }
 
 type ProgressReadWriter struct {
@@ -81,8 +89,9 @@ type ProgressReadWriter struct {
 func (pw *ProgressReadWriter) GetProgress(ch chan messages.ProgressMsg) {
 	for {
 		time.Sleep(250 * time.Millisecond)
-		if pw.Completed != 0 {
-			progress := float64(pw.Completed) / float64(pw.Size)
+		completed := atomic.LoadInt64(&pw.Completed)
+		if completed != 0 && pw.Size != 0 {
+			progress := float64(completed) / float64(pw.Size)
 			ch <- messages.ProgressMsg{
 				Progress: progress,
 			}
@@ -90,9 +99,31 @@ func (pw *ProgressReadWriter) GetProgress(ch chan messages.ProgressMsg) {
 	}
 }
 
+// Track returns a reader that counts everything read from r towards the progress.
+// Unlike Read it is safe to use from several uploads at the same time.
+func (pw *ProgressReadWriter) Track(r io.Reader) io.Reader {
+	return &trackedReader{r: r, pw: pw}
+}
+
+type trackedReader struct {
+	r  io.Reader
+	pw *ProgressReadWriter
+}
+
+func (tr *trackedReader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	atomic.AddInt64(&tr.pw.Completed, int64(n))
+	return n, err
+}
+
+// Skip counts n bytes that do not have to be read after all, e.g. parts uploaded by an earlier run.
+func (pw *ProgressReadWriter) Skip(n int64) {
+	atomic.AddInt64(&pw.Completed, n)
+}
+
 func (pw *ProgressReadWriter) ResetProgress() {
 	pw.Size = 0
-	pw.Completed = 0
+	atomic.StoreInt64(&pw.Completed, 0)
 }
 
 func (pw *ProgressReadWriter) Write(p []byte) (n int, err error) {
@@ -101,7 +132,7 @@ func (pw *ProgressReadWriter) Write(p []byte) (n int, err error) {
 	if err != nil {
 		return 0, err
 	}
-	pw.Completed += int64(n)
+	atomic.AddInt64(&pw.Completed, int64(n))
 	return n, err
 }
 
@@ -136,7 +167,8 @@ func (pr *ProgressReadWriter) Copy(source string, dest string) error {
 		return err
 	}
 	defer destFile.Close()
-	pr.Writer = bufio.NewWriter(destFile)
+	w := bufio.NewWriter(destFile)
+	pr.Writer = w
 
 	var offset int64
 	for {
@@ -158,5 +190,6 @@ func (pr *ProgressReadWriter) Copy(source string, dest string) error {
 		offset = offset + int64(n)
 		pr.Completed = offset
 	}
-	return nil
+	// the last chunk is still in the buffer
+	return w.Flush()
 }
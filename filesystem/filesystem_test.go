@@ -0,0 +1,30 @@
+package filesystem
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopy(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.mkv")
+	data := bytes.Repeat([]byte("cleansync"), 1000)
+	err := os.WriteFile(src, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr := &ProgressReadWriter{}
+	err = pr.Copy(src, filepath.Join(dir, "b.mkv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "b.mkv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Expected %d bytes to be copied, got %d", len(data), len(got))
+	}
+}
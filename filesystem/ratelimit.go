@@ -0,0 +1,76 @@
+package filesystem
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket shared by every reader it wraps, so concurrent
+// uploads stay under one overall limit. A nil RateLimiter does not limit.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter for bytesPerSecond, or nil if it is not positive.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+	}
+}
+
+// Reader wraps r so reads from it are throttled.
+func (l *RateLimiter) Reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitedReader{r: r, limiter: l}
+}
+
+// wait takes n bytes worth of tokens from the bucket, sleeping when it runs dry. The sleep
+// happens outside the lock, the debt left in the bucket makes the other readers wait their turn.
+func (l *RateLimiter) wait(n int) {
+	time.Sleep(l.take(n))
+}
+
+// take takes n bytes worth of tokens and returns how long to wait for them.
+func (l *RateLimiter) take(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+type limitedReader struct {
+	r       io.Reader
+	limiter *RateLimiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	// keep the reads small so the limit is applied smoothly
+	if len(p) > 64*1024 {
+		p = p[:64*1024]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		lr.limiter.wait(n)
+	}
+	return n, err
+}
@@ -0,0 +1,29 @@
+package filesystem
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterSleepsOutsideTheLock(t *testing.T) {
+	l := NewRateLimiter(1000)
+	done := make(chan struct{})
+	go func() {
+		// the bucket starts full, this is a second in debt
+		l.wait(2000)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if !l.mu.TryLock() {
+		t.Fatal("Expected the limiter to be free while a reader sleeps")
+	}
+	l.mu.Unlock()
+	if d := l.take(500); d < time.Second {
+		t.Fatalf("Expected the next reader to wait behind the debt, got %s", d)
+	}
+	select {
+	case <-done:
+		t.Fatal("Expected the first reader to still be sleeping")
+	default:
+	}
+}
@@ -0,0 +1,24 @@
+package filesystem
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{
+		"2G":      2 * 1024 * 1024 * 1024,
+		"512MB":   512 * 1024 * 1024,
+		"1.5 KiB": 1536,
+		"100":     100,
+	}
+	for in, want := range cases {
+		got, err := ParseSize(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("ParseSize(%q) = %d, expected %d", in, got, want)
+		}
+	}
+	if _, err := ParseSize("lots"); err == nil {
+		t.Fatal("Expected an error for an invalid size")
+	}
+}
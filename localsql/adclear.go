@@ -0,0 +1,78 @@
+package localsql
+
+import (
+	"encoding/json"
+)
+
+const CREATEADCLEARTABLE = "create table if not exists adclear (source text primary key not null, size integer default (0), modified integer default (0), hash text default (''), rules text default (''), output text default (''), removed real default (0), cuts text default ('[]'), cleaned_at integer default (0))"
+
+const UPSERTCLEANED = "insert into adclear (source, size, modified, hash, rules, output, removed, cuts, cleaned_at) values(?, ?, ?, ?, ?, ?, ?, ?, ?) on conflict(source) do update set (size, modified, hash, rules, output, removed, cuts, cleaned_at) = (excluded.size, excluded.modified, excluded.hash, excluded.rules, excluded.output, excluded.removed, excluded.cuts, excluded.cleaned_at)"
+const SELECTCLEANED = "select source, size, modified, hash, rules, output, removed, cuts, cleaned_at from adclear"
+
+// Cleaned is what the manifest keeps about a video adclear removed the ads from.
+type Cleaned struct {
+	Source    string  `json:"source"`
+	Size      int64   `json:"size"`
+	Modified  int64   `json:"modified"` // unix time
+	Hash      string  `json:"hash"`     // hex sha256 of the source
+	Rules     string  `json:"rules"`    // the rules that decided what was cut
+	Output    string  `json:"output"`
+	Removed   float64 `json:"removed"` // seconds
+	Cuts      []Cut   `json:"cuts"`
+	CleanedAt int64   `json:"cleaned_at"`
+}
+
+// Cut is a stretch adclear removed from a video.
+type Cut struct {
+	Start  float64 `json:"start"` // seconds
+	End    float64 `json:"end"`
+	Title  string  `json:"title"`  // of the chapter
+	Reason string  `json:"reason"` // the rule that removed it
+}
+
+// RecordCleaned records that adclear processed the source of c, replacing what an earlier run recorded.
+func (m *Sqldb) RecordCleaned(c Cleaned) error {
+	cuts, err := json.Marshal(c.Cuts)
+	if err != nil {
+		return err
+	}
+	_, err = m.db.Exec(UPSERTCLEANED, c.Source, c.Size, c.Modified, c.Hash, c.Rules, c.Output, c.Removed, string(cuts), c.CleanedAt)
+	return err
+}
+
+// Cleaned returns what was recorded about the source, ok is false when it has not been processed yet.
+func (m *Sqldb) Cleaned(source string) (c Cleaned, ok bool, err error) {
+	res, err := m.queryCleaned(SELECTCLEANED+" where source = ?", source)
+	if err != nil || len(res) == 0 {
+		return c, false, err
+	}
+	return res[0], true, nil
+}
+
+// CleanedVideos returns every video adclear processed, by source.
+func (m *Sqldb) CleanedVideos() ([]Cleaned, error) {
+	return m.queryCleaned(SELECTCLEANED + " order by source")
+}
+
+func (m *Sqldb) queryCleaned(query string, args ...any) ([]Cleaned, error) {
+	rows, err := m.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Cleaned
+	for rows.Next() {
+		var c Cleaned
+		var cuts string
+		err = rows.Scan(&c.Source, &c.Size, &c.Modified, &c.Hash, &c.Rules, &c.Output, &c.Removed, &cuts, &c.CleanedAt)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal([]byte(cuts), &c.Cuts)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,42 @@
+package localsql
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordCleaned(t *testing.T) {
+	db, err := InitDb(filepath.Join(t.TempDir(), "manifest.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok, err := db.Cleaned("/tv/a.mkv")
+	if err != nil || ok {
+		t.Fatalf("Expected nothing to be recorded yet, got %v %v", ok, err)
+	}
+	c := Cleaned{Source: "/tv/a.mkv", Size: 10, Modified: 1, Hash: "abc", Output: "/out/a.mkv", Removed: 90,
+		Cuts: []Cut{{Start: 60, End: 150, Title: "Advertisement", Reason: "the default rule"}}}
+	err = db.RecordCleaned(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Modified = 2
+	err = db.RecordCleaned(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := db.Cleaned("/tv/a.mkv")
+	if err != nil || !ok {
+		t.Fatalf("Expected a.mkv to be recorded, got %v %v", ok, err)
+	}
+	if got.Modified != 2 || got.Output != "/out/a.mkv" || len(got.Cuts) != 1 || got.Cuts[0].End != 150 {
+		t.Fatalf("Unexpected record %+v", got)
+	}
+	all, err := db.CleanedVideos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 {
+		t.Fatalf("Expected the second run to replace the first, got %+v", all)
+	}
+}
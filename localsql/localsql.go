@@ -3,7 +3,9 @@ package localsql
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"os"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -11,22 +13,71 @@ import (
 const CREATEVIDEOSTABLE = "create table videos (id integer primary key not null, filepath text unique, modified integer default (0), uploaded integer default (0), multipart integer default (0))"
 const CREATEPARTSTABLE = "create table parts (id INTEGER PRIMARY KEY NOT NULL UNIQUE, video_id INTEGER NOT NULL, filepath TEXT UNIQUE, uploaded INTEGER DEFAULT (0))"
 
-const UPSERTRECORD = "insert into videos (filepath, modified) values(?, ?) on conflict(filepath) do update set (modified, uploaded, multipart) = (?,?,?)"
-const SELECTRECORD = "select filepath from videos where filepath = ? and modified = ?"
+const CREATEUPLOADSTABLE = "create table if not exists uploads (video_id integer not null, destination text not null, uploaded integer default (0), uploaded_at integer default (0), primary key (video_id, destination))"
+
+const UPSERTRECORD = "insert into videos (filepath, modified, size) values(?, ?, ?) on conflict(filepath) do update set (modified, size, uploaded, multipart, split_hash) = (excluded.modified, excluded.size, 0, 0, '')"
+const RESETUPLOADS = "delete from uploads where video_id = (select id from videos where filepath = ?)"
+const SELECTRECORD = "select size from videos where filepath = ? and modified = ?"
+const UPDATESIZE = "update videos set size = ? where filepath = ?"
 const SELECTVIDEOIDBBYPATH = "select id from videos where filepath = ?"
 const UPDATEUPLOADSTATUS = "update videos set uploaded = 1 where filepath = ?"
+const UPSERTUPLOAD = "insert into uploads (video_id, destination, uploaded, uploaded_at, key, storage_class) select id, ?, 1, ?, ?, ? from videos where filepath = ? on conflict(video_id, destination) do update set (uploaded, uploaded_at, key, storage_class) = (1, excluded.uploaded_at, excluded.key, excluded.storage_class)"
 const UPDATEUPLOADSTATUSPART = "update PARTS set uploaded = 1 where filepath = ?"
-const SELECTUPLOADLIST = "select filepath from videos where uploaded = false"
+const SELECTUPLOADLIST = "select filepath from videos where not exists (select 1 from uploads where uploads.video_id = videos.id and uploads.destination = ? and uploads.uploaded = 1)"
 const SETMULTIPART = "update videos set multipart = 1 where filepath = ?"
-const INSERTPART = "insert into parts (video_id, filepath) values(?, ?)"
+const INSERTPART = "insert into parts (video_id, filepath) values(?, ?) on conflict(filepath) do update set (video_id, uploaded) = (excluded.video_id, 0)"
+
+// Uploads made before the manifest knew about destinations are kept under the empty destination
+// until the first destination that is synced claims them.
+const MIGRATELEGACYUPLOADS = "insert or ignore into uploads (video_id, destination, uploaded) select id, '', 1 from videos where uploaded = 1"
+const COUNTDESTINATIONUPLOADS = "select count(*) from uploads where destination = ?"
+const CLAIMLEGACYUPLOADS = "update uploads set destination = ? where destination = ''"
+
+// migrations bring older manifests up to date, the index + 1 is stored as the user_version.
+var migrations = [][]string{
+	{CREATEUPLOADSTABLE, MIGRATELEGACYUPLOADS},
+	{
+		"alter table videos add column size integer default (0)",
+		"alter table uploads add column key text default ('')",
+		"alter table uploads add column storage_class text default ('')",
+	},
+	{
+		"alter table parts add column part_index integer default (0)",
+		"alter table parts add column byte_offset integer default (0)",
+		"alter table parts add column size integer default (0)",
+		"alter table parts add column hash text default ('')",
+		CREATEPARTUPLOADSTABLE,
+	},
+	{CREATEADCLEARTABLE},
+	{"alter table videos add column split_hash text default ('')"},
+}
+
+// File is what the manifest keeps about a local file.
+type File struct {
+	Modified int64 // unix time
+	Size     int64
+}
+
+// Upload is what the manifest keeps about a file that went to a destination.
+type Upload struct {
+	Destination  string
+	Key          string // for split files the key of the first part
+	StorageClass string
+}
 
 type Sqldb struct {
-	db *sql.DB
+	db      *sql.DB
+	created bool
 }
 
+// DSNOPTIONS are appended to the manifest path when it is opened.
+const DSNOPTIONS = "?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+
 // InitDb gets the db if it already exists, if not it creates and preps a new one.
 func InitDb(dbpath string) (*Sqldb, error) {
-	db, err := sql.Open("sqlite3", dbpath)
+	// WAL lets readers like status run while a sync writes, the busy timeout makes
+	// writers wait for each other instead of failing with "database is locked"
+	db, err := sql.Open("sqlite3", dbpath+DSNOPTIONS)
 
 	if err != nil {
 		return nil, err
@@ -37,6 +88,7 @@ func InitDb(dbpath string) (*Sqldb, error) {
 	}
 	if _, err := os.Stat(dbpath); errors.Is(err, os.ErrNotExist) {
 		// db does not exist, c reate a new one
+		myDb.created = true
 
 		_, err = myDb.db.Exec(CREATEVIDEOSTABLE)
 		if err != nil {
@@ -49,12 +101,53 @@ func InitDb(dbpath string) (*Sqldb, error) {
 	}
 
 	// db exists, just set it
+	err = myDb.migrate()
+	if err != nil {
+		return nil, err
+	}
 	return myDb, nil
 }
 
-// GetUploadList queries the db and returns a slice of files that need updated.
-func (m *Sqldb) GetUploadList() ([]string, error) {
-	rows, err := m.db.Query(SELECTUPLOADLIST)
+// Created reports whether InitDb created a new, empty manifest.
+func (m *Sqldb) Created() bool {
+	return m.created
+}
+
+// migrate runs the migrations the manifest has not seen yet.
+func (m *Sqldb) migrate() error {
+	var version int
+	err := m.db.QueryRow("pragma user_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := m.db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, stmt := range migrations[version] {
+			_, err = tx.Exec(stmt)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		_, err = tx.Exec(fmt.Sprintf("pragma user_version = %d", version+1))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUploadList queries the db and returns a slice of files that still need to be uploaded to destination.
+func (m *Sqldb) GetUploadList(destination string) ([]string, error) {
+	rows, err := m.db.Query(SELECTUPLOADLIST, destination)
 	if err != nil {
 		return nil, err
 	}
@@ -69,13 +162,14 @@ func (m *Sqldb) GetUploadList() ([]string, error) {
 	return res, nil
 }
 
-// updateRecord updates or inserts an individual record with the p path and the last mod date specified by mod
+// updateRecord updates or inserts an individual record with the p path and the last mod date and size of f
 // checks to see if the record needs updating first, only will update if the modified date has changed
-func (m *Sqldb) UpdateRecord(p string, mod int64) error {
+func (m *Sqldb) UpdateRecord(p string, f File) error {
 	tx, err := m.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
 	query, err := tx.Prepare(UPSERTRECORD)
 	if err != nil {
@@ -83,17 +177,32 @@ func (m *Sqldb) UpdateRecord(p string, mod int64) error {
 	}
 	defer query.Close()
 
-	exists, err := m.recordExists(p, mod)
+	exists, size, err := recordExists(tx, p, f.Modified)
 	if err != nil {
 		return err
 	}
 	if exists {
-		return nil
+		if size == f.Size {
+			return nil
+		}
+		// manifests from before sizes were recorded
+		_, err = tx.Exec(UPDATESIZE, f.Size, p)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
 	}
-	_, err = query.Exec(p, mod, mod, 0, 0)
+	_, err = query.Exec(p, f.Modified, f.Size)
 	if err != nil {
 		return err
 	}
+	// the file changed, it has to go to every destination again and parts split from the old version are no good
+	for _, stmt := range []string{RESETUPLOADS, RESETVIDEOPARTUPLOADS, RESETVIDEOPARTS} {
+		_, err = tx.Exec(stmt, p)
+		if err != nil {
+			return err
+		}
+	}
 	tx.Commit()
 	return nil
 }
@@ -121,8 +230,8 @@ func (m *Sqldb) UpdateUploadStatusPart(p string) error {
 	return nil
 }
 
-// updateUploadStatus updates the status for the file specified with p.
-func (m *Sqldb) UpdateUploadStatus(p string) error {
+// updateUploadStatus records that the file specified with p has been uploaded as described by u.
+func (m *Sqldb) UpdateUploadStatus(p string, u Upload) error {
 	tx, err := m.db.Begin()
 	if err != nil {
 		return err
@@ -136,6 +245,10 @@ func (m *Sqldb) UpdateUploadStatus(p string) error {
 	if err != nil {
 		return err
 	}
+	_, err = tx.Exec(UPSERTUPLOAD, u.Destination, time.Now().Unix(), u.Key, u.StorageClass, p)
+	if err != nil {
+		return err
+	}
 	err = tx.Commit()
 	if err != nil {
 		return err
@@ -144,6 +257,21 @@ func (m *Sqldb) UpdateUploadStatus(p string) error {
 	return nil
 }
 
+// ClaimLegacyUploads hands the uploads recorded before destinations existed to destination,
+// as long as it has no uploads of its own yet.
+func (m *Sqldb) ClaimLegacyUploads(destination string) error {
+	var count int
+	err := m.db.QueryRow(COUNTDESTINATIONUPLOADS, destination).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = m.db.Exec(CLAIMLEGACYUPLOADS, destination)
+	return err
+}
+
 // recordParts inserts the split videos parts into the parts table
 func (m *Sqldb) RecordParts(videoid int, parts []string) error {
 	tx, err := m.db.Begin()
@@ -202,19 +330,20 @@ func (m *Sqldb) SetMultipart(fp string) (int, error) {
 }
 
 // recordExists checks to see if there is a matching record for the provided p (file path) and modified time modtime.
-func (m *Sqldb) recordExists(p string, modtime int64) (bool, error) {
-	var res string
-	err := m.db.QueryRow(SELECTRECORD, p, modtime).Scan(&res)
+// It also returns the size the manifest has for it.
+func recordExists(tx *sql.Tx, p string, modtime int64) (bool, int64, error) {
+	var size int64
+	err := tx.QueryRow(SELECTRECORD, p, modtime).Scan(&size)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return false, nil
+			return false, 0, nil
 		}
-		return false, err
+		return false, 0, err
 	}
-	return true, nil
+	return true, size, nil
 }
 
-func (m *Sqldb) UpdateManifest(objs map[string]int64) error {
+func (m *Sqldb) UpdateManifest(objs map[string]File) error {
 
 	for k, v := range objs {
 		m.UpdateRecord(k, v)
@@ -0,0 +1,197 @@
+package localsql
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadListPerDestination(t *testing.T) {
+	db, err := InitDb(filepath.Join(t.TempDir(), "manifest.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.UpdateManifest(map[string]File{"a.mkv": {Modified: 1, Size: 10}, "b.mkv": {Modified: 2, Size: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.UpdateUploadStatus("a.mkv", Upload{Destination: "deep/", Key: "deep/a.mkv", StorageClass: "DEEP_ARCHIVE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deep, err := db.GetUploadList("deep/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deep) != 1 || deep[0] != "b.mkv" {
+		t.Fatalf("Expected only b.mkv to be pending for deep/, got %v", deep)
+	}
+	ia, err := db.GetUploadList("ia/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ia) != 2 {
+		t.Fatalf("Expected both files to be pending for ia/, got %v", ia)
+	}
+
+	// A changed file has to go everywhere again
+	err = db.UpdateRecord("a.mkv", File{Modified: 3, Size: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deep, err = db.GetUploadList("deep/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deep) != 2 {
+		t.Fatalf("Expected the modified file to be pending again, got %v", deep)
+	}
+}
+
+func TestClaimLegacyUploads(t *testing.T) {
+	db, err := InitDb(filepath.Join(t.TempDir(), "manifest.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.UpdateManifest(map[string]File{"a.mkv": {Modified: 1, Size: 10}, "b.mkv": {Modified: 2, Size: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// what an older version of cleansync left behind
+	_, err = db.db.Exec("update videos set uploaded = 1 where filepath = 'a.mkv'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.db.Exec(MIGRATELEGACYUPLOADS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dest := range []string{"first/", "second/"} {
+		err = db.ClaimLegacyUploads(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, _ := db.GetUploadList("first/")
+	second, _ := db.GetUploadList("second/")
+	if len(first) != 1 || len(second) != 2 {
+		t.Fatalf("Expected the first destination to claim the legacy upload, got %v and %v", first, second)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	dbpath := filepath.Join(t.TempDir(), "manifest.db")
+	db, err := InitDb(dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.UpdateManifest(map[string]File{"a.mkv": {Modified: 1, Size: 10}, "b.mkv": {Modified: 2, Size: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ro, err := OpenReadOnly(dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	entries, err := ro.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Destination != "" || entries[0].Uploaded {
+		t.Fatalf("Expected two pending files without a destination, got %+v", entries)
+	}
+
+	err = db.UpdateUploadStatus("a.mkv", Upload{Destination: "deep/", Key: "deep/a.mkv", StorageClass: "DEEP_ARCHIVE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = ro.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected one entry per file for the one destination, got %+v", entries)
+	}
+	a, b := entries[0], entries[1]
+	if !a.Uploaded || a.Key != "deep/a.mkv" || a.StorageClass != "DEEP_ARCHIVE" || a.Size != 10 || a.UploadedAt == 0 {
+		t.Fatalf("Expected a.mkv to be uploaded to deep/, got %+v", a)
+	}
+	if b.Uploaded || b.Destination != "deep/" {
+		t.Fatalf("Expected b.mkv to be pending for deep/, got %+v", b)
+	}
+
+	_, err = ro.db.Exec("delete from videos")
+	if err == nil {
+		t.Fatal("Expected the read only manifest to refuse writes")
+	}
+}
+
+func TestPartUploads(t *testing.T) {
+	db, err := InitDb(filepath.Join(t.TempDir(), "manifest.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.UpdateManifest(map[string]File{"a.mkv": {Modified: 1, Size: 30}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := db.SetMultipart("a.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range []string{"1-a.mkv.part0", "1-a.mkv.part1"} {
+		err = db.RecordPart(id, Part{Index: i, Path: p, Offset: int64(i) * 20, Size: 20, Hash: "h"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = db.UpdatePartUpload("1-a.mkv.part0", "deep/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts, err := db.Parts(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 2 || parts[1].Path != "1-a.mkv.part1" || parts[1].Offset != 20 {
+		t.Fatalf("Expected both parts in order, got %+v", parts)
+	}
+	for _, c := range []struct {
+		part, dest string
+		want       bool
+	}{{"1-a.mkv.part0", "deep/", true}, {"1-a.mkv.part0", "ia/", false}, {"1-a.mkv.part1", "deep/", false}} {
+		got, err := db.PartUploaded(c.part, c.dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Fatalf("Expected %s uploaded to %s to be %v", c.part, c.dest, c.want)
+		}
+	}
+
+	// a part that is written again has to be uploaded again
+	err = db.RecordPart(id, Part{Index: 0, Path: "1-a.mkv.part0", Size: 20, Hash: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done, _ := db.PartUploaded("1-a.mkv.part0", "deep/"); done {
+		t.Fatal("Expected the rewritten part to be pending")
+	}
+
+	// parts of an older version of the file are forgotten
+	err = db.UpdateRecord("a.mkv", File{Modified: 2, Size: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := db.PartFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("Expected no parts after the file changed, got %v", files)
+	}
+}
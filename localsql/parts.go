@@ -0,0 +1,133 @@
+package localsql
+
+import (
+	"time"
+)
+
+const CREATEPARTUPLOADSTABLE = "create table if not exists part_uploads (part_id integer not null, destination text not null, uploaded_at integer default (0), primary key (part_id, destination))"
+
+const UPSERTPART = "insert into parts (video_id, filepath, part_index, byte_offset, size, hash) values(?, ?, ?, ?, ?, ?) on conflict(filepath) do update set (video_id, part_index, byte_offset, size, hash, uploaded) = (excluded.video_id, excluded.part_index, excluded.byte_offset, excluded.size, excluded.hash, 0)"
+const RESETPARTUPLOADS = "delete from part_uploads where part_id = (select id from parts where filepath = ?)"
+const SELECTPARTS = "select id, part_index, filepath, byte_offset, size, hash from parts where video_id = ? order by part_index"
+const UPSERTPARTUPLOAD = "insert into part_uploads (part_id, destination, uploaded_at) select id, ?, ? from parts where filepath = ? on conflict(part_id, destination) do update set uploaded_at = excluded.uploaded_at"
+const SELECTPARTUPLOADED = "select count(*) from part_uploads join parts on parts.id = part_uploads.part_id where parts.filepath = ? and part_uploads.destination = ?"
+const SELECTPARTFILES = "select parts.filepath, videos.filepath from parts join videos on videos.id = parts.video_id"
+const RESETVIDEOPARTUPLOADS = "delete from part_uploads where part_id in (select parts.id from parts join videos on videos.id = parts.video_id where videos.filepath = ?)"
+const RESETVIDEOPARTS = "delete from parts where video_id = (select id from videos where filepath = ?)"
+const DELETEPARTUPLOADS = "delete from part_uploads where part_id in (select id from parts where video_id = ?)"
+const DELETEPARTS = "delete from parts where video_id = ?"
+const RESETSPLITHASH = "update videos set split_hash = '' where id = ?"
+const UPDATESPLITHASH = "update videos set split_hash = ? where id = ?"
+const SELECTSPLITHASH = "select split_hash from videos where id = ?"
+
+// Part is a piece of a split video.
+type Part struct {
+	ID     int
+	Index  int
+	Path   string
+	Offset int64 // where the part starts in the video
+	Size   int64
+	Hash   string // hex sha256 of the part, empty until it has been read once
+}
+
+// RecordPart records a part of the video. A part that is recorded again has to be uploaded again.
+func (m *Sqldb) RecordPart(videoid int, part Part) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(UPSERTPART, videoid, part.Path, part.Index, part.Offset, part.Size, part.Hash)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(RESETPARTUPLOADS, part.Path)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Parts returns the recorded parts of the video in order.
+func (m *Sqldb) Parts(videoid int) ([]Part, error) {
+	rows, err := m.db.Query(SELECTPARTS, videoid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Part
+	for rows.Next() {
+		var p Part
+		err = rows.Scan(&p.ID, &p.Index, &p.Path, &p.Offset, &p.Size, &p.Hash)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+	return res, rows.Err()
+}
+
+// ResetParts forgets the parts of the video and where they were uploaded to, for when it is split differently.
+func (m *Sqldb) ResetParts(videoid int) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{DELETEPARTUPLOADS, DELETEPARTS, RESETSPLITHASH} {
+		_, err = tx.Exec(stmt, videoid)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RecordSplitHash keeps the hex sha256 of the whole video with its parts, so a resumed upload does not
+// have to read the video again for the sidecar. It is forgotten when the video changes or is split differently.
+func (m *Sqldb) RecordSplitHash(videoid int, hash string) error {
+	_, err := m.db.Exec(UPDATESPLITHASH, hash, videoid)
+	return err
+}
+
+// SplitHash returns the hash RecordSplitHash kept for the video, empty when there is none.
+func (m *Sqldb) SplitHash(videoid int) (string, error) {
+	var hash string
+	err := m.db.QueryRow(SELECTSPLITHASH, videoid).Scan(&hash)
+	return hash, err
+}
+
+// UpdatePartUpload records that the part at p has been uploaded to destination.
+func (m *Sqldb) UpdatePartUpload(p string, destination string) error {
+	_, err := m.db.Exec(UPSERTPARTUPLOAD, destination, time.Now().Unix(), p)
+	if err != nil {
+		return err
+	}
+	return m.UpdateUploadStatusPart(p)
+}
+
+// PartUploaded reports whether the part at p has been uploaded to destination since it was written.
+func (m *Sqldb) PartUploaded(p string, destination string) (bool, error) {
+	var count int
+	err := m.db.QueryRow(SELECTPARTUPLOADED, p, destination).Scan(&count)
+	return count > 0, err
+}
+
+// PartFiles returns the path of every recorded part with the path of the video it belongs to.
+func (m *Sqldb) PartFiles() (map[string]string, error) {
+	rows, err := m.db.Query(SELECTPARTFILES)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make(map[string]string)
+	for rows.Next() {
+		var part, video string
+		err = rows.Scan(&part, &video)
+		if err != nil {
+			return nil, err
+		}
+		res[part] = video
+	}
+	return res, rows.Err()
+}
@@ -0,0 +1,82 @@
+package localsql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Every file once per destination the manifest knows about, files are returned once with
+// an empty destination when nothing has been uploaded anywhere yet.
+const SELECTENTRIES = `with dests as (select distinct destination from uploads)
+select v.filepath, v.size, v.modified, v.multipart, (select count(*) from parts p where p.video_id = v.id),
+	coalesce(d.destination, ''), coalesce(u.uploaded, 0), coalesce(u.uploaded_at, 0), coalesce(u.key, ''), coalesce(u.storage_class, '')
+from videos v
+left join dests d
+left join uploads u on u.video_id = v.id and u.destination = d.destination
+order by v.filepath, d.destination`
+
+// Entry is a file in the manifest together with its state on one destination.
+type Entry struct {
+	Path         string `json:"path"`
+	Size         int64  `json:"size"`
+	Modified     int64  `json:"modified"`
+	Multipart    bool   `json:"multipart"`
+	Parts        int    `json:"parts"`
+	Destination  string `json:"destination"`
+	Uploaded     bool   `json:"uploaded"`
+	UploadedAt   int64  `json:"uploaded_at,omitempty"`
+	Key          string `json:"key,omitempty"`
+	StorageClass string `json:"storage_class,omitempty"`
+}
+
+// OpenReadOnly opens an existing manifest for queries. It does not write, so it can be used while a sync runs.
+func OpenReadOnly(dbpath string) (*Sqldb, error) {
+	if _, err := os.Stat(dbpath); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("there is no manifest at %s, nothing has been synced with it yet", dbpath)
+	} else if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", dbpath+"?_busy_timeout=5000&_query_only=1")
+	if err != nil {
+		return nil, err
+	}
+	myDb := &Sqldb{db: db}
+
+	var version int
+	err = db.QueryRow("pragma user_version").Scan(&version)
+	if err != nil {
+		return nil, err
+	}
+	if version < len(migrations) {
+		db.Close()
+		return nil, fmt.Errorf("%s was written by an older version of cleansync, run a sync to upgrade it", dbpath)
+	}
+	return myDb, nil
+}
+
+// Close closes the manifest.
+func (m *Sqldb) Close() error {
+	return m.db.Close()
+}
+
+// Entries returns the state of every file in the manifest, see SELECTENTRIES.
+func (m *Sqldb) Entries() ([]Entry, error) {
+	rows, err := m.db.Query(SELECTENTRIES)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Entry
+	for rows.Next() {
+		var e Entry
+		err = rows.Scan(&e.Path, &e.Size, &e.Modified, &e.Multipart, &e.Parts,
+			&e.Destination, &e.Uploaded, &e.UploadedAt, &e.Key, &e.StorageClass)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
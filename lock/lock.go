@@ -0,0 +1,181 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// HeartbeatInterval is how often a held lock is refreshed.
+const HeartbeatInterval = 30 * time.Second
+
+// StaleAfter is how long a lock may go without a heartbeat before it is considered abandoned.
+const StaleAfter = 4 * HeartbeatInterval
+
+// Info is what a lock file holds about the run that owns it.
+type Info struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	Started   time.Time `json:"started"`
+	Heartbeat time.Time `json:"heartbeat"`
+}
+
+// LockedError is returned when another live run holds the lock.
+type LockedError struct {
+	Path string
+	Info Info
+}
+
+func (e *LockedError) Error() string {
+	if e.Info.PID == 0 {
+		return fmt.Sprintf("another cleansync run is taking the lock on the manifest. If that is not true remove %s", e.Path)
+	}
+	return fmt.Sprintf("another cleansync run (pid %d on %s, started %s, last heartbeat %s) is using the manifest. If that is not true remove %s",
+		e.Info.PID, e.Info.Host, e.Info.Started.Format(time.RFC3339), e.Info.Heartbeat.Format(time.RFC3339), e.Path)
+}
+
+// Lock is an advisory lock on a manifest, held by this process until Release is called.
+type Lock struct {
+	path string
+	info Info
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Path returns the lock file that belongs to the manifest at dbpath.
+func Path(dbpath string) string {
+	return dbpath + ".lock"
+}
+
+// Acquire takes the lock of the manifest at dbpath. A lock left behind by a run that
+// died is taken over, a lock held by a live run returns a *LockedError.
+func Acquire(dbpath string) (*Lock, error) {
+	host, _ := os.Hostname()
+	now := time.Now()
+	l := &Lock{
+		path: Path(dbpath),
+		info: Info{
+			PID:       os.Getpid(),
+			Host:      host,
+			Started:   now,
+			Heartbeat: now,
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		err := l.create()
+		if err == nil {
+			go l.heartbeat()
+			return l, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		held, err := Read(l.path)
+		if err != nil {
+			// being written by a run that just took it, or garbage. Only the age of the file can tell.
+			fi, statErr := os.Stat(l.path)
+			if statErr == nil && time.Since(fi.ModTime()) <= StaleAfter {
+				return nil, &LockedError{Path: l.path, Info: held}
+			}
+			os.Remove(l.path)
+			continue
+		}
+		if !held.Stale(host) {
+			return nil, &LockedError{Path: l.path, Info: held}
+		}
+		os.Remove(l.path)
+	}
+	return nil, fmt.Errorf("unable to take the lock %s", l.path)
+}
+
+// Read returns the information in the lock file at path.
+func Read(path string) (Info, error) {
+	var info Info
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(b, &info)
+	return info, err
+}
+
+// Stale reports whether the run holding the lock is gone. host is the name of this machine,
+// on other machines only the heartbeat can tell.
+func (i Info) Stale(host string) bool {
+	if time.Since(i.Heartbeat) > StaleAfter {
+		return true
+	}
+	return i.Host == host && !processAlive(i.PID)
+}
+
+// Release stops the heartbeat and removes the lock file.
+func (l *Lock) Release() error {
+	close(l.stop)
+	<-l.done
+	return os.Remove(l.path)
+}
+
+// create writes the lock file, failing with os.ErrExist if it is already there.
+func (l *Lock) create() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(l.info)
+}
+
+func (l *Lock) heartbeat() {
+	defer close(l.done)
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.info.Heartbeat = time.Now()
+			l.write()
+		}
+	}
+}
+
+// write replaces the lock file with the current info. It is written next to the lock and renamed over
+// it, so another run reading the lock never sees it empty or half written.
+func (l *Lock) write() error {
+	b, err := json.Marshal(l.info)
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, l.path)
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// processAlive reports whether a process with pid exists on this machine.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess opens the process on windows, it only succeeds if it exists
+		p.Release()
+		return true
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,98 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireTwice(t *testing.T) {
+	dbpath := filepath.Join(t.TempDir(), "manifest.db")
+	l, err := Acquire(dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Acquire(dbpath)
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("Expected a LockedError for the second run, got %v", err)
+	}
+	if locked.Info.PID != os.Getpid() {
+		t.Fatalf("Expected the lock to name pid %d, got %d", os.Getpid(), locked.Info.PID)
+	}
+
+	err = l.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err = Acquire(dbpath)
+	if err != nil {
+		t.Fatalf("Expected the lock to be free after release, got %v", err)
+	}
+	l.Release()
+}
+
+func TestStaleLock(t *testing.T) {
+	dbpath := filepath.Join(t.TempDir(), "manifest.db")
+	old := time.Now().Add(-time.Hour)
+	b, _ := json.Marshal(Info{PID: os.Getpid(), Host: "elsewhere", Started: old, Heartbeat: old})
+	err := os.WriteFile(Path(dbpath), b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Acquire(dbpath)
+	if err != nil {
+		t.Fatalf("Expected a lock without heartbeat to be taken over, got %v", err)
+	}
+	l.Release()
+}
+
+func TestUnreadableLock(t *testing.T) {
+	dbpath := filepath.Join(t.TempDir(), "manifest.db")
+	// what another run has just created and not written yet
+	err := os.WriteFile(Path(dbpath), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Acquire(dbpath)
+	var locked *LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("Expected a fresh lock that cannot be read to be held, got %v", err)
+	}
+
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(Path(dbpath), old, old)
+	l, err := Acquire(dbpath)
+	if err != nil {
+		t.Fatalf("Expected an old lock that cannot be read to be taken over, got %v", err)
+	}
+	l.info.Heartbeat = time.Now()
+	err = l.write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := Read(Path(dbpath)); err != nil || info.PID != os.Getpid() {
+		t.Fatalf("Expected the heartbeat to replace the lock, got %+v %v", info, err)
+	}
+	l.Release()
+}
+
+func TestStale(t *testing.T) {
+	now := time.Now()
+	alive := Info{PID: os.Getpid(), Host: "here", Heartbeat: now}
+	if alive.Stale("here") {
+		t.Fatal("Expected the lock of a live process to be held")
+	}
+	// no process has this pid on linux, windows or macos
+	dead := Info{PID: 1 << 30, Host: "here", Heartbeat: now}
+	if !dead.Stale("here") {
+		t.Fatal("Expected the lock of a dead process on this host to be stale")
+	}
+	if dead.Stale("there") {
+		t.Fatal("Expected a recent lock from another host to be held")
+	}
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"cleansync/actions/bucket"
+	"cleansync/actions/cost"
 	"cleansync/actions/menu"
 	"cleansync/actions/processVideo"
+	"cleansync/actions/runall"
+	"cleansync/actions/split"
+	"cleansync/actions/status"
 	"cleansync/actions/sync"
+	"cleansync/config"
 	"os"
 
 	"github.com/urfave/cli/v2"
@@ -14,6 +20,26 @@ func main() {
 		Name:   "cleansync",
 		Usage:  "tools to manage video library",
 		Action: menu.Display,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "How progress is reported: tui, plain (line oriented logs) or json (one event per line). plain and json do not need a terminal",
+				Value:   "tui",
+				EnvVars: []string{"CLEANSYNC_OUTPUT"},
+			},
+			&cli.PathFlag{
+				Name:    "config",
+				Usage:   "The config file holding the named profiles",
+				Value:   config.DefaultPath(),
+				EnvVars: []string{"CLEANSYNC_CONFIG"},
+			},
+			&cli.PathFlag{
+				Name:    "db",
+				Usage:   "The manifest to use. Defaults to the manifest setting of the profile, or <profile>.db in " + config.DataDir(),
+				EnvVars: []string{"CLEANSYNC_DB"},
+			},
+		},
 		Commands: []*cli.Command{
 			{
 				Name:   "adclear",
@@ -23,18 +49,109 @@ func main() {
 					&cli.PathFlag{
 						Name:     "source",
 						Usage:    "The source file or folder, if it is a folder, it will attempt to process all video files. (currently mp4, mkv)",
-						Required: true,
+						Required: false,
 					},
 					&cli.PathFlag{
 						Name:     "dest",
 						Usage:    "The destination file or folder",
-						Required: true,
+						Required: false,
 					},
 					&cli.BoolFlag{
 						Name:     "skip_first",
 						Usage:    "Skips the first chapter, thus omiting it from the final product. Usefull for removing that 'Recorded by...' at the begining of playon videos",
 						Required: false,
 					},
+					&cli.StringFlag{
+						Name:     "profile",
+						Usage:    "Take the source, dest, skip_first and chapter rule settings from this config profile. Flags override the profile",
+						Required: false,
+					},
+					&cli.PathFlag{
+						Name:     "cutlist",
+						Usage:    "A Comskip .txt, MPlayer .edl or \"start end\" cut list for the source. Without it a .edl or Comskip .txt next to each video is used",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "cutlist-mode",
+						Usage:    "replace to use the cut list instead of the chapters of the video, merge to cut its stretches out of them (default: replace)",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "cut-mode",
+						Usage:    "keyframe copies everything but cuts on the keyframe before each cut, accurate re-encodes the few frames between a cut and the next keyframe (default: keyframe)",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "mark-breaks",
+						Usage:    "Tag the chapters of the output that follow a removed break with break_removed, the seconds that were cut",
+						Required: false,
+					},
+					&cli.StringSliceFlag{
+						Name:     "audio-lang",
+						Usage:    "Keep only the audio streams in this language, e.g. eng. Can be specified multiple times, all audio is kept when none matches",
+						Required: false,
+					},
+					&cli.StringSliceFlag{
+						Name:     "sub-lang",
+						Usage:    "Keep only the subtitles, embedded or .srt sidecars, in this language. Can be specified multiple times",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "transcode",
+						Usage:    "Re-encode the output with this transcode profile, e.g. hevc-1080p, and keep it only if it is smaller. Profiles: hevc-1080p, hevc-720p, av1-1080p, av1-720p, h264-720p or one from the config file",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "verify-decode",
+						Usage:    "Decode every frame of the output before it is copied, besides checking its duration and streams",
+						Required: false,
+					},
+					&cli.IntFlag{
+						Name:     "jobs",
+						Usage:    "How many videos to process at the same time",
+						Value:    1,
+						Required: false,
+					},
+					&cli.IntFlag{
+						Name:     "cut-jobs",
+						Usage:    "How many of them to cut, transcode or verify at the same time, --jobs by default",
+						Required: false,
+					},
+					&cli.IntFlag{
+						Name:     "copy-jobs",
+						Usage:    "How many of them to copy to the destination at the same time, --jobs by default",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "force",
+						Usage:    "Process every video, also the ones the manifest says were processed and did not change since",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "detect",
+						Usage:    "Find the commercial breaks of videos without chapters from black frames and silence. This decodes the whole video",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "explain",
+						Usage:    "Do not process anything, list the chapters of the source and the rule that keeps or removes each of them",
+						Required: false,
+					},
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:      "history",
+						Usage:     "lists the videos adclear processed and what was cut from each of them",
+						ArgsUsage: "[pattern]",
+						Action:    processVideo.History,
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "profile",
+								Usage:    "List the videos of the manifest of this config profile",
+								Required: false,
+							},
+						},
+					},
 				},
 			},
 			{
@@ -42,28 +159,276 @@ func main() {
 				Usage:  "upload new files to the provided bucket",
 				Action: sync.Sync,
 				Flags: []cli.Flag{
-					&cli.PathFlag{
+					&cli.StringFlag{
+						Name:     "profile",
+						Usage:    "Take the settings from this config profile. Flags override the profile",
+						Required: false,
+					},
+					&cli.StringSliceFlag{
 						Name:     "path",
 						Aliases:  []string{"p"},
-						Usage:    "The source (local) folder to sync with S3",
-						Required: true,
+						Usage:    "The source (local) folder to sync with S3. Can be specified multiple times for multiple folders.",
+						Required: false,
 					},
-					&cli.StringFlag{
+					&cli.StringSliceFlag{
 						Name:     "bucket",
 						Aliases:  []string{"b"},
-						Usage:    "The name of the bucket to sysnc to",
-						Required: true,
+						Usage:    "The name of the bucket to sysnc to. Can be specified multiple times, every file goes to every bucket.",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "prefix",
+						Usage:    "Prepended to the key of every uploaded object",
+						Required: false,
 					},
 					&cli.StringSliceFlag{
 						Name:     "filter",
 						Aliases:  []string{"f"},
-						Usage:    "file types to filter for. Can be specified multiple times for multiple file types.",
+						Usage:    "file extensions to filter for, case insensitive. Can be specified multiple times for multiple file types, * syncs every file.",
+						Required: false,
+					},
+					&cli.StringSliceFlag{
+						Name:     "include",
+						Usage:    "Only sync files matching this gitignore style glob. Can be specified multiple times.",
+						Required: false,
+					},
+					&cli.StringSliceFlag{
+						Name:     "exclude",
+						Usage:    "Skip files matching this gitignore style glob, on top of any .cleansyncignore files. Can be specified multiple times.",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "min-size",
+						Usage:    "Skip files smaller than this, e.g. 100MB",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "max-size",
+						Usage:    "Skip files larger than this, e.g. 50GB",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "min-age",
+						Usage:    "Skip files modified more recently than this, e.g. 2d",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "max-age",
+						Usage:    "Skip files modified longer ago than this, e.g. 52w",
+						Required: false,
+					},
+					&cli.PathFlag{
+						Name:     "explain",
+						Usage:    "Do not upload anything, explain which rule includes or excludes the given file",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "storage-class",
+						Usage:    "The storage class of the uploads: STANDARD, STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING, GLACIER_IR, GLACIER or DEEP_ARCHIVE",
 						Required: false,
 					},
 					&cli.BoolFlag{
 						Name:     "deep",
 						Aliases:  []string{"d"},
-						Usage:    "deep archive in S3",
+						Usage:    "deep archive in S3, the same as --storage-class DEEP_ARCHIVE",
+						Required: false,
+					},
+					&cli.StringSliceFlag{
+						Name:     "class-rule",
+						Usage:    "Use another storage class for some files, CLASS:<SIZE, CLASS:>SIZE or CLASS:PATTERN e.g. GLACIER_IR:<1GB. The first matching rule wins. Can be specified multiple times.",
+						Required: false,
+					},
+					&cli.IntFlag{
+						Name:     "concurrency",
+						Usage:    "How many files are uploaded at the same time",
+						Value:    1,
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "rate-limit",
+						Usage:    "Limit the upload bandwidth of all uploads together, bytes per second e.g. 20MB",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "split-threshold",
+						Usage:    "Upload files bigger than this in parts, at most 5GB (default: 4GB)",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "part-size",
+						Usage:    "Size of the parts big files are uploaded in, at most 5GB (default: 2GB)",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "chunk-size",
+						Usage:    "Read files this much at a time while uploading (default: 16MB)",
+						Required: false,
+					},
+				},
+			},
+			{
+				Name:      "split",
+				Usage:     "splits a file into parts like the ones sync uploads, with a sidecar holding their hashes",
+				ArgsUsage: "<file>",
+				Action:    split.Split,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "size",
+						Usage: "The size of the parts, e.g. 4000MB to fit on FAT32",
+						Value: "2G",
+					},
+					&cli.PathFlag{
+						Name:     "out",
+						Usage:    "The folder to write the parts to, defaults to the folder of the file",
+						Required: false,
+					},
+				},
+			},
+			{
+				Name:      "join",
+				Usage:     "joins the parts of a file split by split or sync, checking them against the sidecar",
+				ArgsUsage: "<prefix>",
+				Action:    split.Join,
+				Flags: []cli.Flag{
+					&cli.PathFlag{
+						Name:     "out",
+						Usage:    "The file to write, defaults to the prefix itself",
+						Required: false,
+					},
+				},
+			},
+			{
+				Name:   "run-all",
+				Usage:  "runs every profile in the config file, adclear first then sync",
+				Action: runall.RunAll,
+			},
+			{
+				Name:  "bucket",
+				Usage: "manages the buckets that are synced to",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "lifecycle",
+						Usage: "manages the lifecycle rules that move objects to cheaper storage classes as they age",
+						Subcommands: []*cli.Command{
+							{
+								Name:   "apply",
+								Usage:  "installs a transition rule for the prefix, other rules of the bucket are kept",
+								Action: bucket.Apply,
+								Flags: []cli.Flag{
+									&cli.StringFlag{
+										Name:     "bucket",
+										Aliases:  []string{"b"},
+										Usage:    "The bucket",
+										Required: false,
+									},
+									&cli.StringFlag{
+										Name:     "region",
+										Usage:    "The region of the bucket, defaults to the one of the aws config",
+										Required: false,
+									},
+									&cli.StringFlag{
+										Name:     "profile",
+										Usage:    "Work on every bucket of this config profile instead of --bucket",
+										Required: false,
+									},
+									&cli.StringFlag{
+										Name:     "prefix",
+										Usage:    "Only objects under this prefix transition",
+										Required: false,
+									},
+									&cli.StringSliceFlag{
+										Name:     "transition",
+										Usage:    "DAYS:STORAGE_CLASS, e.g. 30:GLACIER_IR and 180:DEEP_ARCHIVE. Can be specified multiple times.",
+										Required: true,
+									},
+									&cli.StringFlag{
+										Name:     "id",
+										Usage:    "The id of the rule, defaults to cleansync-tiering followed by the prefix",
+										Required: false,
+									},
+								},
+							},
+							{
+								Name:   "show",
+								Usage:  "prints the lifecycle rules of the bucket",
+								Action: bucket.Show,
+								Flags: []cli.Flag{
+									&cli.StringFlag{
+										Name:     "bucket",
+										Aliases:  []string{"b"},
+										Usage:    "The bucket",
+										Required: false,
+									},
+									&cli.StringFlag{
+										Name:     "region",
+										Usage:    "The region of the bucket, defaults to the one of the aws config",
+										Required: false,
+									},
+									&cli.StringFlag{
+										Name:     "profile",
+										Usage:    "Work on every bucket of this config profile instead of --bucket",
+										Required: false,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:   "status",
+				Usage:  "shows what the manifest holds: files, sizes, what is uploaded and what is pending",
+				Action: status.Status,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "profile",
+						Usage:    "Show the manifest of this config profile",
+						Required: false,
+					},
+				},
+			},
+			{
+				Name:   "cost",
+				Usage:  "estimates what the archive costs: storage per month, uploads, early deletion and a full restore",
+				Action: cost.Cost,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "profile",
+						Usage:    "Estimate the manifest of this config profile",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "unknown-class",
+						Usage:    "The storage class of uploads made before the manifest recorded it",
+						Value:    "STANDARD",
+						Required: false,
+					},
+				},
+			},
+			{
+				Name:      "ls",
+				Usage:     "lists the files in the manifest with their upload state",
+				ArgsUsage: "[pattern]",
+				Action:    status.Ls,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "profile",
+						Usage:    "List the manifest of this config profile",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "pending",
+						Usage:    "Only list files that still have to be uploaded",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "multipart",
+						Usage:    "Only list files that were split into parts",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "since",
+						Usage:    "Only list uploads made since then, an age like 7d or a date like 2024-01-31",
 						Required: false,
 					},
 				},
@@ -1,13 +1,35 @@
 package messages
 
+import "time"
+
 type UploadMsg struct {
 	Done bool
 }
 
+// UploadPartsMsg is sent after the part at Index of OriginalFile has been uploaded to Destination.
 type UploadPartsMsg struct {
 	OriginalFile string
 	Parts        []string
 	Index        int
+	Size         int64
+	Destination  string
+}
+
+// UploadedMsg is sent once File, or all of its Parts, has been uploaded to Destination.
+type UploadedMsg struct {
+	File        string
+	Parts       []string
+	Size        int64
+	Destination string
+}
+
+// PartsReusedMsg is sent when Reused of the Total parts of File are on Destination already,
+// uploaded by a run that was interrupted.
+type PartsReusedMsg struct {
+	File        string
+	Reused      int
+	Total       int
+	Destination string
 }
 
 type SplitMsg struct {
@@ -15,10 +37,14 @@ type SplitMsg struct {
 	OrgFileSize int64
 }
 
+// ErrMsg is sent when processing File failed with Err.
 type ErrMsg struct {
-	err string
+	File string
+	Err  error
 }
 
+func (e ErrMsg) Error() string { return e.Err.Error() }
+
 type SplittingFileMsg struct {
 	name        string
 	offset      int64
@@ -30,10 +56,65 @@ type SplittingFileMsg struct {
 }
 
 type ProgressMsg struct {
-	Progress float64
+	File      string // empty when the progress is not about a single file
+	Progress  float64
+	Speed     float64       // times real time while ffmpeg works, 0 otherwise
+	Remaining time.Duration // 0 when unknown
 	// Action   int
 }
 
+// FileStartedMsg is sent when work on a file begins.
+type FileStartedMsg struct {
+	File string
+	Size int64
+}
+
+// StageMsg is sent when a file moves on to the next stage of its processing.
+type StageMsg struct {
+	File  string
+	Stage string
+}
+
+// FileSkippedMsg is sent when File is left alone, Reason says why.
+type FileSkippedMsg struct {
+	File   string
+	Reason string
+}
+
+// ChapterMsg is what adclear --explain found about the chapter at Index of File: which rule keeps or removes it.
+// From says where the chapters came from, empty when they are the ones of the video.
+type ChapterMsg struct {
+	File    string
+	Index   int
+	Start   float64 // seconds
+	End     float64
+	Title   string
+	Removed bool
+	From    string
+	Reason  string
+}
+
+// FileFailedMsg is sent when File could not be processed but the others can go on.
+type FileFailedMsg struct {
+	File string
+	Err  error
+}
+
+// TranscodedMsg is sent once File was re-encoded from Before to After bytes, Kept when that was smaller
+// and replaced the output.
+type TranscodedMsg struct {
+	File   string
+	Before int64
+	After  int64
+	Kept   bool
+}
+
+// FileDoneMsg is sent once a file has been completely processed.
+type FileDoneMsg struct {
+	File string
+	Size int64
+}
+
 const (
 	None = iota
 	WriteAction
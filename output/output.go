@@ -0,0 +1,321 @@
+package output
+
+import (
+	"cleansync/messages"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Mode selects how a command reports what it is doing.
+type Mode string
+
+const (
+	TUI   Mode = "tui"   // interactive Bubble Tea interface, needs a terminal
+	Plain Mode = "plain" // line oriented progress for logs
+	JSON  Mode = "json"  // one JSON event per line
+)
+
+// Event types written in plain and json mode.
+const (
+	EventFileStarted  = "file_started"
+	EventStage        = "stage"
+	EventProgress     = "progress"
+	EventPartUploaded = "part_uploaded"
+	EventPartsReused  = "parts_reused"
+	EventUploaded     = "uploaded"
+	EventTranscoded   = "transcoded"
+	EventFileDone     = "file_done"
+	EventSkipped      = "skipped"
+	EventError        = "error"
+	EventSummary      = "summary"
+	EventWarning      = "warning"
+	EventChapter      = "chapter"
+)
+
+// ParseMode validates the value given to --output.
+func ParseMode(s string) (Mode, error) {
+	switch Mode(strings.ToLower(s)) {
+	case "", TUI:
+		return TUI, nil
+	case Plain:
+		return Plain, nil
+	case JSON:
+		return JSON, nil
+	}
+	return "", fmt.Errorf("unknown output mode %q, expected tui, plain or json", s)
+}
+
+// Event is a single line of headless output.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	File     string    `json:"file,omitempty"`
+	Stage    string    `json:"stage,omitempty"`
+	Part     string    `json:"part,omitempty"`
+	Dest     string    `json:"destination,omitempty"`
+	Index    int       `json:"index,omitempty"`
+	Total    int       `json:"total,omitempty"`
+	Bytes    int64     `json:"bytes,omitempty"`
+	Before   int64     `json:"before,omitempty"` // bytes before a transcode
+	Progress float64   `json:"progress,omitempty"`
+	Speed    float64   `json:"speed,omitempty"`
+	Left     string    `json:"remaining,omitempty"` // e.g. 1m20s
+	Error    string    `json:"error,omitempty"`
+	Files    int       `json:"files,omitempty"`
+	Parts    int       `json:"parts,omitempty"`
+	Errors   int       `json:"errors,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	Chapter  *Chapter  `json:"chapter,omitempty"`
+}
+
+// Chapter is what adclear --explain decided for a chapter.
+type Chapter struct {
+	Index   int     `json:"index"`
+	Start   float64 `json:"start"` // seconds
+	End     float64 `json:"end"`
+	Title   string  `json:"title"`
+	Removed bool    `json:"removed"`
+	From    string  `json:"from,omitempty"` // where the chapters came from, when not from the video
+	Reason  string  `json:"reason"`
+}
+
+// Reporter turns the messages consumed by the Bubble Tea models into events.
+type Reporter struct {
+	mode     Mode
+	w        io.Writer
+	started  time.Time
+	files    int
+	parts    int
+	errors   int
+	bytes    int64
+	lastStep map[string]int // last progress step reported, by file
+}
+
+// NewReporter returns a reporter writing events in the given mode to w.
+func NewReporter(mode Mode, w io.Writer) *Reporter {
+	return &Reporter{
+		mode:     mode,
+		w:        w,
+		started:  time.Now(),
+		lastStep: map[string]int{},
+	}
+}
+
+// Report translates msg into zero or more events.
+func (r *Reporter) Report(msg tea.Msg) {
+	switch msg := msg.(type) {
+	case messages.FileStartedMsg:
+		delete(r.lastStep, msg.File)
+		r.Emit(Event{Type: EventFileStarted, File: msg.File, Bytes: msg.Size})
+	case messages.StageMsg:
+		delete(r.lastStep, msg.File)
+		r.Emit(Event{Type: EventStage, File: msg.File, Stage: msg.Stage})
+	case messages.ProgressMsg:
+		// The progress readers tick every 250ms, only report whole steps.
+		step := int(msg.Progress * 100)
+		if r.mode == Plain {
+			step = step / 10 * 10
+		}
+		if last, ok := r.lastStep[msg.File]; ok && step == last {
+			return
+		}
+		r.lastStep[msg.File] = step
+		e := Event{Type: EventProgress, File: msg.File, Progress: msg.Progress, Speed: msg.Speed}
+		if msg.Remaining > 0 {
+			e.Left = msg.Remaining.String()
+		}
+		r.Emit(e)
+	case messages.UploadPartsMsg:
+		r.parts++
+		r.Emit(Event{Type: EventPartUploaded, File: msg.OriginalFile, Part: msg.Parts[msg.Index], Dest: msg.Destination, Index: msg.Index + 1, Total: len(msg.Parts), Bytes: msg.Size})
+	case messages.PartsReusedMsg:
+		r.Emit(Event{Type: EventPartsReused, File: msg.File, Dest: msg.Destination, Parts: msg.Reused, Total: msg.Total})
+	case messages.UploadedMsg:
+		r.Emit(Event{Type: EventUploaded, File: msg.File, Dest: msg.Destination, Bytes: msg.Size})
+	case messages.TranscodedMsg:
+		e := Event{Type: EventTranscoded, File: msg.File, Bytes: msg.After, Before: msg.Before, Message: "kept the original, the transcode is not smaller"}
+		if msg.Kept {
+			e.Message = "kept the transcode"
+		}
+		r.Emit(e)
+	case messages.FileDoneMsg:
+		r.files++
+		r.bytes += msg.Size
+		r.Emit(Event{Type: EventFileDone, File: msg.File, Bytes: msg.Size})
+	case messages.FileSkippedMsg:
+		r.Emit(Event{Type: EventSkipped, File: msg.File, Message: msg.Reason})
+	case messages.ChapterMsg:
+		c := Chapter{Index: msg.Index, Start: msg.Start, End: msg.End, Title: msg.Title, Removed: msg.Removed, From: msg.From, Reason: msg.Reason}
+		r.Emit(Event{Type: EventChapter, File: msg.File, Chapter: &c})
+	case messages.FileFailedMsg:
+		r.Report(messages.ErrMsg(msg))
+	case messages.ErrMsg:
+		r.errors++
+		e := Event{Type: EventError, File: msg.File}
+		if msg.Err != nil {
+			e.Error = msg.Err.Error()
+		}
+		r.Emit(e)
+	}
+}
+
+// Summary writes the closing event of a run. err is the error the run ended with, if any.
+func (r *Reporter) Summary(err error) {
+	if err != nil {
+		r.Report(messages.ErrMsg{Err: err})
+	}
+	r.Emit(Event{
+		Type:     EventSummary,
+		Files:    r.files,
+		Parts:    r.parts,
+		Errors:   r.errors,
+		Bytes:    r.bytes,
+		Duration: time.Since(r.started).Round(time.Second).String(),
+	})
+}
+
+// Emit writes a single event.
+func (r *Reporter) Emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if r.mode == JSON {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return
+		}
+		fmt.Fprintln(r.w, string(b))
+		return
+	}
+	fmt.Fprintln(r.w, formatPlain(e))
+}
+
+// Warn reports something the user has to know about before a run starts. In json mode it is
+// a warning event on stdout, otherwise it goes to stderr so it is not lost between progress lines.
+func Warn(mode Mode, message string) {
+	if mode == JSON {
+		NewReporter(mode, os.Stdout).Emit(Event{Type: EventWarning, Message: message})
+		return
+	}
+	NewReporter(Plain, os.Stderr).Emit(Event{Type: EventWarning, Message: message})
+}
+
+// formatPlain renders an event as a single human readable log line.
+func formatPlain(e Event) string {
+	ts := e.Time.Format("2006-01-02 15:04:05")
+	switch e.Type {
+	case EventFileStarted:
+		return fmt.Sprintf("%s started   %s (%d bytes)", ts, e.File, e.Bytes)
+	case EventStage:
+		return fmt.Sprintf("%s %-9s %s", ts, e.Stage, e.File)
+	case EventProgress:
+		var file string
+		if e.File != "" {
+			file = " " + e.File
+		}
+		return fmt.Sprintf("%s progress  %3.0f%%%s%s", ts, e.Progress*100, file, speedAndLeft(e.Speed, e.Left))
+	case EventPartUploaded:
+		return fmt.Sprintf("%s uploaded  part %d/%d %s to %s", ts, e.Index, e.Total, e.Part, e.Dest)
+	case EventPartsReused:
+		return fmt.Sprintf("%s reused    %d/%d parts of %s on %s", ts, e.Parts, e.Total, e.File, e.Dest)
+	case EventUploaded:
+		return fmt.Sprintf("%s uploaded  %s to %s", ts, e.File, e.Dest)
+	case EventTranscoded:
+		return fmt.Sprintf("%s transcoded %s from %d to %d bytes, %s", ts, e.File, e.Before, e.Bytes, e.Message)
+	case EventFileDone:
+		return fmt.Sprintf("%s done      %s", ts, e.File)
+	case EventSkipped:
+		return fmt.Sprintf("%s skipped   %s: %s", ts, e.File, e.Message)
+	case EventError:
+		if e.File != "" {
+			return fmt.Sprintf("%s error     %s: %s", ts, e.File, e.Error)
+		}
+		return fmt.Sprintf("%s error     %s", ts, e.Error)
+	case EventSummary:
+		return fmt.Sprintf("%s summary   %d files, %d parts, %d bytes, %d errors in %s", ts, e.Files, e.Parts, e.Bytes, e.Errors, e.Duration)
+	case EventWarning:
+		return fmt.Sprintf("%s WARNING   %s", ts, e.Message)
+	case EventChapter:
+		if e.Chapter == nil {
+			return fmt.Sprintf("%s chapters  %s: %s", ts, e.File, e.Message)
+		}
+		verdict := "kept"
+		if e.Chapter.Removed {
+			verdict = "removed"
+		}
+		return fmt.Sprintf("%s chapter   %s #%d %.3f-%.3f %q %s: %s", ts, e.File, e.Chapter.Index, e.Chapter.Start, e.Chapter.End, e.Chapter.Title, verdict, e.Chapter.Reason)
+	}
+	return fmt.Sprintf("%s %s %s", ts, e.Type, e.File)
+}
+
+// headless wraps a model so every message it consumes is also reported.
+type headless struct {
+	model    tea.Model
+	reporter *Reporter
+}
+
+func (h headless) Init() tea.Cmd {
+	return h.model.Init()
+}
+
+func (h headless) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	h.reporter.Report(msg)
+	var cmd tea.Cmd
+	h.model, cmd = h.model.Update(msg)
+	return h, cmd
+}
+
+func (h headless) View() string {
+	return ""
+}
+
+// Program runs a model either as a TUI or headless, depending on the mode.
+type Program struct {
+	*tea.Program
+	reporter *Reporter
+}
+
+// NewProgram creates the program for model. In plain and json mode no terminal is
+// needed, the renderer and input are disabled and events are written to stdout.
+func NewProgram(model tea.Model, mode Mode) *Program {
+	if mode == TUI || mode == "" {
+		return &Program{Program: tea.NewProgram(model)}
+	}
+	r := NewReporter(mode, os.Stdout)
+	h := headless{model: model, reporter: r}
+	return &Program{
+		Program:  tea.NewProgram(h, tea.WithoutRenderer(), tea.WithInput(nil)),
+		reporter: r,
+	}
+}
+
+// Run runs the program and returns the final state of the wrapped model.
+func (p *Program) Run() (tea.Model, error) {
+	m, err := p.Program.Run()
+	if h, ok := m.(headless); ok {
+		m = h.model
+	}
+	if p.reporter != nil {
+		p.reporter.Summary(err)
+	}
+	return m, err
+}
+
+// speedAndLeft describes the speed and remaining time of a progress event, if they are known.
+func speedAndLeft(speed float64, left string) string {
+	var res string
+	if speed > 0 {
+		res += fmt.Sprintf(" %.1fx", speed)
+	}
+	if left != "" {
+		res += " " + left + " left"
+	}
+	return res
+}
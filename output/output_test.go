@@ -0,0 +1,114 @@
+package output
+
+import (
+	"bytes"
+	"cleansync/messages"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportJSON(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewReporter(JSON, &buf)
+	r.Report(messages.FileStartedMsg{File: "a.mkv", Size: 10})
+	r.Report(messages.ProgressMsg{Progress: 0.5})
+	r.Report(messages.ProgressMsg{Progress: 0.501})
+	r.Report(messages.FileDoneMsg{File: "a.mkv", Size: 10})
+	r.Summary(nil)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 events but got %d: %s", len(lines), buf.String())
+	}
+	var summary Event
+	err := json.Unmarshal([]byte(lines[3]), &summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Type != EventSummary || summary.Files != 1 || summary.Bytes != 10 {
+		t.Fatalf("Unexpected summary %+v", summary)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	if _, err := ParseMode("xml"); err == nil {
+		t.Fatal("Expected an error for an unknown mode")
+	}
+	mode, err := ParseMode("JSON")
+	if err != nil || mode != JSON {
+		t.Fatalf("Expected json mode, got %s %v", mode, err)
+	}
+}
+
+func TestReportPlainSpeed(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewReporter(Plain, &buf)
+	r.Report(messages.ProgressMsg{Progress: 0.4, Speed: 2.5, Remaining: 80 * time.Second})
+	if !strings.HasSuffix(strings.TrimSpace(buf.String()), "progress   40% 2.5x 1m20s left") {
+		t.Fatalf("Expected the speed and time left, got %s", buf.String())
+	}
+}
+
+func TestReportProgressByFile(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewReporter(Plain, &buf)
+	r.Report(messages.ProgressMsg{File: "a.mkv", Progress: 0.4})
+	r.Report(messages.ProgressMsg{File: "b.mkv", Progress: 0.42})
+	r.Report(messages.ProgressMsg{File: "a.mkv", Progress: 0.45})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[1], "progress   42% b.mkv") {
+		t.Fatalf("Expected the progress of each file on its own, got %s", buf.String())
+	}
+}
+
+func TestReportSkipped(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewReporter(Plain, &buf)
+	r.Report(messages.FileSkippedMsg{File: "a.mkv", Reason: "unchanged"})
+	if !strings.HasSuffix(strings.TrimSpace(buf.String()), "skipped   a.mkv: unchanged") {
+		t.Fatalf("Expected the skipped file and why, got %s", buf.String())
+	}
+}
+
+func TestReportTranscoded(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewReporter(JSON, &buf)
+	r.Report(messages.TranscodedMsg{File: "a.mkv", Before: 100, After: 60, Kept: true})
+	var e Event
+	err := json.Unmarshal(buf.Bytes(), &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != EventTranscoded || e.Before != 100 || e.Bytes != 60 || e.Message != "kept the transcode" {
+		t.Fatalf("Unexpected event %+v", e)
+	}
+}
+
+func TestReportFileFailed(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewReporter(Plain, &buf)
+	r.Report(messages.FileFailedMsg{File: "a.mkv", Err: errors.New("it is 1m long instead of 2m")})
+	if !strings.Contains(buf.String(), "error     a.mkv: it is 1m long instead of 2m") || r.errors != 1 {
+		t.Fatalf("Expected the failure to be reported as an error, got %s", buf.String())
+	}
+}
+
+func TestReportChapter(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewReporter(JSON, &buf)
+	r.Report(messages.ChapterMsg{File: "a.mkv", Index: 0, Start: 0, End: 30, Title: "Advertisement", Removed: true, Reason: "the default rule"})
+	var e Event
+	err := json.Unmarshal(buf.Bytes(), &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != EventChapter || e.File != "a.mkv" || e.Chapter == nil || !e.Chapter.Removed || e.Chapter.End != 30 {
+		t.Fatalf("Unexpected event %+v", e)
+	}
+	if !strings.Contains(buf.String(), `"index":0`) {
+		t.Fatalf("Expected the index of the first chapter to be written, got %s", buf.String())
+	}
+}
@@ -0,0 +1,152 @@
+package pricing
+
+import (
+	"sort"
+	"time"
+)
+
+const gb = float64(1 << 30)
+
+// Object is an upload as the estimate sees it.
+type Object struct {
+	StorageClass string
+	Size         int64
+	Objects      int       // what it is stored as in the bucket, more than 1 for split files
+	UploadedAt   time.Time // zero if the manifest does not know
+	Deleted      bool      // the local file is gone, it is up for deletion from the bucket
+}
+
+// Report is the estimate for a set of uploads.
+type Report struct {
+	Classes  []ClassCost `json:"classes"`
+	Monthly  float64     `json:"monthly"`
+	Uploads  []MonthCost `json:"uploads"`
+	Put      float64     `json:"put"`
+	Deletes  DeleteCost  `json:"deletes"`
+	Restore  []TierCost  `json:"restore"`
+	Unpriced []string    `json:"unpriced,omitempty"` // storage classes the table has no prices for
+}
+
+// ClassCost is what is stored in one class and what it costs per month.
+type ClassCost struct {
+	StorageClass string  `json:"storage_class"`
+	Files        int     `json:"files"`
+	Objects      int     `json:"objects"`
+	Bytes        int64   `json:"bytes"`
+	Monthly      float64 `json:"monthly"`
+}
+
+// MonthCost is what was uploaded in one month and what the PUT requests cost.
+type MonthCost struct {
+	Month   string  `json:"month"` // 2006-01, or unknown
+	Objects int     `json:"objects"`
+	Bytes   int64   `json:"bytes"`
+	Put     float64 `json:"put"`
+}
+
+// DeleteCost is what deleting the objects of files that are gone locally would cost
+// for the part of their minimum storage duration that has not passed yet.
+type DeleteCost struct {
+	Files   int     `json:"files"`
+	Bytes   int64   `json:"bytes"`
+	Penalty float64 `json:"penalty"`
+}
+
+// TierCost is what restoring everything at one retrieval tier costs.
+type TierCost struct {
+	Tier      string  `json:"tier"`
+	Available bool    `json:"available"` // false if a class holding data does not offer the tier
+	Retrieval float64 `json:"retrieval"`
+	Requests  float64 `json:"requests"`
+	Transfer  float64 `json:"transfer"`
+	Total     float64 `json:"total"`
+}
+
+// Estimate works out the costs of objects with the prices of t, now is used for the early deletion penalties.
+func (t Table) Estimate(objects []Object, now time.Time) Report {
+	var r Report
+	classes := make(map[string]*ClassCost)
+	months := make(map[string]*MonthCost)
+	unpriced := make(map[string]bool)
+	restore := make([]TierCost, len(Tiers))
+	for i, tier := range Tiers {
+		restore[i] = TierCost{Tier: tier, Available: true}
+	}
+
+	for _, o := range objects {
+		if o.Objects < 1 {
+			o.Objects = 1
+		}
+		size := float64(o.Size) / gb
+		price, ok := t[o.StorageClass]
+		if !ok {
+			unpriced[o.StorageClass] = true
+		}
+
+		cc, ok := classes[o.StorageClass]
+		if !ok {
+			cc = &ClassCost{StorageClass: o.StorageClass}
+			classes[o.StorageClass] = cc
+		}
+		cc.Files++
+		cc.Objects += o.Objects
+		cc.Bytes += o.Size
+		cc.Monthly += size*price.StoragePerGB + float64(o.Objects)/1000*price.ObjectMonthPer1000
+
+		month := "unknown"
+		if !o.UploadedAt.IsZero() {
+			month = o.UploadedAt.Format("2006-01")
+		}
+		mc, ok := months[month]
+		if !ok {
+			mc = &MonthCost{Month: month}
+			months[month] = mc
+		}
+		put := float64(o.Objects) / 1000 * price.PutPer1000
+		mc.Objects += o.Objects
+		mc.Bytes += o.Size
+		mc.Put += put
+		r.Put += put
+
+		if o.Deleted {
+			r.Deletes.Files++
+			r.Deletes.Bytes += o.Size
+			if !o.UploadedAt.IsZero() {
+				stored := now.Sub(o.UploadedAt).Hours() / 24
+				if left := price.MinimumDays - stored; left > 0 {
+					r.Deletes.Penalty += size * price.StoragePerGB * left / 30
+				}
+			}
+		}
+
+		for i, tier := range Tiers {
+			retrieval, ok := price.Retrieval[tier]
+			if !ok {
+				restore[i].Available = false
+				continue
+			}
+			restore[i].Retrieval += size * retrieval.PerGB
+			restore[i].Requests += float64(o.Objects) / 1000 * retrieval.Per1000
+			restore[i].Transfer += size * price.TransferOutPerGB
+		}
+	}
+
+	for _, cc := range classes {
+		r.Classes = append(r.Classes, *cc)
+		r.Monthly += cc.Monthly
+	}
+	sort.Slice(r.Classes, func(i, j int) bool { return r.Classes[i].StorageClass < r.Classes[j].StorageClass })
+	for _, mc := range months {
+		r.Uploads = append(r.Uploads, *mc)
+	}
+	sort.Slice(r.Uploads, func(i, j int) bool { return r.Uploads[i].Month < r.Uploads[j].Month })
+	for i := range restore {
+		restore[i].Total = restore[i].Retrieval + restore[i].Requests + restore[i].Transfer
+	}
+	r.Restore = restore
+	for class := range unpriced {
+		r.Unpriced = append(r.Unpriced, class)
+	}
+	sort.Strings(r.Unpriced)
+	return r
+}
@@ -0,0 +1,142 @@
+package pricing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Retrieval tiers of the archive classes. Classes that are read instantly charge the same for every tier.
+const (
+	Expedited = "expedited"
+	Standard  = "standard"
+	Bulk      = "bulk"
+)
+
+// Tiers are the retrieval tiers from fastest to cheapest.
+var Tiers = []string{Expedited, Standard, Bulk}
+
+// Class is what S3 charges for one storage class, in dollars.
+type Class struct {
+	StoragePerGB       float64 // per GB-month
+	PutPer1000         float64 // per 1000 PUT requests
+	MinimumDays        float64 // objects are billed for at least this long, deleting earlier costs the rest
+	ObjectMonthPer1000 float64 // monthly charge per 1000 objects, e.g. intelligent tiering monitoring
+	TransferOutPerGB   float64 // downloading the restored data
+	Retrieval          map[string]Retrieval
+}
+
+// Retrieval is the price of restoring from a class at one tier.
+type Retrieval struct {
+	PerGB   float64
+	Per1000 float64 // per 1000 restore (or GET) requests
+}
+
+// Table holds the prices by storage class name.
+type Table map[string]Class
+
+// Defaults are the us-east-1 list prices. Use the pricing section of the config file for other regions.
+func Defaults() Table {
+	instant := func(perGB float64, per1000 float64) map[string]Retrieval {
+		r := Retrieval{PerGB: perGB, Per1000: per1000}
+		return map[string]Retrieval{Expedited: r, Standard: r, Bulk: r}
+	}
+	return Table{
+		"STANDARD": {
+			StoragePerGB: 0.023, PutPer1000: 0.005, TransferOutPerGB: 0.09,
+			Retrieval: instant(0, 0.0004),
+		},
+		"INTELLIGENT_TIERING": {
+			StoragePerGB: 0.023, PutPer1000: 0.005, ObjectMonthPer1000: 0.0025, TransferOutPerGB: 0.09,
+			Retrieval: instant(0, 0.0004),
+		},
+		"STANDARD_IA": {
+			StoragePerGB: 0.0125, PutPer1000: 0.01, MinimumDays: 30, TransferOutPerGB: 0.09,
+			Retrieval: instant(0.01, 0.001),
+		},
+		"ONEZONE_IA": {
+			StoragePerGB: 0.01, PutPer1000: 0.01, MinimumDays: 30, TransferOutPerGB: 0.09,
+			Retrieval: instant(0.01, 0.001),
+		},
+		"GLACIER_IR": {
+			StoragePerGB: 0.004, PutPer1000: 0.02, MinimumDays: 90, TransferOutPerGB: 0.09,
+			Retrieval: instant(0.03, 0.01),
+		},
+		"GLACIER": {
+			StoragePerGB: 0.0036, PutPer1000: 0.03, MinimumDays: 90, TransferOutPerGB: 0.09,
+			Retrieval: map[string]Retrieval{
+				Expedited: {PerGB: 0.03, Per1000: 10},
+				Standard:  {PerGB: 0.01, Per1000: 0.05},
+				Bulk:      {PerGB: 0, Per1000: 0},
+			},
+		},
+		"DEEP_ARCHIVE": {
+			StoragePerGB: 0.00099, PutPer1000: 0.05, MinimumDays: 180, TransferOutPerGB: 0.09,
+			Retrieval: map[string]Retrieval{
+				Standard: {PerGB: 0.02, Per1000: 0.1},
+				Bulk:     {PerGB: 0.0025, Per1000: 0.025},
+			},
+		},
+	}
+}
+
+// Override changes the prices named in overrides, keyed by storage class and then by price:
+//
+//	storage_per_gb, put_per_1000, minimum_days, object_month_per_1000, transfer_out_per_gb,
+//	retrieval_<tier>_per_gb and retrieval_<tier>_per_1000
+//
+// Classes that are not in the table yet are added.
+func (t Table) Override(overrides map[string]map[string]float64) error {
+	classes := make([]string, 0, len(overrides))
+	for name := range overrides {
+		classes = append(classes, name)
+	}
+	sort.Strings(classes)
+	for _, name := range classes {
+		class := t[strings.ToUpper(name)]
+		retrieval := make(map[string]Retrieval)
+		for tier, r := range class.Retrieval {
+			retrieval[tier] = r
+		}
+		class.Retrieval = retrieval
+		for key, value := range overrides[name] {
+			if !class.set(key, value) {
+				return fmt.Errorf("unknown price %q for %s", key, name)
+			}
+		}
+		t[strings.ToUpper(name)] = class
+	}
+	return nil
+}
+
+// set changes the price called key, it returns false for names it does not know.
+func (c *Class) set(key string, value float64) bool {
+	switch key {
+	case "storage_per_gb":
+		c.StoragePerGB = value
+	case "put_per_1000":
+		c.PutPer1000 = value
+	case "minimum_days":
+		c.MinimumDays = value
+	case "object_month_per_1000":
+		c.ObjectMonthPer1000 = value
+	case "transfer_out_per_gb":
+		c.TransferOutPerGB = value
+	default:
+		for _, tier := range Tiers {
+			r := c.Retrieval[tier]
+			switch key {
+			case "retrieval_" + tier + "_per_gb":
+				r.PerGB = value
+			case "retrieval_" + tier + "_per_1000":
+				r.Per1000 = value
+			default:
+				continue
+			}
+			c.Retrieval[tier] = r
+			return true
+		}
+		return false
+	}
+	return true
+}
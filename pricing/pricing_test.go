@@ -0,0 +1,68 @@
+package pricing
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestEstimate(t *testing.T) {
+	now := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	table := Table{
+		"DEEP_ARCHIVE": {
+			StoragePerGB: 1, PutPer1000: 1000, MinimumDays: 180, TransferOutPerGB: 0.5,
+			Retrieval: map[string]Retrieval{Standard: {PerGB: 2, Per1000: 1000}, Bulk: {PerGB: 1}},
+		},
+	}
+	objects := []Object{
+		{StorageClass: "DEEP_ARCHIVE", Size: 1 << 30, Objects: 1, UploadedAt: now.AddDate(0, 0, -60)},
+		{StorageClass: "DEEP_ARCHIVE", Size: 2 << 30, Objects: 3, UploadedAt: now.AddDate(0, 0, -150), Deleted: true},
+	}
+	r := table.Estimate(objects, now)
+
+	if len(r.Classes) != 1 || r.Classes[0].Objects != 4 || !near(r.Monthly, 3) {
+		t.Fatalf("Expected 3 GB in 4 objects at 1 per GB, got %+v", r)
+	}
+	if !near(r.Put, 4) || len(r.Uploads) != 2 || r.Uploads[0].Month != "2024-02" {
+		t.Fatalf("Expected 4 PUTs over two months, got %+v", r.Uploads)
+	}
+	// 2 GB, 30 of the 180 days left
+	if r.Deletes.Files != 1 || !near(r.Deletes.Penalty, 2) {
+		t.Fatalf("Expected a penalty of 30 days for 2 GB, got %+v", r.Deletes)
+	}
+	expedited, standard, bulk := r.Restore[0], r.Restore[1], r.Restore[2]
+	if expedited.Available {
+		t.Fatal("Expected expedited restores to be unavailable for deep archive")
+	}
+	if !standard.Available || !near(standard.Total, 3*2+4+3*0.5) {
+		t.Fatalf("Unexpected standard restore %+v", standard)
+	}
+	if !near(bulk.Total, 3+1.5) {
+		t.Fatalf("Unexpected bulk restore %+v", bulk)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	table := Defaults()
+	err := table.Override(map[string]map[string]float64{
+		"deep_archive": {"storage_per_gb": 0.002, "retrieval_bulk_per_gb": 0.01},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deep := table["DEEP_ARCHIVE"]
+	if deep.StoragePerGB != 0.002 || deep.Retrieval[Bulk].PerGB != 0.01 || deep.PutPer1000 != 0.05 {
+		t.Fatalf("Expected only the overridden prices to change, got %+v", deep)
+	}
+	if Defaults()["DEEP_ARCHIVE"].Retrieval[Bulk].PerGB != 0.0025 {
+		t.Fatal("Expected the defaults to be left alone")
+	}
+	err = table.Override(map[string]map[string]float64{"GLACIER": {"storage": 1}})
+	if err == nil {
+		t.Fatal("Expected an error for an unknown price")
+	}
+}
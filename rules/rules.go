@@ -0,0 +1,349 @@
+package rules
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IgnoreFile is read from every directory that is walked, its patterns work like a .gitignore.
+const IgnoreFile = ".cleansyncignore"
+
+// Rule is a single gitignore style pattern.
+//
+//	*.sample.mkv    matches the name at any depth
+//	/Season 1/*.mkv is anchored to the directory of the rule
+//	extras/         only matches directories
+//	**/behind*      ** matches any number of directories
+//	!keep.mkv       re-includes what an earlier rule excluded
+type Rule struct {
+	Pattern  string
+	Negate   bool
+	DirOnly  bool
+	Anchored bool
+	Base     string // directory anchored patterns are relative to, empty for the source root
+	Source   string // where the rule came from, used by explain
+}
+
+// ParseRule parses one pattern. ok is false for blank lines and comments.
+func ParseRule(line string, base string, source string) (Rule, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return Rule{}, false
+	}
+	r := Rule{Base: base, Source: source}
+	if strings.HasPrefix(line, "!") {
+		r.Negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.DirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// like git, a slash anywhere but the end anchors the pattern
+	if strings.Contains(line, "/") {
+		r.Anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	r.Pattern = strings.ToLower(filepath.ToSlash(line))
+	return r, r.Pattern != ""
+}
+
+func (r Rule) String() string {
+	s := r.Pattern
+	if r.Anchored {
+		s = "/" + s
+	}
+	if r.DirOnly {
+		s += "/"
+	}
+	if r.Negate {
+		s = "!" + s
+	}
+	return s
+}
+
+// Match reports whether the rule applies to p, which lives under root.
+func (r Rule) Match(root string, p string, isDir bool) bool {
+	return r.matches(root, p, isDir)
+}
+
+// matches reports whether the rule applies to p, which lives under root.
+func (r Rule) matches(root string, p string, isDir bool) bool {
+	if r.DirOnly && !isDir {
+		return false
+	}
+	base := r.Base
+	if base == "" {
+		base = root
+	}
+	rel, err := filepath.Rel(base, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = strings.ToLower(filepath.ToSlash(rel))
+	if !r.Anchored {
+		ok, _ := path.Match(r.Pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(r.Pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches a pattern split on / against a path split on /, ** matches zero or more segments.
+func matchSegments(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], segments[0])
+	return ok && matchSegments(pattern[1:], segments[1:])
+}
+
+// Decision is the outcome of checking a file or directory against a Set.
+type Decision struct {
+	Included bool
+	Reason   string
+}
+
+// Set decides which files under a source root are synced.
+type Set struct {
+	Extensions []string // lower case with the leading dot
+	Everything bool     // the filters have a *, every extension is synced
+	Includes   []Rule   // when there are any, a file has to match one of them
+	Excludes   []Rule   // checked before the ignore files, the last matching rule wins
+	MinSize    int64
+	MaxSize    int64
+	MinAge     time.Duration
+	MaxAge     time.Duration
+	Now        func() time.Time
+
+	ignores map[string][]Rule // .cleansyncignore rules per directory
+}
+
+// New creates a set from the filters (file extensions) and the include and exclude patterns.
+func New(filters []string, includes []string, excludes []string) *Set {
+	s := &Set{}
+	for _, f := range filters {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" {
+			continue
+		}
+		if f == "*" || f == ".*" {
+			s.Everything = true
+			continue
+		}
+		if !strings.HasPrefix(f, ".") {
+			f = "." + f
+		}
+		s.Extensions = append(s.Extensions, f)
+	}
+	for _, p := range includes {
+		if r, ok := ParseRule(p, "", "--include "+p); ok {
+			s.Includes = append(s.Includes, r)
+		}
+	}
+	for _, p := range excludes {
+		if r, ok := ParseRule(p, "", "--exclude "+p); ok {
+			s.Excludes = append(s.Excludes, r)
+		}
+	}
+	return s
+}
+
+// Empty reports whether the set has neither filters nor include patterns. It includes no file then,
+// like sync did before there were include patterns; a * filter includes every file.
+func (s *Set) Empty() bool {
+	return !s.Everything && len(s.Extensions) == 0 && len(s.Includes) == 0
+}
+
+// Check decides on the file or directory p below root.
+func (s *Set) Check(root string, p string, info os.FileInfo) Decision {
+	if info.Name() == IgnoreFile {
+		return Decision{false, "it is an ignore file"}
+	}
+	isDir := info.IsDir()
+	reason := "no rule excludes it"
+
+	if !isDir {
+		if s.Empty() {
+			return Decision{false, "there is no filter or include pattern, use -filter '*' to sync every file"}
+		}
+		if len(s.Extensions) > 0 && !s.Everything {
+			ext := strings.ToLower(filepath.Ext(p))
+			if !contains(s.Extensions, ext) {
+				return Decision{false, fmt.Sprintf("extension %q is not one of the filters %s", ext, strings.Join(s.Extensions, ", "))}
+			}
+			reason = fmt.Sprintf("extension %s matches the filters", ext)
+		}
+		if len(s.Includes) > 0 {
+			matched := false
+			for _, r := range s.Includes {
+				if r.matches(root, p, false) {
+					matched = true
+					reason = fmt.Sprintf("matches %s (%s)", r, r.Source)
+					break
+				}
+			}
+			if !matched {
+				return Decision{false, "matches none of the include patterns"}
+			}
+		}
+	}
+
+	// exclude rules first, then the ignore files from the root down, the last match wins
+	rules := append([]Rule{}, s.Excludes...)
+	rules = append(rules, s.ignoreRules(root, filepath.Dir(p))...)
+	included := true
+	for _, r := range rules {
+		if r.matches(root, p, isDir) {
+			included = r.Negate
+			if r.Negate {
+				reason = fmt.Sprintf("re-included by %s (%s)", r, r.Source)
+			} else {
+				reason = fmt.Sprintf("excluded by %s (%s)", r, r.Source)
+			}
+		}
+	}
+	if !included || isDir {
+		return Decision{included, reason}
+	}
+
+	if s.MinSize > 0 && info.Size() < s.MinSize {
+		return Decision{false, fmt.Sprintf("smaller than the minimum size of %d bytes", s.MinSize)}
+	}
+	if s.MaxSize > 0 && info.Size() > s.MaxSize {
+		return Decision{false, fmt.Sprintf("larger than the maximum size of %d bytes", s.MaxSize)}
+	}
+	age := s.now().Sub(info.ModTime())
+	if s.MinAge > 0 && age < s.MinAge {
+		return Decision{false, fmt.Sprintf("modified %s ago, younger than the minimum age of %s", age.Round(time.Second), s.MinAge)}
+	}
+	if s.MaxAge > 0 && age > s.MaxAge {
+		return Decision{false, fmt.Sprintf("modified %s ago, older than the maximum age of %s", age.Round(time.Second), s.MaxAge)}
+	}
+	return Decision{true, reason}
+}
+
+// Explain decides on p below root, taking every directory between them into account
+// the same way a walk of root would.
+func (s *Set) Explain(root string, p string) (Decision, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return Decision{}, err
+	}
+	rel, err := filepath.Rel(root, p)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return Decision{false, fmt.Sprintf("it is not below the source path %s", root)}, nil
+	}
+	dir := root
+	parts := strings.Split(rel, string(filepath.Separator))
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		dirInfo, err := os.Stat(dir)
+		if err != nil {
+			return Decision{}, err
+		}
+		d := s.Check(root, dir, dirInfo)
+		if !d.Included {
+			return Decision{false, fmt.Sprintf("its directory %s is %s", dir, d.Reason)}, nil
+		}
+	}
+	return s.Check(root, p, info), nil
+}
+
+// ignoreRules returns the rules of the ignore files from root down to dir.
+func (s *Set) ignoreRules(root string, dir string) []Rule {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+	dirs := []string{root}
+	if rel != "." {
+		current := root
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			current = filepath.Join(current, part)
+			dirs = append(dirs, current)
+		}
+	}
+	var res []Rule
+	for _, d := range dirs {
+		res = append(res, s.loadIgnoreFile(d)...)
+	}
+	return res
+}
+
+// loadIgnoreFile reads the ignore file of dir, once.
+func (s *Set) loadIgnoreFile(dir string) []Rule {
+	if s.ignores == nil {
+		s.ignores = make(map[string][]Rule)
+	}
+	if rules, ok := s.ignores[dir]; ok {
+		return rules
+	}
+	var rules []Rule
+	name := filepath.Join(dir, IgnoreFile)
+	f, err := os.Open(name)
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		line := 0
+		for scanner.Scan() {
+			line++
+			if r, ok := ParseRule(scanner.Text(), dir, fmt.Sprintf("%s:%d", name, line)); ok {
+				rules = append(rules, r)
+			}
+		}
+		f.Close()
+	}
+	s.ignores[dir] = rules
+	return rules
+}
+
+func (s *Set) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAge parses ages like "30d", "2w" or anything time.ParseDuration understands.
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
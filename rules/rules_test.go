@@ -0,0 +1,109 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckExtensions(t *testing.T) {
+	root := t.TempDir()
+	set := New([]string{"mkv", ".MP4"}, nil, nil)
+	cases := map[string]bool{
+		"show.mkv":    true,
+		"SHOW.MKV":    true,
+		"movie.mp4":   true,
+		"foo.notmkv":  false,
+		"subs.srt":    false,
+		"mkv":         false,
+		"archive.mkv": true,
+	}
+	for name, want := range cases {
+		p := writeFile(t, root, name, "x")
+		info, _ := os.Stat(p)
+		if got := set.Check(root, p, info); got.Included != want {
+			t.Fatalf("%s: expected included=%v, got %+v", name, want, got)
+		}
+	}
+}
+
+func TestCheckWithoutFilters(t *testing.T) {
+	root := t.TempDir()
+	p := writeFile(t, root, "notes.txt", "x")
+	info, _ := os.Stat(p)
+	set := New(nil, nil, nil)
+	if !set.Empty() || set.Check(root, p, info).Included {
+		t.Fatal("Expected nothing to be synced without filters or include patterns")
+	}
+	set = New([]string{"*"}, nil, nil)
+	if set.Empty() || !set.Check(root, p, info).Included {
+		t.Fatal("Expected a * filter to sync every file")
+	}
+	set = New(nil, []string{"*.txt"}, nil)
+	if set.Empty() || !set.Check(root, p, info).Included {
+		t.Fatal("Expected an include pattern to be enough to sync a file")
+	}
+}
+
+func TestIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, IgnoreFile, "# extras are not worth it\nextras/\n*.sample.mkv\n/Show/S1/skip.mkv\n")
+	writeFile(t, root, filepath.Join("Show", "S2", IgnoreFile), "!keep.sample.mkv\n")
+	set := New([]string{"mkv"}, nil, []string{"**/behind*"})
+
+	cases := map[string]bool{
+		filepath.Join("Show", "S1", "e1.mkv"):           true,
+		filepath.Join("Show", "S1", "skip.mkv"):         false,
+		filepath.Join("Show", "S1", "e1.sample.mkv"):    false,
+		filepath.Join("Show", "S2", "keep.sample.mkv"):  true,
+		filepath.Join("Show", "extras", "e1.mkv"):       false,
+		filepath.Join("Show", "S2", "behind-scene.mkv"): false,
+	}
+	for name, want := range cases {
+		p := writeFile(t, root, name, "x")
+		got, err := set.Explain(root, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Included != want {
+			t.Fatalf("%s: expected included=%v, got %+v", name, want, got)
+		}
+	}
+}
+
+func TestSizeAndAge(t *testing.T) {
+	root := t.TempDir()
+	p := writeFile(t, root, "a.mkv", "0123456789")
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(p, old, old)
+	info, _ := os.Stat(p)
+
+	set := New([]string{"*"}, nil, nil)
+	set.MinSize = 20
+	if set.Check(root, p, info).Included {
+		t.Fatal("Expected a file below the minimum size to be excluded")
+	}
+	set = New([]string{"*"}, nil, nil)
+	set.MaxAge, _ = ParseAge("1d")
+	if set.Check(root, p, info).Included {
+		t.Fatal("Expected a file older than the maximum age to be excluded")
+	}
+	set.MaxAge, _ = ParseAge("1w")
+	if !set.Check(root, p, info).Included {
+		t.Fatal("Expected a file within the maximum age to be included")
+	}
+}
+
+func writeFile(t *testing.T, root string, name string, content string) string {
+	p := filepath.Join(root, name)
+	err := os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(p, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -0,0 +1,173 @@
+package splitter
+
+import (
+	"bufio"
+	"cleansync/filesystem"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// WriteSidecar writes sc next to the parts of prefix.
+func WriteSidecar(prefix string, sc Sidecar) error {
+	b, err := sc.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(SidecarName(prefix), b, 0644)
+}
+
+// ReadSidecar reads the sidecar of prefix, ok is false when there is none.
+func ReadSidecar(prefix string) (sc Sidecar, ok bool, err error) {
+	b, err := os.ReadFile(SidecarName(prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return sc, false, nil
+	}
+	if err != nil {
+		return sc, false, err
+	}
+	err = json.Unmarshal(b, &sc)
+	if err != nil {
+		return sc, false, fmt.Errorf("%s: %w", SidecarName(prefix), err)
+	}
+	return sc, true, nil
+}
+
+// FindParts lists the parts of prefix in order, for parts that came without a sidecar.
+// A gap in the numbering is an error, a missing part would go unnoticed otherwise.
+func FindParts(prefix string) ([]string, error) {
+	matches, err := filepath.Glob(filesystem.GlobEscape(prefix) + ".part*")
+	if err != nil {
+		return nil, err
+	}
+	var numbers []int
+	for _, m := range matches {
+		n, err := strconv.Atoi(strings.TrimPrefix(m, prefix+".part"))
+		if err == nil && n >= 0 {
+			numbers = append(numbers, n)
+		}
+	}
+	if len(numbers) == 0 {
+		return nil, fmt.Errorf("there are no parts of %s, expected %s", prefix, PartName(prefix, 0))
+	}
+	sort.Ints(numbers)
+	var parts []string
+	for i, n := range numbers {
+		if n != i {
+			return nil, fmt.Errorf("%s is missing, found parts up to %s", PartName(prefix, i), PartName(prefix, numbers[len(numbers)-1]))
+		}
+		parts = append(parts, PartName(prefix, i))
+	}
+	return parts, nil
+}
+
+// checkSidecar makes sure the parts listed in sc are the ones of prefix, complete and in order.
+func checkSidecar(prefix string, sc Sidecar) ([]string, error) {
+	var parts []string
+	var offset int64
+	for i, p := range sc.Parts {
+		if p.Name != PartName(sc.File, i) || p.Offset != offset {
+			return nil, fmt.Errorf("%s lists %s at offset %d as part %d, the parts are out of order", SidecarName(prefix), p.Name, p.Offset, i)
+		}
+		part := filepath.Join(filepath.Dir(prefix), p.Name)
+		fi, err := os.Stat(part)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("part %d of %d is missing: %s", i+1, len(sc.Parts), part)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if fi.Size() != p.Size {
+			return nil, fmt.Errorf("%s has %d bytes, the sidecar expects %d", part, fi.Size(), p.Size)
+		}
+		parts = append(parts, part)
+		offset += p.Size
+	}
+	if offset != sc.Size {
+		return nil, fmt.Errorf("the parts listed in %s add up to %d bytes, expected %d", SidecarName(prefix), offset, sc.Size)
+	}
+	return parts, nil
+}
+
+// JoinFile puts the parts of prefix back together into out. With a sidecar every part and the
+// result are checked against its hashes, verified reports whether there was one. out is removed
+// again when anything goes wrong.
+func JoinFile(prefix string, out string, pw *filesystem.ProgressReadWriter) (verified bool, err error) {
+	sc, verified, err := ReadSidecar(prefix)
+	if err != nil {
+		return false, err
+	}
+	var parts []string
+	if verified {
+		parts, err = checkSidecar(prefix, sc)
+	} else {
+		parts, err = FindParts(prefix)
+	}
+	if err != nil {
+		return verified, err
+	}
+	var total int64
+	for _, p := range parts {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return verified, err
+		}
+		total += fi.Size()
+	}
+	atomic.StoreInt64(&pw.Size, total)
+
+	f, err := os.Create(out)
+	if err != nil {
+		return verified, err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(out)
+		}
+	}()
+	defer f.Close()
+	w := bufio.NewWriterSize(f, DefaultChunkSize)
+	whole := sha256.New()
+	for i, p := range parts {
+		sum, err := appendPart(w, whole, p, pw)
+		if err != nil {
+			return verified, err
+		}
+		if verified && sum != sc.Parts[i].SHA256 {
+			return verified, fmt.Errorf("%s does not match the hash in %s", p, SidecarName(prefix))
+		}
+	}
+	err = w.Flush()
+	if err != nil {
+		return verified, err
+	}
+	if verified && hex.EncodeToString(whole.Sum(nil)) != sc.SHA256 {
+		return verified, fmt.Errorf("%s does not match the hash in %s", out, SidecarName(prefix))
+	}
+	return verified, f.Close()
+}
+
+// appendPart copies the part at p to w and returns its hash, whole gets the same bytes.
+func appendPart(w io.Writer, whole hash.Hash, p string, pw *filesystem.ProgressReadWriter) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.CopyBuffer(io.MultiWriter(w, whole, h), pw.Track(f), make([]byte, DefaultChunkSize))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,157 @@
+package splitter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"path/filepath"
+)
+
+// SidecarSuffix is appended to the name of a split file for the sidecar that describes its parts.
+const SidecarSuffix = ".parts.json"
+
+// Sidecar lists the parts of a split file, so it can be put back together without the
+// manifest and without guessing part names.
+type Sidecar struct {
+	File     string        `json:"file"` // the name of the original file
+	Size     int64         `json:"size"`
+	SHA256   string        `json:"sha256"`
+	PartSize int64         `json:"part_size"`
+	Parts    []SidecarPart `json:"parts"`
+}
+
+// SidecarPart is a single part in a Sidecar.
+type SidecarPart struct {
+	Name   string `json:"name"`          // the file name of the part, next to the sidecar
+	Key    string `json:"key,omitempty"` // the object key, for parts in a bucket
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// SidecarName is the name of the sidecar for the parts of prefix.
+func SidecarName(prefix string) string {
+	return prefix + SidecarSuffix
+}
+
+// Sidecar describes the parts of the file. All hashes have to be known, see Complete.
+func (info *SplitInfo) Sidecar() (Sidecar, error) {
+	if info.Hash == "" {
+		return Sidecar{}, fmt.Errorf("the hash of %s is not known yet", info.OrgFilePath)
+	}
+	sc := Sidecar{
+		File:     filepath.Base(info.OrgFilePath),
+		Size:     info.OrgFileSize,
+		SHA256:   info.Hash,
+		PartSize: info.PartSize,
+	}
+	for i := range info.Parts {
+		offset, size := info.Section(i)
+		if i >= len(info.Hashes) || info.Hashes[i] == "" {
+			return Sidecar{}, fmt.Errorf("the hash of part %d of %s is not known yet", i, info.OrgFilePath)
+		}
+		sc.Parts = append(sc.Parts, SidecarPart{
+			Name:   PartName(sc.File, i),
+			Offset: offset,
+			Size:   size,
+			SHA256: info.Hashes[i],
+		})
+	}
+	return sc, nil
+}
+
+// Marshal renders the sidecar as indented JSON.
+func (sc Sidecar) Marshal() ([]byte, error) {
+	return json.MarshalIndent(sc, "", "  ")
+}
+
+// PartReader reads a part of the original file and hashes it on the way.
+type PartReader struct {
+	info  *SplitInfo
+	index int
+	r     io.Reader
+	hash  hash.Hash
+	read  int64
+	whole bool // feeding the hash of the whole file
+}
+
+// ReadPart returns a reader over part i of f, the original file. Once the part has been read
+// completely Done checks it. Parts read in order also make up the hash of the whole file.
+func (info *SplitInfo) ReadPart(f io.ReaderAt, i int) *PartReader {
+	offset, size := info.Section(i)
+	pr := &PartReader{
+		info:  info,
+		index: i,
+		r:     io.NewSectionReader(f, offset, size),
+		hash:  sha256.New(),
+	}
+	if i == 0 {
+		info.whole = sha256.New()
+		info.wholeNext = 0
+	}
+	pr.whole = info.whole != nil && i == info.wholeNext
+	return pr
+}
+
+func (pr *PartReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.hash.Write(p[:n])
+	if pr.whole {
+		pr.info.whole.Write(p[:n])
+	}
+	pr.read += int64(n)
+	return n, err
+}
+
+// Done records the hash of the part once it has been read completely. A part that does not
+// match the hash recorded for it earlier means the file changed in the meantime.
+func (pr *PartReader) Done() (string, error) {
+	info := pr.info
+	_, size := info.Section(pr.index)
+	sum := hex.EncodeToString(pr.hash.Sum(nil))
+	var err error
+	switch {
+	case pr.read != size:
+		err = fmt.Errorf("read %d bytes of part %d of %s, expected %d", pr.read, pr.index, info.OrgFilePath, size)
+	case pr.index < len(info.Hashes) && info.Hashes[pr.index] != "" && info.Hashes[pr.index] != sum:
+		err = fmt.Errorf("part %d of %s changed since it was first read", pr.index, info.OrgFilePath)
+	}
+	if err != nil {
+		if pr.whole {
+			info.whole = nil
+		}
+		return "", err
+	}
+	info.Record(pr.index, size, sum)
+	if pr.whole {
+		info.wholeNext++
+		if info.wholeNext == len(info.Parts) {
+			info.Hash = hex.EncodeToString(info.whole.Sum(nil))
+			info.whole = nil
+		}
+	}
+	return sum, nil
+}
+
+// Complete reads whatever it takes from f, the original file, to fill in the hashes that are
+// still unknown, e.g. of parts that were uploaded by an earlier run.
+func (info *SplitInfo) Complete(f io.ReaderAt) error {
+	for i := range info.Parts {
+		if info.Hash != "" && i < len(info.Hashes) && info.Hashes[i] != "" {
+			continue
+		}
+		pr := info.ReadPart(f, i)
+		_, err := io.CopyBuffer(io.Discard, pr, make([]byte, DefaultChunkSize))
+		if err != nil {
+			return err
+		}
+		_, err = pr.Done()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,13 +4,16 @@ import (
 	"bufio"
 	"cleansync/filesystem"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
 )
 
-const chunkSize = int64(16 * 1024 * 1024) // 16mb chunks x 128 iterations = 2GB pieces
-const partSize = 2 * 1024 * 1024 * 1024   // 2GB
+const DefaultChunkSize = 16 * 1024 * 1024            // 16mb read buffer
+const DefaultPartSize = 2 * 1024 * 1024 * 1024       // 2GB, parts are this big unless SplitInfo says otherwise
+const DefaultSplitThreshold = 4 * 1024 * 1024 * 1024 // files over 4GB are uploaded in parts
+const MaxObjectSize = 5 * 1024 * 1024 * 1024         // the most a single PUT can upload
 
 // func (pw *ProgressWriter) GetProgress(ch chan messages.ProgressMsg) {
 // 	for {
@@ -53,16 +56,83 @@ const partSize = 2 * 1024 * 1024 * 1024   // 2GB
 
 type SplitInfo struct {
 	OrgFilePath     string
-	Parts           []string
+	VideoID         int
+	Parts           []string // every part the file is split into, planned up front
+	Hashes          []string // hex sha256 of the parts, empty while unknown
+	Sizes           []int64
 	Offset          int64
 	Eof             bool
 	TempFolder      string
 	PercentComplete float64
 	OrgFileSize     int64
-	Index           int
+	PartSize        int64  // DefaultPartSize when not set
+	Index           int    // the next part to write
+	Hash            string // hex sha256 of the whole file, empty while unknown
+
+	whole     hash.Hash // the hash of the parts read in order so far
+	wholeNext int       // the part whole is waiting for
+}
+
+// PartCount is how many parts of partSize a file of size bytes is split into.
+func PartCount(size int64, partSize int64) int {
+	if size <= 0 {
+		return 0
+	}
+	return int((size + partSize - 1) / partSize)
+}
+
+// PartName is the name of part i of prefix, the name RecombineFile looks for.
+func PartName(prefix string, i int) string {
+	return fmt.Sprintf("%s.part%d", prefix, i)
+}
+
+// Layout plans the parts of the file at p of size bytes without writing anything, for
+// uploading every part straight from the file. The parts are named after p.
+func Layout(p string, size int64, partSize int64) *SplitInfo {
+	if partSize == 0 {
+		partSize = DefaultPartSize
+	}
+	info := &SplitInfo{
+		OrgFilePath: p,
+		OrgFileSize: size,
+		PartSize:    partSize,
+	}
+	for i := 0; i < PartCount(size, partSize); i++ {
+		info.Parts = append(info.Parts, PartName(p, i))
+		_, n := info.Section(i)
+		info.Sizes = append(info.Sizes, n)
+		info.Hashes = append(info.Hashes, "")
+	}
+	info.Eof = true
+	return info
 }
 
+// Section returns where part i starts in the original file and how big it is.
+func (info *SplitInfo) Section(i int) (int64, int64) {
+	offset := int64(i) * info.PartSize
+	return offset, min(info.PartSize, info.OrgFileSize-offset)
+}
+
+// Record keeps the size and hash of part i.
+func (info *SplitInfo) Record(i int, size int64, hash string) {
+	for len(info.Sizes) <= i {
+		info.Sizes = append(info.Sizes, 0)
+	}
+	for len(info.Hashes) <= i {
+		info.Hashes = append(info.Hashes, "")
+	}
+	info.Sizes[i] = size
+	info.Hashes[i] = hash
+}
+
+// SplitFile writes the part at info.Index and moves info on to the next one.
 func SplitFile(info *SplitInfo, pw *filesystem.ProgressReadWriter) (*SplitInfo, error) {
+	if info.PartSize == 0 {
+		info.PartSize = DefaultPartSize
+	}
+	if info.Index >= len(info.Parts) {
+		return nil, fmt.Errorf("%s has no part %d", info.OrgFilePath, info.Index)
+	}
 
 	file, err := os.Open(info.OrgFilePath)
 	if err != nil {
@@ -76,6 +146,7 @@ func SplitFile(info *SplitInfo, pw *filesystem.ProgressReadWriter) (*SplitInfo,
 	}
 
 	info.OrgFileSize = fileInfo.Size()
+	length := min(info.PartSize, info.OrgFileSize-info.Offset)
 
 	partFile, err := os.Create(info.Parts[info.Index])
 	if err != nil {
@@ -83,51 +154,36 @@ func SplitFile(info *SplitInfo, pw *filesystem.ProgressReadWriter) (*SplitInfo,
 	}
 	defer partFile.Close()
 
-	pw.Writer = bufio.NewWriter(partFile)
+	buffered := bufio.NewWriter(partFile)
+	pw.Writer = buffered
 	pw.ResetProgress()
+	pw.Size = length
 
-	for i := 0; i < 128; i++ { // 16 MB chunks * 128 iterations = 2GB files
-		n, err := writeChunk(file, pw, info.Offset, info.OrgFileSize)
-		if err != nil {
-			if err == io.EOF {
-				// done, reached the end of the file
-				info.Eof = true
-				info.Offset = 0
-				return info, nil
-			}
-			return nil, err
-		}
-		info.Offset = info.Offset + int64(n)
+	part := info.ReadPart(file, info.Index)
+	n, err := io.CopyBuffer(pw, part, make([]byte, DefaultChunkSize))
+	if err != nil {
+		return nil, err
 	}
-	info.Index++
-	return info, nil
-}
-
-func writeChunk(reader *os.File, writer *filesystem.ProgressReadWriter, offset int64, fullSize int64) (int, error) {
-	sizeLeft := fullSize - offset
-	writer.Size = sizeLeft % partSize
-	if sizeLeft >= partSize {
-		writer.Size = partSize
+	if n != length {
+		return nil, fmt.Errorf("%s: expected %d bytes for part %d, read %d", info.OrgFilePath, length, info.Index, n)
 	}
-	buffer := make([]byte, chunkSize)
-	n, err := reader.ReadAt(buffer, offset)
+	err = buffered.Flush()
 	if err != nil {
-		if err == io.EOF {
-			eoferr := err
-			n, err = writer.Write(buffer[:n])
-			if err != nil {
-				return 0, err
-			}
-			return n, eoferr
-		}
-		return 0, err
+		return nil, err
 	}
-	n, err = writer.Write(buffer[:n])
+	err = partFile.Sync()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return n, nil
-
+	// records the hash of the part, and of the whole file after the last one
+	_, err = part.Done()
+	if err != nil {
+		return nil, err
+	}
+	info.Offset += n
+	info.Index++
+	info.Eof = info.Offset >= info.OrgFileSize
+	return info, nil
 }
 
 func RecombineFile(partPrefix string) (string, error) {
@@ -140,7 +196,7 @@ func RecombineFile(partPrefix string) (string, error) {
 
 	var partIndex int
 	for {
-		partFile := fmt.Sprintf("%s.part%d", partPrefix, partIndex)
+		partFile := PartName(partPrefix, partIndex)
 		file, err := os.Open(partFile)
 		if os.IsNotExist(err) {
 			break
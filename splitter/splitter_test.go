@@ -1,5 +1,18 @@
 package splitter
 
+import (
+	"bytes"
+	"cleansync/filesystem"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
 // import (
 // 	"testing"
 // )
@@ -36,3 +49,205 @@ package splitter
 // 	t.Fatal(res)
 
 // }
+
+func TestSplitFileResumes(t *testing.T) {
+	dir := t.TempDir()
+	org := filepath.Join(dir, "video.mkv")
+	data := bytes.Repeat([]byte("0123456789"), 25)
+	err := os.WriteFile(org, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &SplitInfo{OrgFilePath: org, PartSize: 100}
+	for i := 0; i < PartCount(int64(len(data)), info.PartSize); i++ {
+		info.Parts = append(info.Parts, fmt.Sprintf("%s.part%d", org, i))
+	}
+	if len(info.Parts) != 3 {
+		t.Fatalf("Expected 3 parts, got %d", len(info.Parts))
+	}
+
+	// split the first part, then carry on as a restarted run would
+	_, err = SplitFile(info, &filesystem.ProgressReadWriter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed := &SplitInfo{OrgFilePath: org, PartSize: 100, Parts: info.Parts, Offset: info.Offset, Index: info.Index,
+		Hashes: info.Hashes, Sizes: info.Sizes}
+	for !resumed.Eof {
+		_, err = SplitFile(resumed, &filesystem.ProgressReadWriter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if resumed.Index != 3 || resumed.Sizes[2] != 50 {
+		t.Fatalf("Expected the last part to hold the remaining 50 bytes, got %v", resumed.Sizes)
+	}
+	hash, err := filesystem.HashFile(info.Parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != resumed.Hashes[1] {
+		t.Fatalf("Expected the recorded hash %s, got %s", resumed.Hashes[1], hash)
+	}
+
+	os.Remove(org)
+	_, err = RecombineFile(org)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(org)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("Expected the recombined file to match the original")
+	}
+}
+
+func TestLayout(t *testing.T) {
+	info := Layout("/tv/video.mkv", 200, 100)
+	if len(info.Parts) != 2 || info.Parts[1] != "/tv/video.mkv.part1" {
+		t.Fatalf("Expected 2 parts named after the file, got %v", info.Parts)
+	}
+	offset, size := info.Section(1)
+	if offset != 100 || size != 100 {
+		t.Fatalf("Expected the second part at 100 with 100 bytes, got %d %d", offset, size)
+	}
+	if n := len(Layout("/tv/empty.mkv", 0, 100).Parts); n != 0 {
+		t.Fatalf("Expected no parts for an empty file, got %d", n)
+	}
+}
+
+func TestSidecar(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 25)
+	f := bytes.NewReader(data)
+	info := Layout("/tv/video.mkv", int64(len(data)), 100)
+
+	// the second part was uploaded by an earlier run, so the whole file is not read in order
+	pr := info.ReadPart(f, 1)
+	io.Copy(io.Discard, pr)
+	if _, err := pr.Done(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := info.Sidecar(); err == nil {
+		t.Fatal("Expected no sidecar while hashes are missing")
+	}
+	err := info.Complete(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := info.Sidecar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	whole := sha256.Sum256(data)
+	if sc.SHA256 != hex.EncodeToString(whole[:]) {
+		t.Fatalf("Expected the hash of the whole file, got %s", sc.SHA256)
+	}
+	part := sha256.Sum256(data[200:])
+	if len(sc.Parts) != 3 || sc.Parts[2].Name != "video.mkv.part2" || sc.Parts[2].Offset != 200 || sc.Parts[2].SHA256 != hex.EncodeToString(part[:]) {
+		t.Fatalf("Unexpected parts %+v", sc.Parts)
+	}
+
+	// a part that reads differently the next time means the file changed
+	data[0] = 'x'
+	pr = info.ReadPart(bytes.NewReader(data), 0)
+	io.Copy(io.Discard, pr)
+	if _, err := pr.Done(); err == nil {
+		t.Fatal("Expected a changed part to be caught")
+	}
+}
+
+// splitForJoin splits 250 bytes into parts of 100 in a temp dir and returns the prefix of the parts.
+func splitForJoin(t *testing.T) (string, []byte) {
+	dir := t.TempDir()
+	org := filepath.Join(dir, "video.mkv")
+	data := bytes.Repeat([]byte("0123456789"), 25)
+	err := os.WriteFile(org, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := filepath.Join(dir, "parts", "video.mkv")
+	os.MkdirAll(filepath.Dir(prefix), 0755)
+	info := &SplitInfo{OrgFilePath: org, PartSize: 100}
+	for i := 0; i < PartCount(int64(len(data)), 100); i++ {
+		info.Parts = append(info.Parts, PartName(prefix, i))
+	}
+	for !info.Eof {
+		_, err = SplitFile(info, &filesystem.ProgressReadWriter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sc, err := info.Sidecar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WriteSidecar(prefix, sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prefix, data
+}
+
+func TestJoinFile(t *testing.T) {
+	prefix, data := splitForJoin(t)
+	out := filepath.Join(filepath.Dir(prefix), "joined.mkv")
+	verified, err := JoinFile(prefix, out, &filesystem.ProgressReadWriter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(out)
+	if !verified || !bytes.Equal(got, data) {
+		t.Fatalf("Expected a verified copy of the original, verified %v", verified)
+	}
+
+	// without the sidecar the parts are found by name
+	os.Remove(out)
+	os.Remove(SidecarName(prefix))
+	verified, err = JoinFile(prefix, out, &filesystem.ProgressReadWriter{})
+	if err != nil || verified {
+		t.Fatalf("Expected an unverified join, got %v %v", verified, err)
+	}
+	os.Remove(PartName(prefix, 1))
+	_, err = JoinFile(prefix, filepath.Join(filepath.Dir(prefix), "gap.mkv"), &filesystem.ProgressReadWriter{})
+	if err == nil || !strings.Contains(err.Error(), "part1 is missing") {
+		t.Fatalf("Expected the gap to be reported, got %v", err)
+	}
+}
+
+func TestJoinFileChecksSidecar(t *testing.T) {
+	prefix, _ := splitForJoin(t)
+	out := filepath.Join(filepath.Dir(prefix), "joined.mkv")
+	sc, _, err := ReadSidecar(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// out of order
+	swapped := sc
+	swapped.Parts = []SidecarPart{sc.Parts[1], sc.Parts[0], sc.Parts[2]}
+	WriteSidecar(prefix, swapped)
+	_, err = JoinFile(prefix, out, &filesystem.ProgressReadWriter{})
+	if err == nil || !strings.Contains(err.Error(), "out of order") {
+		t.Fatalf("Expected the order to be refused, got %v", err)
+	}
+
+	// a part that was damaged
+	WriteSidecar(prefix, sc)
+	os.WriteFile(PartName(prefix, 2), bytes.Repeat([]byte("x"), 50), 0644)
+	_, err = JoinFile(prefix, out, &filesystem.ProgressReadWriter{})
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("Expected the damaged part to be caught, got %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Fatal("Expected the unfinished output to be removed")
+	}
+
+	// missing
+	os.Remove(PartName(prefix, 2))
+	_, err = JoinFile(prefix, out, &filesystem.ProgressReadWriter{})
+	if err == nil || !strings.Contains(err.Error(), "part 3 of 3 is missing") {
+		t.Fatalf("Expected the missing part to be reported, got %v", err)
+	}
+}